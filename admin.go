@@ -1,11 +1,14 @@
 package gohelix
 
 import (
-	"bytes"
+	"encoding/json"
 	"errors"
-	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/yichen/go-zookeeper/zk"
 )
 
 var (
@@ -25,11 +28,58 @@ var (
 	// ErrStateModelDefNotExist the state model definition is expected to exist in zookeeper
 	ErrStateModelDefNotExist = errors.New("state model not exist in cluster")
 
+	// ErrStateModelDefExists the state model definition already exists in cluster and
+	// cannot be added again
+	ErrStateModelDefExists = errors.New("state model already exists in cluster")
+
 	// ErrResourceExists the resource already exists in cluster and cannot be added again
 	ErrResourceExists = errors.New("resource already exists in cluster")
 
 	// ErrResourceNotExists the resource does not exists and cannot be removed
 	ErrResourceNotExists = errors.New("resource not exists in cluster")
+
+	// ErrInvalidReplicas the replication factor of a resource must be positive
+	ErrInvalidReplicas = errors.New("replication factor must be positive")
+
+	// ErrInvalidConfigScope the config scope is unknown or does not have the expected
+	// scope keys, see SetConfig
+	ErrInvalidConfigScope = errors.New("invalid config scope")
+
+	// ErrInstanceLive the instance is live when it is expected to be down
+	ErrInstanceLive = errors.New("instance is live")
+
+	// ErrInstanceSwapConflict the new instance of a swap already holds a partition of the
+	// old instance
+	ErrInstanceSwapConflict = errors.New("new instance already holds a partition of the old instance")
+
+	// ErrInstanceInUse the instance is still named in the ideal states of the cluster
+	ErrInstanceInUse = errors.New("instance is still assigned partitions")
+
+	// ErrTimeout the operation did not complete in time
+	ErrTimeout = errors.New("timed out")
+
+	// ErrInvalidFormat the format of a cluster definition is neither json nor yaml
+	ErrInvalidFormat = errors.New("invalid format")
+
+	// ErrInvalidConflictMode the conflict mode of an import is unknown
+	ErrInvalidConflictMode = errors.New("invalid conflict mode")
+
+	// ErrInvalidSpec the cluster spec has no cluster name, an instance not named host_port,
+	// an instance or resource named twice, or a resource without partitions or a state
+	// model
+	ErrInvalidSpec = errors.New("invalid cluster spec")
+
+	// ErrResourceSpecChanged the cluster spec changes the number of partitions or the
+	// state model of an existing resource
+	ErrResourceSpecChanged = errors.New("the partitions and the state model of a resource cannot be changed")
+
+	// ErrImportConflict the records of a cluster definition conflict with the existing
+	// ones, see ImportCluster
+	ErrImportConflict = errors.New("cluster definition conflicts with the existing cluster")
+
+	// ErrEvacuationInProgress the instance still holds replicas and cannot be dropped yet,
+	// see ApplyPlan
+	ErrEvacuationInProgress = errors.New("evacuation in progress, apply again to drop the instance")
 )
 
 // Admin handles the administration task for the Helix cluster. Many of the operations
@@ -39,16 +89,33 @@ type Admin struct {
 	ZkSvr string
 }
 
+// AdminClient is an Admin on a zookeeper session that is opened once and reused by all
+// its operations, see NewAdminClient. It is safe for concurrent use, and must be closed
+// when done. The methods of Admin each open and close a client of their own.
+type AdminClient struct {
+	conn *connection
+}
+
+// NewAdminClient connects to zookeeper for the administration tasks
+func NewAdminClient(zkSvr string) (*AdminClient, error) {
+	conn := newConnection(zkSvr)
+	if err := conn.Connect(); err != nil {
+		return nil, err
+	}
+	return &AdminClient{conn}, nil
+}
+
+// Close closes the zookeeper session of the client
+func (adm *AdminClient) Close() {
+	adm.conn.Disconnect()
+}
+
 // AddCluster add a cluster to Helix. As a result, a znode will be created in zookeeper
 // root named after the cluster name, and corresponding data structures are populated
-// under this znode.
-func (adm Admin) AddCluster(cluster string) bool {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
-	if err != nil {
-		return false
-	}
-	defer conn.Disconnect()
+// under this znode. The znodes are created in one transaction, so a failure leaves no
+// partial cluster behind.
+func (adm *AdminClient) AddCluster(cluster string) bool {
+	conn := adm.conn
 
 	kb := KeyBuilder{cluster}
 	// c = "/<cluster>"
@@ -61,282 +128,307 @@ func (adm Admin) AddCluster(cluster string) bool {
 		return false
 	}
 
-	conn.CreateEmptyNode(c)
-
-	// PROPERTYSTORE is an empty node
-	propertyStore := fmt.Sprintf("/%s/PROPERTYSTORE", cluster)
-	conn.CreateEmptyNode(propertyStore)
-
-	// STATEMODELDEFS has 6 children
-	stateModelDefs := fmt.Sprintf("/%s/STATEMODELDEFS", cluster)
-	conn.CreateEmptyNode(stateModelDefs)
-	conn.CreateRecordWithData(stateModelDefs+"/LeaderStandby", HelixDefaultNodes["LeaderStandby"])
-	conn.CreateRecordWithData(stateModelDefs+"/MasterSlave", HelixDefaultNodes["MasterSlave"])
-	conn.CreateRecordWithData(stateModelDefs+"/OnlineOffline", HelixDefaultNodes["OnlineOffline"])
-	conn.CreateRecordWithData(stateModelDefs+"/STORAGE_DEFAULT_SM_SCHEMATA", HelixDefaultNodes["STORAGE_DEFAULT_SM_SCHEMATA"])
-	conn.CreateRecordWithData(stateModelDefs+"/SchedulerTaskQueue", HelixDefaultNodes["SchedulerTaskQueue"])
-	conn.CreateRecordWithData(stateModelDefs+"/Task", HelixDefaultNodes["Task"])
-
-	// INSTANCES is initailly an empty node
-	instances := fmt.Sprintf("/%s/INSTANCES", cluster)
-	conn.CreateEmptyNode(instances)
-
-	// CONFIGS has 3 children: CLUSTER, RESOURCE, PARTICIPANT
-	configs := fmt.Sprintf("/%s/CONFIGS", cluster)
-	conn.CreateEmptyNode(configs)
-	conn.CreateEmptyNode(configs + "/PARTICIPANT")
-	conn.CreateEmptyNode(configs + "/RESOURCE")
-	conn.CreateEmptyNode(configs + "/CLUSTER")
+	return conn.multi(clusterZnodes(cluster), nil) == nil
+}
 
-	clusterNode := NewRecord(cluster)
-	conn.CreateRecordWithPath(configs+"/CLUSTER/"+cluster, clusterNode)
+// SetConfig sets configuration values, defined by the config scope and its scope keys:
+//
+//	CLUSTER                           /<cluster>/CONFIGS/CLUSTER/<cluster>
+//	PARTICIPANT <participant>         /<cluster>/CONFIGS/PARTICIPANT/<participant>
+//	RESOURCE <resource>               /<cluster>/CONFIGS/RESOURCE/<resource>
+//	PARTITION <resource> <partition>  the <partition> map field of the resource config
+//	CONSTRAINT                        /<cluster>/CONFIGS/CONSTRAINT/MESSAGE_CONSTRAINT
+//
+// The resource config is created if it does not exist yet.
+//
+// In the CONSTRAINT scope, each property sets a message constraint by its ID, in the form
+// of ATTRIBUTE=value,...,CONSTRAINT_VALUE=n, for example
+// TRANSITION=OFFLINE-SLAVE,INSTANCE=.*,CONSTRAINT_VALUE=2 limits each instance to two
+// OFFLINE-SLAVE transitions in flight. The attributes are MESSAGE_TYPE, TRANSITION,
+// RESOURCE, PARTITION, INSTANCE and STATE_MODEL. An empty value removes the constraint.
+func (adm *AdminClient) SetConfig(cluster string, scope string, properties map[string]string, scopeKeys ...string) error {
+	return adm.updateConfig(cluster, scope, scopeKeys, func(config *Record, mapKey string) error {
+		if strings.ToUpper(scope) == "CONSTRAINT" {
+			return setConstraints(config, properties)
+		}
 
-	// empty ideal states
-	idealStates := fmt.Sprintf("/%s/IDEALSTATES", cluster)
-	conn.CreateEmptyNode(idealStates)
+		for k, v := range properties {
+			if mapKey == "" {
+				config.SetSimpleField(k, v)
+			} else {
+				config.SetMapField(mapKey, k, v)
+			}
+		}
+		return nil
+	})
+}
 
-	// empty external view
-	externalView := fmt.Sprintf("/%s/EXTERNALVIEW", cluster)
-	conn.CreateEmptyNode(externalView)
+// RemoveConfig removes configuration keys, defined by the config scope and its scope
+// keys, see SetConfig
+func (adm *AdminClient) RemoveConfig(cluster string, scope string, keys []string, scopeKeys ...string) error {
+	return adm.updateConfig(cluster, scope, scopeKeys, func(config *Record, mapKey string) error {
+		for _, k := range keys {
+			switch {
+			case strings.ToUpper(scope) == "CONSTRAINT":
+				config.RemoveMapField(k)
+			case mapKey == "":
+				delete(config.SimpleFields, k)
+			default:
+				delete(config.MapFields[mapKey], k)
+			}
+		}
 
-	// empty live instances
-	liveInstances := fmt.Sprintf("/%s/LIVEINSTANCES", cluster)
-	conn.CreateEmptyNode(liveInstances)
+		if mapKey != "" && len(config.MapFields[mapKey]) == 0 {
+			config.RemoveMapField(mapKey)
+		}
+		return nil
+	})
+}
 
-	// CONTROLLER has four childrens: [ERRORS, HISTORY, MESSAGES, STATUSUPDATES]
-	controller := fmt.Sprintf("/%s/CONTROLLER", cluster)
-	conn.CreateEmptyNode(controller)
-	conn.CreateEmptyNode(controller + "/ERRORS")
-	conn.CreateEmptyNode(controller + "/HISTORY")
-	conn.CreateEmptyNode(controller + "/MESSAGES")
-	conn.CreateEmptyNode(controller + "/STATUSUPDATES")
+// GetConfig obtains configuration values, defined by the config scope and its scope keys,
+// see SetConfig. Keys that are not set are returned as empty strings.
+func (adm *AdminClient) GetConfig(cluster string, scope string, keys []string, scopeKeys ...string) (map[string]string, error) {
+	conn := adm.conn
 
-	return true
-}
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
 
-// SetConfig set the configuration values for the cluster, defined by the config scope
-func (adm Admin) SetConfig(cluster string, scope string, properties map[string]string) error {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+	path, mapKey, err := configPath(conn, cluster, scope, scopeKeys)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer conn.Disconnect()
 
-	switch strings.ToUpper(scope) {
-	case "CLUSTER":
-		if allow, ok := properties["allowParticipantAutoJoin"]; ok {
-			keys := KeyBuilder{cluster}
-			path := keys.clusterConfig()
+	config, err := getConfigRecord(conn, path)
+	if err != nil {
+		return nil, err
+	}
 
-			if strings.ToLower(allow) == "true" {
-				conn.UpdateSimpleField(path, "allowParticipantAutoJoin", "true")
+	result := make(map[string]string)
+	for _, k := range keys {
+		switch {
+		case strings.ToUpper(scope) == "CONSTRAINT":
+			result[k] = ""
+			if attributes, ok := config.MapFields[k]; ok {
+				result[k] = formatConstraint(attributes)
 			}
+		case mapKey == "":
+			result[k], _ = config.GetSimpleField(k).(string)
+		default:
+			result[k] = config.GetMapField(mapKey, k)
 		}
-	case "CONSTRAINT":
-	case "PARTICIPANT":
-	case "PARTITION":
-	case "RESOURCE":
 	}
 
-	return nil
+	return result, nil
 }
 
-// GetConfig obtains the configuration value of a property, defined by a config scope
-func (adm Admin) GetConfig(cluster string, scope string, keys []string) map[string]interface{} {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+// updateConfig reads the config record of the scope, updates it and saves it
+func (adm *AdminClient) updateConfig(cluster string, scope string, scopeKeys []string, update func(config *Record, mapKey string) error) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	path, mapKey, err := configPath(conn, cluster, scope, scopeKeys)
 	if err != nil {
-		return nil
+		return err
 	}
-	defer conn.Disconnect()
 
-	result := make(map[string]interface{})
+	if err := conn.createRecordIfMissing(path, NewRecord(path[strings.LastIndex(path, "/")+1:])); err != nil {
+		return err
+	}
 
-	switch scope {
-	case "CLUSTER":
-		kb := KeyBuilder{cluster}
-		path := kb.clusterConfig()
+	return conn.updateRecord(path, func(config *Record) error {
+		return update(config, mapKey)
+	})
+}
 
-		for _, k := range keys {
-			result[k] = conn.GetSimpleFieldValueByKey(path, k)
+// configPath returns the path of the config record of a scope, and the map field of the
+// record that holds the config of a partition
+func configPath(conn *connection, cluster string, scope string, scopeKeys []string) (string, string, error) {
+	keys := KeyBuilder{cluster}
+
+	switch strings.ToUpper(scope) {
+	case "CLUSTER":
+		if len(scopeKeys) == 0 {
+			return keys.clusterConfig(), "", nil
 		}
 	case "CONSTRAINT":
+		if len(scopeKeys) == 0 {
+			return keys.constraint(messageConstraintType), "", nil
+		}
 	case "PARTICIPANT":
-	case "PARTITION":
-	case "RESOURCE":
+		if len(scopeKeys) == 1 {
+			path := keys.participantConfig(scopeKeys[0])
+			if exists, err := conn.Exists(path); !exists || err != nil {
+				if !exists {
+					return "", "", ErrNodeNotExist
+				}
+				return "", "", err
+			}
+			return path, "", nil
+		}
+	case "RESOURCE", "PARTITION":
+		if len(scopeKeys) == 1 || (len(scopeKeys) == 2 && strings.ToUpper(scope) == "PARTITION") {
+			if exists, err := conn.Exists(keys.idealStateForResource(scopeKeys[0])); !exists || err != nil {
+				if !exists {
+					return "", "", ErrResourceNotExists
+				}
+				return "", "", err
+			}
+
+			mapKey := ""
+			if len(scopeKeys) == 2 {
+				mapKey = scopeKeys[1]
+			}
+			return keys.resourceConfig(scopeKeys[0]), mapKey, nil
+		}
 	}
 
-	return result
+	return "", "", ErrInvalidConfigScope
 }
 
-// DropCluster removes a helix cluster from zookeeper. This will remove the
-// znode named after the cluster name from the zookeeper root.
-func (adm Admin) DropCluster(cluster string) error {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+// getConfigRecord reads a config record, or returns an empty one if it does not exist
+func getConfigRecord(conn *connection, path string) (*Record, error) {
+	exists, err := conn.Exists(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer conn.Disconnect()
 
-	kb := KeyBuilder{cluster}
-	c := kb.cluster()
+	if !exists {
+		return NewRecord(path[strings.LastIndex(path, "/")+1:]), nil
+	}
 
-	return conn.DeleteTree(c)
+	return conn.GetRecordFromPath(path)
 }
 
-// AddNode is the internal implementation corresponding to command
-// ./helix-admin.sh --zkSvr <ZookeeperServerAddress> --addNode <clusterName instanceId>
-// node is in the form of host_port
-func (adm Admin) AddNode(cluster string, node string) error {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
-	if err != nil {
-		return err
-	}
-	defer conn.Disconnect()
+// setConstraints sets the message constraints by ID, an empty spec removes the constraint
+func setConstraints(constraints *Record, properties map[string]string) error {
+	for id, spec := range properties {
+		if spec == "" {
+			constraints.RemoveMapField(id)
+			continue
+		}
 
-	if ok, err := conn.IsClusterSetup(cluster); ok == false || err != nil {
-		return ErrClusterNotSetup
-	}
+		attributes, err := parseConstraint(spec)
+		if err != nil {
+			return err
+		}
 
-	// check if node already exists under /<cluster>/CONFIGS/PARTICIPANT/<NODE>
-	keys := KeyBuilder{cluster}
-	path := keys.participantConfig(node)
-	exists, err := conn.Exists(path)
-	must(err)
-	if exists {
-		return ErrNodeAlreadyExists
+		constraints.RemoveMapField(id)
+		for k, v := range attributes {
+			constraints.SetMapField(id, k, v)
+		}
 	}
 
-	// create new node for the participant
-	parts := strings.Split(node, "_")
-	n := NewRecord(node)
-	n.SetSimpleField("HELIX_HOST", parts[0])
-	n.SetSimpleField("HELIX_PORT", parts[1])
+	return nil
+}
 
-	conn.CreateRecordWithPath(path, n)
-	conn.CreateEmptyNode(keys.instance(node))
-	conn.CreateEmptyNode(keys.messages(node))
-	conn.CreateEmptyNode(keys.currentStates(node))
-	conn.CreateEmptyNode(keys.errorsR(node))
-	conn.CreateEmptyNode(keys.statusUpdates(node))
+// SetResourceConfig sets the configuration values of a resource. The values are saved
+// in /<cluster>/CONFIGS/RESOURCE/<resource>, which is created if it does not exist yet.
+// For example, DELAY_REBALANCE_TIME and MIN_ACTIVE_REPLICAS control the delayed rebalance
+// of the resource.
+func (adm *AdminClient) SetResourceConfig(cluster string, resource string, properties map[string]string) error {
+	return adm.SetConfig(cluster, "RESOURCE", properties, resource)
+}
 
-	return nil
+// GetResourceConfig obtains the configuration values of a resource. Keys that are not
+// set are returned as empty strings.
+func (adm *AdminClient) GetResourceConfig(cluster string, resource string, keys []string) (map[string]string, error) {
+	return adm.GetConfig(cluster, "RESOURCE", keys, resource)
 }
 
-// DropNode removes a node from a cluster. The corresponding znodes
-// in zookeeper will be removed.
-func (adm Admin) DropNode(cluster string, node string) error {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+// SetClusterTopology makes the cluster topology aware. topology is the path of the domain
+// types from the root down to the instance, for example /zone/rack/host. faultZoneType
+// is one of the domain types, the rebalancer never places two replicas of a partition in
+// the same fault zone. If faultZoneType is empty, each instance is its own fault zone.
+func (adm *AdminClient) SetClusterTopology(cluster string, topology string, faultZoneType string) error {
+	types, err := parseTopology(topology)
 	if err != nil {
 		return err
 	}
-	defer conn.Disconnect()
 
-	// check if node already exists under /<cluster>/CONFIGS/PARTICIPANT/<node>
-	keys := KeyBuilder{cluster}
-	if exists, err := conn.Exists(keys.participantConfig(node)); !exists || err != nil {
-		return ErrNodeNotExist
+	if faultZoneType == "" {
+		faultZoneType = types[len(types)-1]
+	} else if !contains(types, faultZoneType) {
+		return ErrInvalidFaultZoneType
 	}
 
-	// check if node exist under instance: /<cluster>/INSTANCES/<node>
-	if exists, err := conn.Exists(keys.instance(node)); !exists || err != nil {
-		return ErrInstanceNotExist
-	}
+	conn := adm.conn
 
-	// delete /<cluster>/CONFIGS/PARTICIPANT/<node>
-	conn.DeleteTree(keys.participantConfig(node))
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
 
-	// delete /<cluster>/INSTANCES/<node>
-	conn.DeleteTree(keys.instance(node))
+	keys := KeyBuilder{cluster}
+	path := keys.clusterConfig()
 
-	return nil
+	return conn.updateRecord(path, func(config *Record) error {
+		config.SetSimpleField(topologyKey, "/"+strings.Join(types, "/"))
+		config.SetSimpleField(faultZoneTypeKey, faultZoneType)
+		config.SetBooleanField(topologyAwareEnabledKey, true)
+		return nil
+	})
 }
 
-// AddResource implements the helix-admin.sh --addResource
-// # helix-admin.sh --zkSvr <zk_address> --addResource <clustername> <resourceName> <numPartitions> <StateModelName>
-// ./helix-admin.sh --zkSvr localhost:2199 --addResource MYCLUSTER myDB 6 MasterSlave
-func (adm Admin) AddResource(cluster string, resource string, partitions int, stateModel string) error {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+// SetInstanceDomain sets the domain of an instance, for example
+// zone=us-east-1a,rack=r12,host=h1. The domain must have a value for each of the
+// domain types in the cluster topology.
+func (adm *AdminClient) SetInstanceDomain(cluster string, instance string, domain string) error {
+	d, err := parseDomain(domain)
 	if err != nil {
 		return err
 	}
-	defer conn.Disconnect()
 
+	conn := adm.conn
+
+	// make sure the cluster is already setup
 	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
 		return ErrClusterNotSetup
 	}
 
 	keys := KeyBuilder{cluster}
+	path := keys.participantConfig(instance)
 
-	// make sure the state model def exists
-	if exists, err := conn.Exists(keys.stateModel(stateModel)); !exists || err != nil {
-		return ErrStateModelDefNotExist
-	}
-
-	// make sure the path for the ideal state does not exit
-	isPath := keys.idealStates() + "/" + resource
-	if exists, err := conn.Exists(isPath); exists || err != nil {
-		if exists {
-			return ErrResourceExists
+	if exists, err := conn.Exists(path); !exists || err != nil {
+		if !exists {
+			return ErrNodeNotExist
 		}
 		return err
 	}
 
-	// create the idealstate for the resource
-	// is := NewIdealState(resource)
-	// is.SetNumPartitions(partitions)
-	// is.SetReplicas(0)
-	// is.SetRebalanceMode("SEMI_AUTO")
-	// is.SetStateModelDefRef(stateModel)
-	// // save the ideal state in zookeeper
-	// is.Save(conn, cluster)
-
-	is := NewRecord(resource)
-	is.SetSimpleField("NUM_PARTITIONS", strconv.Itoa(partitions))
-	is.SetSimpleField("REPLICAS", strconv.Itoa(0))
-	is.SetSimpleField("REBALANCE_MODE", strings.ToUpper("SEMI_AUTO"))
-	is.SetSimpleField("STATE_MODEL_DEF_REF", stateModel)
-	conn.CreateRecordWithPath(isPath, is)
-
-	return nil
-}
+	topology := conn.GetSimpleFieldValueByKey(keys.clusterConfig(), topologyKey)
+	if topology == "" {
+		return ErrTopologyNotSet
+	}
 
-// DropResource removes the specified resource from the cluster.
-func (adm Admin) DropResource(cluster string, resource string) error {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+	types, err := parseTopology(topology)
 	if err != nil {
 		return err
 	}
-	defer conn.Disconnect()
 
-	// make sure the cluster is already setup
-	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
-		return ErrClusterNotSetup
+	if err := validateDomain(types, d); err != nil {
+		return err
 	}
 
-	keys := KeyBuilder{cluster}
-
-	// make sure the path for the ideal state does not exit
-	conn.DeleteTree(keys.idealStates() + "/" + resource)
-	conn.DeleteTree(keys.resourceConfig(resource))
+	// save the domain in the order of the topology
+	pairs := []string{}
+	for _, t := range types {
+		pairs = append(pairs, t+"="+d[t])
+	}
 
-	return nil
+	return conn.UpdateSimpleField(path, domainKey, strings.Join(pairs, ","))
 }
 
-// EnableResource enables the specified resource in the cluster
-func (adm Admin) EnableResource(cluster string, resource string) error {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
-	if err != nil {
-		return err
-	}
-	defer conn.Disconnect()
+// SetInstanceCapacity sets the capacity of an instance for the weight aware rebalancer,
+// for example {"CPU": 100, "DISK": 1000}. The capacity is saved in the
+// INSTANCE_CAPACITY_MAP map field of the participant config.
+func (adm *AdminClient) SetInstanceCapacity(cluster string, instance string, capacity map[string]int) error {
+	conn := adm.conn
 
 	// make sure the cluster is already setup
 	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
@@ -344,29 +436,35 @@ func (adm Admin) EnableResource(cluster string, resource string) error {
 	}
 
 	keys := KeyBuilder{cluster}
+	path := keys.participantConfig(instance)
 
-	isPath := keys.idealStates() + "/" + resource
-
-	if exists, err := conn.Exists(isPath); !exists || err != nil {
+	if exists, err := conn.Exists(path); !exists || err != nil {
 		if !exists {
-			return ErrResourceNotExists
+			return ErrNodeNotExist
 		}
 		return err
 	}
 
-	// TODO: set the value at leaf node instead of the record level
-	conn.UpdateSimpleField(isPath, "HELIX_ENABLED", "true")
-	return nil
+	return conn.updateRecord(path, func(config *Record) error {
+		config.RemoveMapField(instanceCapacityMapKey)
+		for k, v := range capacity {
+			config.SetMapField(instanceCapacityMapKey, k, strconv.Itoa(v))
+		}
+		return nil
+	})
 }
 
-// DisableResource disables the specified resource in the cluster.
-func (adm Admin) DisableResource(cluster string, resource string) error {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+// SetPartitionWeight sets the weight of a partition for the weight aware rebalancer,
+// for example {"CPU": 2, "DISK": 50}. Use DEFAULT as the partition to set the weight of
+// all the partitions of the resource. The weight is saved in the PARTITION_CAPACITY_MAP
+// map field of the resource config.
+func (adm *AdminClient) SetPartitionWeight(cluster string, resource string, partition string, weight map[string]int) error {
+	data, err := json.Marshal(weight)
 	if err != nil {
 		return err
 	}
-	defer conn.Disconnect()
+
+	conn := adm.conn
 
 	// make sure the cluster is already setup
 	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
@@ -375,235 +473,1373 @@ func (adm Admin) DisableResource(cluster string, resource string) error {
 
 	keys := KeyBuilder{cluster}
 
-	isPath := keys.idealStates() + "/" + resource
-
-	if exists, err := conn.Exists(isPath); !exists || err != nil {
+	if exists, err := conn.Exists(keys.idealStateForResource(resource)); !exists || err != nil {
 		if !exists {
 			return ErrResourceNotExists
 		}
-
 		return err
 	}
 
-	conn.UpdateSimpleField(isPath, "HELIX_ENABLED", "false")
+	path := keys.resourceConfig(resource)
+	if err := conn.createRecordIfMissing(path, NewRecord(resource)); err != nil {
+		return err
+	}
 
-	return nil
+	return conn.updateRecord(path, func(config *Record) error {
+		config.SetMapField(partitionCapacityMapKey, partition, string(data))
+		return nil
+	})
 }
 
-// Rebalance not implemented yet
-func (adm Admin) Rebalance(cluster string, resource string, replicationFactor int) {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
-	if err != nil {
-		fmt.Println("Failed to connect to zookeeper.")
-		return
-	}
-	defer conn.Disconnect()
+// DropCluster removes a helix cluster from zookeeper. This will remove the
+// znode named after the cluster name from the zookeeper root. A small cluster is removed
+// in one transaction. A cluster whose tree does not fit in a zookeeper request, or that
+// participants write to meanwhile, is removed znode by znode, which is not atomic: a
+// failure then leaves part of the cluster behind, and is returned as a
+// *PartialDeleteError that lists it. Calling DropCluster again removes the rest.
+func (adm *AdminClient) DropCluster(cluster string) error {
+	conn := adm.conn
 
-	fmt.Println("Not implemented")
+	kb := KeyBuilder{cluster}
+	return conn.deleteTree(kb.cluster())
 }
 
-// ListClusterInfo shows the existing resources and instances in the glaster
-func (adm Admin) ListClusterInfo(cluster string) (string, error) {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
-	if err != nil {
-		return "", err
-	}
-	defer conn.Disconnect()
-
-	// make sure the cluster is already setup
-	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
-		return "", ErrClusterNotSetup
-	}
+// RepairCluster completes or removes the partial structures a failed operation left in
+// the cluster: the missing znodes of the cluster and of the instances that have a config
+// are created, and the instance trees without a config are removed, unless the instance
+// is live. It all happens in one transaction, or not at all with dryRun.
+func (adm *AdminClient) RepairCluster(cluster string, dryRun bool) (*RepairReport, error) {
+	conn := adm.conn
 
 	keys := KeyBuilder{cluster}
-	isPath := keys.idealStates()
-	instancesPath := keys.instances()
-
-	resources, err := conn.Children(isPath)
-	if err != nil {
-		return "", err
+	if exists, err := conn.Exists(keys.cluster()); !exists || err != nil {
+		return nil, ErrClusterNotSetup
 	}
 
-	instances, err := conn.Children(instancesPath)
+	creates, err := conn.missingZnodes(clusterZnodes(cluster))
 	if err != nil {
-		return "", err
-	}
-
-	var buffer bytes.Buffer
-	buffer.WriteString("Existing resources in cluster " + cluster + ":\n")
-
-	for _, r := range resources {
-		buffer.WriteString("  " + r + "\n")
+		return nil, err
 	}
 
-	buffer.WriteString("\nInstances in cluster " + cluster + ":\n")
-	for _, i := range instances {
-		buffer.WriteString("  " + i + "\n")
-	}
-	return buffer.String(), nil
-}
-
-// ListClusters shows all Helix managed clusters in the connected zookeeper cluster
-func (adm Admin) ListClusters() (string, error) {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+	configs, err := conn.childrenIfExists(keys.participantConfigs())
 	if err != nil {
-		fmt.Println("Failed to connect to zookeeper.")
-		return "", err
+		return nil, err
+	}
+	configured := make(map[string]bool)
+	for _, instance := range configs {
+		configured[instance] = true
+		missing, err := conn.missingZnodes(instanceZnodes(cluster, NewRecord(instance))[1:])
+		if err != nil {
+			return nil, err
+		}
+		creates = append(creates, missing...)
 	}
-	defer conn.Disconnect()
-
-	var clusters []string
 
-	children, err := conn.Children("/")
+	deletes := []string{}
+	instances, err := conn.childrenIfExists(keys.instances())
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	for _, instance := range instances {
+		if configured[instance] {
+			continue
+		}
+		if live, _, err := conn.zkConn.Exists(keys.liveInstance(instance)); live || err != nil {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
 
-	for _, cluster := range children {
-		if ok, err := conn.IsClusterSetup(cluster); ok && err == nil {
-			clusters = append(clusters, cluster)
+		tree, err := conn.treePaths(keys.instance(instance))
+		if err != nil {
+			return nil, err
 		}
+		deletes = append(deletes, tree...)
 	}
 
-	var buffer bytes.Buffer
-	buffer.WriteString("Existing clusters: \n")
+	report := &RepairReport{Created: []string{}, Removed: deletes}
+	for _, n := range creates {
+		report.Created = append(report.Created, n.path)
+	}
 
-	for _, cluster := range clusters {
-		buffer.WriteString("  " + cluster + "\n")
+	if dryRun {
+		return report, nil
 	}
-	return buffer.String(), nil
+	if err := conn.multi(creates, deletes); err != nil {
+		return nil, err
+	}
+	return report, nil
 }
 
-// ListResources shows a list of resources managed by the helix cluster
-func (adm Admin) ListResources(cluster string) (string, error) {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
-	if err != nil {
-		return "", err
-	}
-	defer conn.Disconnect()
+// VerifyCluster checks the znode layout of the cluster beyond what IsClusterSetup does:
+// the missing znodes of the cluster and of its instances, the ideal states of unknown
+// state models or assigned to instances without config, the instance trees without
+// config, the current states of dead sessions, and the messages to dead sessions or to
+// nonexistent instances. With fix, the fixable findings are fixed in order, the most
+// severe first.
+func (adm *AdminClient) VerifyCluster(cluster string, fix bool) (*VerifyReport, error) {
+	conn := adm.conn
 
-	// make sure the cluster is already setup
-	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
-		return "", ErrClusterNotSetup
+	keys := KeyBuilder{cluster}
+	if exists, err := conn.Exists(keys.cluster()); !exists || err != nil {
+		return nil, ErrClusterNotSetup
 	}
 
-	keys := KeyBuilder{cluster}
-	isPath := keys.idealStates()
-	resources, err := conn.Children(isPath)
+	tree, err := readClusterTree(conn, cluster)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var buffer bytes.Buffer
-	buffer.WriteString("Existing resources in cluster " + cluster + ":\n")
-
-	for _, r := range resources {
-		buffer.WriteString("  " + r + "\n")
+	report := &VerifyReport{Cluster: cluster, Findings: tree.verify()}
+	if !fix {
+		return report, nil
 	}
 
-	return buffer.String(), nil
+	for _, f := range report.Findings {
+		if !f.Fixable {
+			continue
+		}
+		if err := f.fix(conn); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
 }
 
-// ListInstances shows a list of instances participating the cluster.
-func (adm Admin) ListInstances(cluster string) (string, error) {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
-	if err != nil {
-		return "", err
-	}
-	defer conn.Disconnect()
+// AddNode is the internal implementation corresponding to command
+// ./helix-admin.sh --zkSvr <ZookeeperServerAddress> --addNode <clusterName instanceId>
+// node is in the form of host_port
+func (adm *AdminClient) AddNode(cluster string, node string) error {
+	conn := adm.conn
 
-	// make sure the cluster is already setup
-	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
-		return "", ErrClusterNotSetup
+	if ok, err := conn.IsClusterSetup(cluster); ok == false || err != nil {
+		return ErrClusterNotSetup
 	}
 
+	// check if node already exists under /<cluster>/CONFIGS/PARTICIPANT/<NODE>
 	keys := KeyBuilder{cluster}
-	isPath := keys.instances()
-	instances, err := conn.Children(isPath)
-	if err != nil {
-		return "", err
+	path := keys.participantConfig(node)
+	exists, err := conn.Exists(path)
+	must(err)
+	if exists {
+		return ErrNodeAlreadyExists
 	}
 
-	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("Existing instances in cluster %s:\n", cluster))
+	// create new node for the participant
+	parts := strings.Split(node, "_")
+	n := NewRecord(node)
+	n.SetSimpleField("HELIX_HOST", parts[0])
+	n.SetSimpleField("HELIX_PORT", parts[1])
 
-	for _, r := range instances {
-		buffer.WriteString("  " + r + "\n")
+	// the config and the instance tree are created at once
+	if err := conn.multi(instanceZnodes(cluster, n), nil); err != nil {
+		if err == zk.ErrNodeExists {
+			return ErrNodeAlreadyExists
+		}
+		return err
 	}
 
-	return buffer.String(), nil
+	return nil
+}
+
+// DropNode removes a node from a cluster. The corresponding znodes
+// in zookeeper will be removed. A node that is live or still named in the preference lists
+// or the map fields of the ideal states is not removed, see EvacuateInstance,
+// SwapInstance and DropNodeForce.
+func (adm *AdminClient) DropNode(cluster string, node string) error {
+	return adm.dropNode(cluster, node, false)
+}
+
+// DropNodeForce removes a node from a cluster even if it is live or still assigned
+// partitions, see DropNode
+func (adm *AdminClient) DropNodeForce(cluster string, node string) error {
+	return adm.dropNode(cluster, node, true)
+}
+
+// dropNode removes a node from a cluster, checking first that it is down and unassigned
+// unless forced
+func (adm *AdminClient) dropNode(cluster string, node string, force bool) error {
+	conn := adm.conn
+
+	// check if node already exists under /<cluster>/CONFIGS/PARTICIPANT/<node>
+	keys := KeyBuilder{cluster}
+	if exists, err := conn.Exists(keys.participantConfig(node)); !exists || err != nil {
+		return ErrNodeNotExist
+	}
+
+	// check if node exist under instance: /<cluster>/INSTANCES/<node>
+	if exists, err := conn.Exists(keys.instance(node)); !exists || err != nil {
+		return ErrInstanceNotExist
+	}
+
+	if !force {
+		if live, err := conn.Exists(keys.liveInstance(node)); live || err != nil {
+			if live {
+				return ErrInstanceLive
+			}
+			return err
+		}
+
+		idealStates := make(map[string]*Record)
+		if err := readRecords(conn, keys.idealStates(), idealStates); err != nil {
+			return err
+		}
+		for _, is := range idealStates {
+			if isAssigned(is, node) {
+				return ErrInstanceInUse
+			}
+		}
+	}
+
+	// delete /<cluster>/CONFIGS/PARTICIPANT/<node> and /<cluster>/INSTANCES/<node> at once
+	paths := []string{}
+	for _, p := range []string{keys.participantConfig(node), keys.instance(node)} {
+		tree, err := conn.treePaths(p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, tree...)
+	}
+
+	return conn.multi(nil, paths)
+}
+
+// AddResource implements the helix-admin.sh --addResource
+// # helix-admin.sh --zkSvr <zk_address> --addResource <clustername> <resourceName> <numPartitions> <StateModelName>
+// ./helix-admin.sh --zkSvr localhost:2199 --addResource MYCLUSTER myDB 6 MasterSlave
+func (adm *AdminClient) AddResource(cluster string, resource string, partitions int, stateModel string) error {
+	conn := adm.conn
+
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+
+	// make sure the state model def exists
+	if exists, err := conn.Exists(keys.stateModel(stateModel)); !exists || err != nil {
+		return ErrStateModelDefNotExist
+	}
+
+	// make sure the path for the ideal state does not exit
+	isPath := keys.idealStates() + "/" + resource
+	if exists, err := conn.Exists(isPath); exists || err != nil {
+		if exists {
+			return ErrResourceExists
+		}
+		return err
+	}
+
+	// create the idealstate for the resource
+	// is := NewIdealState(resource)
+	// is.SetNumPartitions(partitions)
+	// is.SetReplicas(0)
+	// is.SetRebalanceMode("SEMI_AUTO")
+	// is.SetStateModelDefRef(stateModel)
+	// // save the ideal state in zookeeper
+	// is.Save(conn, cluster)
+
+	is := NewRecord(resource)
+	is.SetSimpleField("NUM_PARTITIONS", strconv.Itoa(partitions))
+	is.SetSimpleField("REPLICAS", strconv.Itoa(0))
+	is.SetSimpleField("REBALANCE_MODE", strings.ToUpper("SEMI_AUTO"))
+	is.SetSimpleField("STATE_MODEL_DEF_REF", stateModel)
+
+	data, err := is.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := conn.multi([]znode{{isPath, data}}, nil); err != nil {
+		if err == zk.ErrNodeExists {
+			return ErrResourceExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// DropResource removes the specified resource from the cluster.
+func (adm *AdminClient) DropResource(cluster string, resource string) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+
+	// delete the ideal state and the config of the resource at once
+	paths := []string{}
+	for _, p := range []string{keys.idealStateForResource(resource), keys.resourceConfig(resource)} {
+		tree, err := conn.treePaths(p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, tree...)
+	}
+
+	return conn.multi(nil, paths)
+}
+
+// DropResourceAndWait removes a resource without cutting its replicas off: the resource
+// is disabled first, so the controller brings its replicas back to the initial state, and
+// its ideal state is removed once they are all there, so the controller drops them. It
+// returns when the external view of the resource is gone, or ErrTimeout. A resource that
+// times out before its ideal state is removed is left disabled. A resource that is
+// dropped by someone else meanwhile is waited for the same way.
+func (adm *AdminClient) DropResourceAndWait(cluster string, resource string, timeout time.Duration) error {
+	if err := adm.DisableResource(cluster, resource); err != nil {
+		return err
+	}
+
+	conn := adm.conn
+
+	keys := KeyBuilder{cluster}
+	evPath := keys.externalViewForResource(resource)
+	deadline := time.Now().Add(timeout)
+
+	// wait for the replicas to reach the initial state
+	for {
+		offline, err := isResourceOffline(conn, keys, resource)
+		if err != nil {
+			return err
+		}
+		if offline {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(time.Second)
+	}
+
+	if err := adm.DropResource(cluster, resource); err != nil && err != ErrResourceNotExists {
+		return err
+	}
+
+	// and for the controller to drop them
+	for {
+		exists, _, err := conn.zkConn.Exists(evPath)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// isResourceOffline tests if all the replicas in the external view of a disabled resource
+// are in the initial state of its state model
+func isResourceOffline(conn *connection, keys KeyBuilder, resource string) (bool, error) {
+	data, _, err := conn.zkConn.Get(keys.externalViewForResource(resource))
+	if err == zk.ErrNoNode {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ev, err := NewRecordFromBytes(data)
+	if err != nil {
+		return false, err
+	}
+
+	// the ideal state is gone if the resource was dropped meanwhile, and then the
+	// controller drops its replicas
+	is, err := readRecordIfExists(conn, keys.idealStateForResource(resource))
+	if err != nil {
+		return false, err
+	}
+	if is == nil {
+		return true, nil
+	}
+
+	stateModel, _ := is.GetSimpleField("STATE_MODEL_DEF_REF").(string)
+	def, err := readRecordIfExists(conn, keys.stateModel(stateModel))
+	if err != nil {
+		return false, err
+	}
+	if def == nil {
+		return false, ErrStateModelDefNotExist
+	}
+
+	initial := initialState(def)
+	for _, states := range ev.MapFields {
+		for _, state := range states {
+			if state != initial && state != errorState {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// AddStateModelDef adds a custom state model definition to the cluster, see
+// StateModelDefinition. The definition is validated first, and a *StateModelDefError
+// is returned if it is not valid.
+func (adm *AdminClient) AddStateModelDef(cluster string, def *StateModelDefinition) error {
+	record, err := def.Record()
+	if err != nil {
+		return err
+	}
+
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	path := keys.stateModel(def.Name)
+
+	if exists, err := conn.Exists(path); exists || err != nil {
+		if exists {
+			return ErrStateModelDefExists
+		}
+		return err
+	}
+
+	return conn.SetRecordForPath(path, record)
+}
+
+// ListStateModelDefs returns the names of the state model definitions of the cluster
+func (adm *AdminClient) ListStateModelDefs(cluster string) ([]string, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	names, err := conn.Children(keys.stateModels())
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetStateModelDef reads a state model definition of the cluster
+func (adm *AdminClient) GetStateModelDef(cluster string, name string) (*StateModelDefinition, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	path := keys.stateModel(name)
+
+	if exists, err := conn.Exists(path); !exists || err != nil {
+		if !exists {
+			return nil, ErrStateModelDefNotExist
+		}
+		return nil, err
+	}
+
+	record, err := conn.GetRecordFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewStateModelDefinitionFromRecord(record), nil
+}
+
+// ActivateCluster lets the distributed controllers of the super cluster manage the
+// cluster, or stop managing it when enable is false. The cluster is the only partition
+// of a resource of the same name in the super cluster, replicated on all the live
+// controllers with the LeaderStandby state model.
+func (adm *AdminClient) ActivateCluster(cluster string, superCluster string, enable bool) error {
+	conn := adm.conn
+
+	// make sure both clusters are already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	if ok, err := conn.IsClusterSetup(superCluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{superCluster}
+	isPath := keys.idealStateForResource(cluster)
+
+	if !enable {
+		return conn.DeleteTree(isPath)
+	}
+
+	if exists, err := conn.Exists(isPath); exists || err != nil {
+		if exists {
+			return ErrResourceExists
+		}
+		return err
+	}
+
+	is := NewRecord(cluster)
+	is.SetSimpleField("REPLICAS", "ANY_LIVEINSTANCE")
+	is.SetSimpleField("REBALANCE_MODE", "FULL_AUTO")
+	is.SetSimpleField("STATE_MODEL_DEF_REF", superClusterStateModel)
+	is.SetListField(cluster, []string{})
+	conn.CreateRecordWithPath(isPath, is)
+
+	return nil
+}
+
+// EnableInstance lets the controller assign replicas to the instance again
+func (adm *AdminClient) EnableInstance(cluster string, instance string) error {
+	return adm.updateInstanceConfig(cluster, instance, "", func(config *Record) {
+		config.SetBooleanField("HELIX_ENABLED", true)
+		delete(config.SimpleFields, disabledReasonKey)
+	})
+}
+
+// DisableInstance takes the instance out of service: the controller brings its replicas
+// back to the initial state and assigns them to other instances
+func (adm *AdminClient) DisableInstance(cluster string, instance string) error {
+	return adm.updateInstanceConfig(cluster, instance, "", func(config *Record) {
+		config.SetBooleanField("HELIX_ENABLED", false)
+		config.SetSimpleField(disabledTimestampKey, strconv.FormatInt(time.Now().UnixNano()/1000000, 10))
+	})
+}
+
+// EnablePartitions enables partitions of a resource on the instance again
+func (adm *AdminClient) EnablePartitions(cluster string, instance string, resource string, partitions []string) error {
+	return adm.updateInstanceConfig(cluster, instance, resource, func(config *Record) {
+		setPartitionsDisabled(config, resource, partitions, false)
+	})
+}
+
+// DisablePartitions takes partitions of a resource out of service on the instance, for
+// example the ones on a bad disk. The replicas of the partitions on the instance are
+// brought back to the initial state, the other partitions are not affected. The disabled
+// partitions are saved in the HELIX_DISABLED_PARTITION map field of the instance config.
+func (adm *AdminClient) DisablePartitions(cluster string, instance string, resource string, partitions []string) error {
+	return adm.updateInstanceConfig(cluster, instance, resource, func(config *Record) {
+		setPartitionsDisabled(config, resource, partitions, true)
+	})
+}
+
+// AddInstanceTag tags the instance, for example with the kind of its storage. The tags
+// are saved in the TAG_LIST list field of the instance config, see
+// SetResourceInstanceGroupTag.
+func (adm *AdminClient) AddInstanceTag(cluster string, instance string, tag string) error {
+	return adm.updateInstanceConfig(cluster, instance, "", func(config *Record) {
+		setInstanceTag(config, tag, true)
+	})
+}
+
+// RemoveInstanceTag removes a tag from the instance
+func (adm *AdminClient) RemoveInstanceTag(cluster string, instance string, tag string) error {
+	return adm.updateInstanceConfig(cluster, instance, "", func(config *Record) {
+		setInstanceTag(config, tag, false)
+	})
+}
+
+// EvacuateInstance moves all the replicas of the instance elsewhere before it is
+// decommissioned. The instance is marked with the EVACUATE INSTANCE_OPERATION in its
+// config, so the rebalancer no longer assigns it replicas, and the preference lists of
+// the SEMI_AUTO resources are recomputed without it. The replicas on the instance are
+// kept until their replacements are up. Replicas of CUSTOMIZED resources are not moved.
+//
+// Use GetEvacuationProgress to follow the evacuation, and RemoveConfig of the
+// INSTANCE_OPERATION to cancel it.
+func (adm *AdminClient) EvacuateInstance(cluster string, instance string) error {
+	err := adm.updateInstanceConfig(cluster, instance, "", func(config *Record) {
+		config.SetSimpleField(instanceOperationKey, evacuateOperation)
+	})
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := readClusterSnapshot(adm.conn, cluster)
+	if err != nil {
+		return err
+	}
+
+	keys := KeyBuilder{cluster}
+	for resource, is := range snapshot.IdealStates {
+		if mode, _ := is.GetSimpleField("REBALANCE_MODE").(string); strings.ToUpper(mode) != "SEMI_AUTO" {
+			continue
+		}
+
+		held := false
+		longest := 0
+		for p := range is.ListFields {
+			list := is.GetListField(p)
+			held = held || contains(list, instance)
+			if len(list) > longest {
+				longest = len(list)
+			}
+		}
+		if !held {
+			continue
+		}
+
+		replicas := getReplicas(is, snapshot)
+		if replicas <= 0 {
+			replicas = longest
+		}
+
+		if err := snapshot.rebalanceIdealState(resource, replicas); err != nil {
+			return err
+		}
+		if err := adm.conn.SetRecordForPath(keys.idealStateForResource(resource), snapshot.IdealStates[resource]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetEvacuationProgress reports the progress of the evacuation of an instance, see
+// EvacuateInstance. It compares the current states of the instance with the external
+// views: the instance is not done while it holds replicas, or while it is the only
+// active holder of a partition.
+func (adm *AdminClient) GetEvacuationProgress(cluster string, instance string) (*EvacuationProgress, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	if exists, err := conn.Exists(keys.participantConfig(instance)); !exists || err != nil {
+		if !exists {
+			return nil, ErrNodeNotExist
+		}
+		return nil, err
+	}
+
+	snapshot, err := readClusterSnapshot(conn, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	// the controller removes the external views of the resources that are dropped
+	// meanwhile
+	externalViews := make(map[string]*Record)
+	if err := readRecords(conn, keys.externalView(), externalViews); err != nil {
+		return nil, err
+	}
+
+	return computeEvacuationProgress(snapshot, externalViews, instance), nil
+}
+
+// SwapInstance replaces a dead instance with a new one: the old instance is replaced by
+// the new one in the preference lists and the map fields of all the ideal states. The old
+// instance must not be live and the new one must be configured. The ideal states are
+// updated in a single zookeeper transaction, which fails if any of them was changed
+// meanwhile. The configs of the instances, like their tags, are left unchanged.
+//
+// It returns the resources that are or, with dryRun, would be changed.
+func (adm *AdminClient) SwapInstance(cluster string, oldInstance string, newInstance string, dryRun bool) ([]string, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+
+	if live, err := conn.Exists(keys.liveInstance(oldInstance)); live || err != nil {
+		if live {
+			return nil, ErrInstanceLive
+		}
+		return nil, err
+	}
+
+	if exists, err := conn.Exists(keys.participantConfig(newInstance)); !exists || err != nil {
+		if !exists {
+			return nil, ErrNodeNotExist
+		}
+		return nil, err
+	}
+
+	resources, err := conn.Children(keys.idealStates())
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(resources)
+
+	swapped := []string{}
+	ops := []interface{}{}
+	for _, resource := range resources {
+		path := keys.idealStateForResource(resource)
+		data, stat, err := conn.zkConn.Get(path)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		is, err := NewRecordFromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+
+		changed, err := swapInstance(is, oldInstance, newInstance)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+
+		if data, err = is.Marshal(); err != nil {
+			return nil, err
+		}
+		swapped = append(swapped, resource)
+		ops = append(ops, &zk.SetDataRequest{Path: path, Data: data, Version: stat.Version})
+	}
+
+	if dryRun || len(ops) == 0 {
+		return swapped, nil
+	}
+
+	if _, err := conn.zkConn.Multi(ops...); err != nil {
+		return nil, err
+	}
+	return swapped, nil
+}
+
+// updateInstanceConfig reads the config of an instance, updates it and saves it. The
+// resource, if not empty, must exist.
+func (adm *AdminClient) updateInstanceConfig(cluster string, instance string, resource string, update func(config *Record)) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	path := keys.participantConfig(instance)
+
+	if exists, err := conn.Exists(path); !exists || err != nil {
+		if !exists {
+			return ErrNodeNotExist
+		}
+		return err
+	}
+
+	if resource != "" {
+		if exists, err := conn.Exists(keys.idealStateForResource(resource)); !exists || err != nil {
+			if !exists {
+				return ErrResourceNotExists
+			}
+			return err
+		}
+	}
+
+	return conn.updateRecord(path, func(config *Record) error {
+		update(config)
+		return nil
+	})
+}
+
+// EnableResource enables the specified resource in the cluster
+func (adm *AdminClient) EnableResource(cluster string, resource string) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+
+	isPath := keys.idealStates() + "/" + resource
+
+	if exists, err := conn.Exists(isPath); !exists || err != nil {
+		if !exists {
+			return ErrResourceNotExists
+		}
+		return err
+	}
+
+	// TODO: set the value at leaf node instead of the record level
+	return conn.UpdateSimpleField(isPath, "HELIX_ENABLED", "true")
+}
+
+// DisableResource disables the specified resource in the cluster.
+func (adm *AdminClient) DisableResource(cluster string, resource string) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+
+	isPath := keys.idealStates() + "/" + resource
+
+	if exists, err := conn.Exists(isPath); !exists || err != nil {
+		if !exists {
+			return ErrResourceNotExists
+		}
+
+		return err
+	}
+
+	return conn.UpdateSimpleField(isPath, "HELIX_ENABLED", "false")
+}
+
+// SetResourceInstanceGroupTag restricts the replicas of the resource to the instances
+// with the tag, see AddInstanceTag. This lets one cluster host separate pools of
+// instances, such as SSD and HDD nodes. The tag is saved as the INSTANCE_GROUP_TAG of the
+// ideal state, an empty tag lifts the restriction. For the SEMI_AUTO mode, Rebalance
+// must be run again to recompute the preference lists.
+func (adm *AdminClient) SetResourceInstanceGroupTag(cluster string, resource string, tag string) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	isPath := keys.idealStateForResource(resource)
+
+	if exists, err := conn.Exists(isPath); !exists || err != nil {
+		if !exists {
+			return ErrResourceNotExists
+		}
+		return err
+	}
+
+	return conn.updateRecord(isPath, func(is *Record) error {
+		if tag == "" {
+			delete(is.SimpleFields, instanceGroupTagKey)
+		} else {
+			is.SetSimpleField(instanceGroupTagKey, tag)
+		}
+		return nil
+	})
 }
 
-// ListInstanceInfo shows detailed information of an inspace in the helix cluster
-func (adm Admin) ListInstanceInfo(cluster string, instance string) (string, error) {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+// Rebalance implements the helix-admin.sh --rebalance. It assigns the partitions of a
+// resource to the enabled live instances with the given replication factor, and saves
+// the preference lists in the ideal state. Current assignments are kept when possible.
+// A resource with an INSTANCE_GROUP_TAG is only assigned to the instances with the tag,
+// see SetResourceInstanceGroupTag.
+//
+// In a topology aware cluster (see SetClusterTopology), no two replicas of a partition
+// are placed in the same fault zone, and instances without a valid domain are not
+// assigned any replicas.
+//
+// Resources with the REBALANCER_CLASS_NAME of the Java WagedRebalancer are placed by
+// their weights instead of their partition counts. The weighted usage of the instances
+// is balanced and never exceeds the instance capacity, see SetInstanceCapacity and
+// SetPartitionWeight. A *PlacementError is returned if the partitions do not fit, and
+// the ideal state is left unchanged.
+//
+// When delayed rebalance is enabled (DELAY_REBALANCE_TIME in the cluster or resource
+// config), an instance that went offline keeps its replicas until the delay has passed,
+// so a quick restart does not move partitions around. Meanwhile, live instances are
+// added to the partitions that have fewer live replicas than MIN_ACTIVE_REPLICAS.
+func (adm *AdminClient) Rebalance(cluster string, resource string, replicationFactor int) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	if replicationFactor <= 0 {
+		return ErrInvalidReplicas
+	}
+
+	keys := KeyBuilder{cluster}
+	isPath := keys.idealStateForResource(resource)
+
+	if exists, err := conn.Exists(isPath); !exists || err != nil {
+		if !exists {
+			return ErrResourceNotExists
+		}
+		return err
+	}
+
+	snapshot, err := readClusterSnapshot(conn, cluster)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	// start the delay window of the instances that went offline unnoticed
+	if err := snapshot.stampOfflineTimes(conn); err != nil {
+		return err
 	}
-	defer conn.Disconnect()
+
+	if err := snapshot.rebalanceIdealState(resource, replicationFactor); err != nil {
+		return err
+	}
+
+	return conn.SetRecordForPath(isPath, snapshot.IdealStates[resource])
+}
+
+// EnableMaintenanceMode freezes all partition movement in the cluster, for example
+// during a zookeeper maintenance. The reason is saved in /<cluster>/CONTROLLER/MAINTENANCE
+// with the time maintenance started. The controller keeps updating the external view,
+// and only sends messages to reset replicas in ERROR and to cancel transitions.
+func (adm *AdminClient) EnableMaintenanceMode(cluster string, reason string) error {
+	keys := KeyBuilder{cluster}
+	return adm.setControllerSignal(cluster, keys.controllerMaintenance(), "maintenance", reason)
+}
+
+// DisableMaintenanceMode lets the controller move partitions again
+func (adm *AdminClient) DisableMaintenanceMode(cluster string) error {
+	keys := KeyBuilder{cluster}
+	return adm.removeControllerSignal(cluster, keys.controllerMaintenance())
+}
+
+// IsInMaintenanceMode tests if the cluster is in maintenance mode
+func (adm *AdminClient) IsInMaintenanceMode(cluster string) (bool, error) {
+	keys := KeyBuilder{cluster}
+	return adm.hasControllerSignal(cluster, keys.controllerMaintenance())
+}
+
+// PauseCluster pauses the controller of the cluster. The reason is saved in
+// /<cluster>/CONTROLLER/PAUSE with the time the cluster was paused. Like in maintenance
+// mode, the controller only sends messages to reset replicas and to cancel transitions.
+func (adm *AdminClient) PauseCluster(cluster string, reason string) error {
+	keys := KeyBuilder{cluster}
+	return adm.setControllerSignal(cluster, keys.controllerPause(), "pause", reason)
+}
+
+// ResumeCluster resumes the controller of a paused cluster
+func (adm *AdminClient) ResumeCluster(cluster string) error {
+	keys := KeyBuilder{cluster}
+	return adm.removeControllerSignal(cluster, keys.controllerPause())
+}
+
+// IsPaused tests if the controller of the cluster is paused
+func (adm *AdminClient) IsPaused(cluster string) (bool, error) {
+	keys := KeyBuilder{cluster}
+	return adm.hasControllerSignal(cluster, keys.controllerPause())
+}
+
+// setControllerSignal creates the znode that signals the controller, such as PAUSE
+func (adm *AdminClient) setControllerSignal(cluster string, path string, id string, reason string) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	signal := NewRecord(id)
+	signal.SetSimpleField(signalReasonKey, reason)
+	signal.SetSimpleField(signalTriggeredByKey, "USER")
+	signal.SetSimpleField(signalTimestampKey, strconv.FormatInt(time.Now().UnixNano()/1000000, 10))
+
+	return conn.SetRecordForPath(path, signal)
+}
+
+// removeControllerSignal removes the znode that signals the controller
+func (adm *AdminClient) removeControllerSignal(cluster string, path string) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	return conn.DeleteTree(path)
+}
+
+// hasControllerSignal tests if the znode that signals the controller exists
+func (adm *AdminClient) hasControllerSignal(cluster string, path string) (bool, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return false, ErrClusterNotSetup
+	}
+
+	return conn.Exists(path)
+}
+
+// GetClusterSnapshot reads the data the controller works on, for example to simulate a
+// change with a Simulator.
+func (adm *AdminClient) GetClusterSnapshot(cluster string) (*ClusterSnapshot, error) {
+	conn := adm.conn
 
 	// make sure the cluster is already setup
 	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
-		return "", ErrClusterNotSetup
+		return nil, ErrClusterNotSetup
+	}
+
+	return readClusterSnapshot(conn, cluster)
+}
+
+// WaitForConvergence waits until the external views of the resources match their best
+// possible states, the states the controller computes from the ideal states and the live
+// instances, and the state model constraints, like BestPossibleExternalViewVerifier in
+// Java Helix. All the resources with an ideal state are verified if resources is empty.
+// A zero timeout verifies once. On timeout, it returns ErrTimeout along with the report
+// of the partitions that have not converged.
+func (adm *AdminClient) WaitForConvergence(cluster string, resources []string, timeout time.Duration) (*ConvergenceReport, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
 	}
 
 	keys := KeyBuilder{cluster}
-	instanceCfg := keys.participantConfig(instance)
+	deadline := time.Now().Add(timeout)
 
-	if exists, err := conn.Exists(instanceCfg); !exists || err != nil {
+	for {
+		snapshot, err := readClusterSnapshot(conn, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		externalViews := make(map[string]*Record)
+		if err := readRecords(conn, keys.externalView(), externalViews); err != nil {
+			return nil, err
+		}
+
+		report := computeConvergence(snapshot, externalViews, resources)
+		if report.Converged() {
+			return report, nil
+		}
+
+		if time.Now().After(deadline) {
+			return report, ErrTimeout
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// ExportCluster reads the definition of the cluster, to recreate it elsewhere with
+// ImportCluster
+func (adm *AdminClient) ExportCluster(cluster string) (*ClusterDefinition, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	d := &ClusterDefinition{
+		Cluster:         cluster,
+		StateModelDefs:  make(map[string]*Record),
+		Instances:       make(map[string]*Record),
+		ResourceConfigs: make(map[string]*Record),
+		IdealStates:     make(map[string]*Record),
+		Constraints:     make(map[string]*Record),
+	}
+
+	var err error
+	if d.ClusterConfig, err = conn.GetRecordFromPath(keys.clusterConfig()); err != nil {
+		return nil, err
+	}
+
+	for path, records := range map[string]map[string]*Record{
+		keys.stateModels():        d.StateModelDefs,
+		keys.participantConfigs(): d.Instances,
+		keys.resourceConfigs():    d.ResourceConfigs,
+		keys.idealStates():        d.IdealStates,
+		keys.constraints():        d.Constraints,
+	} {
+		if err := readRecords(conn, path, records); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// ImportCluster creates or updates a cluster from a cluster definition, see
+// ExportCluster. The cluster is the one of the definition if empty, and is created if it
+// does not exist. The mode tells what to do with the existing records that differ from
+// the ones of the definition; in the ConflictFail mode, nothing is imported and
+// ErrImportConflict is returned along with the report of the conflicts. Records that are
+// not in the definition are left as they are.
+func (adm *AdminClient) ImportCluster(cluster string, d *ClusterDefinition, mode ConflictMode) (*ImportReport, error) {
+	if cluster == "" {
+		cluster = d.Cluster
+	}
+
+	switch mode {
+	case ConflictFail, ConflictOverwrite, ConflictMerge:
+	default:
+		return nil, ErrInvalidConflictMode
+	}
+
+	conn := adm.conn
+
+	// the records of a cluster that does not exist yet are all missing, so the plan
+	// is made before the cluster is created, and a conflict creates nothing
+	setup, _ := conn.IsClusterSetup(cluster)
+	records := d.definitionRecords(cluster)
+	existing := make(map[string]*Record)
+	for path := range records {
+		if !setup {
+			break
+		}
+
+		exists, err := conn.Exists(path)
+		if err != nil {
+			return nil, err
+		}
 		if !exists {
-			return "", ErrNodeNotExist
+			continue
+		}
+
+		if existing[path], err = conn.GetRecordFromPath(path); err != nil {
+			return nil, err
 		}
-		return "", err
 	}
 
-	r, err := conn.GetRecordFromPath(instanceCfg)
+	keys := KeyBuilder{cluster}
+	writes, report := planImport(existing, records, mode)
+	if len(report.Conflicts) > 0 {
+		return report, ErrImportConflict
+	}
+
+	if !setup {
+		if !adm.AddCluster(cluster) {
+			return nil, ErrClusterNotSetup
+		}
+		report.Created = append([]string{keys.cluster()}, report.Created...)
+	}
+
+	for name := range d.Instances {
+		if _, ok := writes[keys.participantConfig(name)]; !ok {
+			continue
+		}
+
+		for _, n := range instanceZnodes(cluster, NewRecord(name))[1:] {
+			if err := conn.ensurePath(n.path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the ideal states go last, so the controller sees them with their state models and
+	// instances
+	paths := []string{}
+	for path := range writes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, isLast := range []bool{false, true} {
+		for _, path := range paths {
+			if strings.HasPrefix(path, keys.idealStates()+"/") != isLast {
+				continue
+			}
+			if err := conn.SetRecordForPath(path, writes[path]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// PlanCluster computes the plan that brings the cluster to the spec, see ApplyPlan.
+// Resources, instances and instance tags that are not in the spec are removed only with
+// prune; config values are never removed. The number of partitions and the state model
+// of an existing resource cannot be changed.
+func (adm *AdminClient) PlanCluster(spec *ClusterSpec, prune bool) (*ApplyPlan, error) {
+	var d *ClusterDefinition
+	var err error
+	if ok, _ := adm.conn.IsClusterSetup(spec.Cluster); ok {
+		if d, err = adm.ExportCluster(spec.Cluster); err != nil {
+			return nil, err
+		}
+	}
+
+	actions, err := planSpec(spec, d, prune)
+	if err != nil {
+		return nil, err
+	}
+	return &ApplyPlan{Cluster: spec.Cluster, Actions: actions, Timeout: defaultApplyTimeout}, nil
+}
+
+// ApplyPlan applies the actions of a plan in order. It stops at the first action that
+// fails and returns an *ApplyError. Planning and applying again resumes from there.
+//
+// Pruned resources are dropped with DropResourceAndWait, and pruned instances are
+// evacuated and dropped once their evacuation is done, all within the Timeout of the
+// plan. An instance that is still evacuating or still live when its turn comes does not
+// stop the plan: the *ApplyError of the first such instance is returned after the other
+// actions are applied, and applying again drops it.
+func (adm *AdminClient) ApplyPlan(plan *ApplyPlan) error {
+	deadline := time.Now().Add(plan.Timeout)
+
+	var pending error
+	for _, action := range plan.Actions {
+		switch err := action.apply(adm, deadline); err {
+		case nil:
+		case ErrEvacuationInProgress, ErrInstanceLive:
+			if pending == nil {
+				pending = &ApplyError{action.Description, err}
+			}
+		default:
+			return &ApplyError{action.Description, err}
+		}
+	}
+	return pending
+}
+
+// ListClusterInfo reads the ideal states of the resources of the cluster and the configs
+// of its instances
+func (adm *AdminClient) ListClusterInfo(cluster string) (*ClusterInfo, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	idealStates := make(map[string]*Record)
+	if err := readRecords(conn, keys.idealStates(), idealStates); err != nil {
+		return nil, err
+	}
+
+	instanceConfigs := make(map[string]*Record)
+	if err := readRecords(conn, keys.participantConfigs(), instanceConfigs); err != nil {
+		return nil, err
+	}
+
+	return newClusterInfo(cluster, idealStates, instanceConfigs), nil
+}
+
+// ListClusters returns the names of the Helix managed clusters in the connected
+// zookeeper cluster, sorted
+func (adm *AdminClient) ListClusters() ([]string, error) {
+	conn := adm.conn
+
+	children, err := conn.Children("/")
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	clusters := []string{}
+	for _, cluster := range children {
+		if ok, err := conn.IsClusterSetup(cluster); ok && err == nil {
+			clusters = append(clusters, cluster)
+		}
 	}
-	return r.String(), nil
+
+	sort.Strings(clusters)
+	return clusters, nil
 }
 
-// GetInstances prints out lists of instances
-func (adm Admin) GetInstances(cluster string) {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+// ListResources returns the names of the resources managed by the helix cluster, sorted
+func (adm *AdminClient) ListResources(cluster string) ([]string, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	resources, err := conn.Children(keys.idealStates())
 	if err != nil {
-		fmt.Println("Failed to connect to zookeeper.")
+		return nil, err
 	}
-	defer conn.Disconnect()
 
-	kb := KeyBuilder{cluster}
-	instancesKey := kb.instances()
+	sort.Strings(resources)
+	return resources, nil
+}
 
-	data, err := conn.Get(instancesKey)
-	must(err)
+// ListInstances returns the names of the instances participating the cluster, sorted
+func (adm *AdminClient) ListInstances(cluster string) ([]string, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	instances, err := conn.Children(keys.instances())
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(instances)
+	return instances, nil
+}
+
+// ListInstanceInfo reads the config of an instance in the helix cluster
+func (adm *AdminClient) ListInstanceInfo(cluster string, instance string) (*InstanceConfig, error) {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	keys := KeyBuilder{cluster}
+	instanceCfg := keys.participantConfig(instance)
 
-	for _, c := range data {
-		fmt.Println(c)
+	if exists, err := conn.Exists(instanceCfg); !exists || err != nil {
+		if !exists {
+			return nil, ErrNodeNotExist
+		}
+		return nil, err
 	}
 
+	r, err := conn.GetRecordFromPath(instanceCfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewInstanceConfigFromRecord(r), nil
 }
 
-// DropInstance removes a participating instance from the helix cluster
-func (adm Admin) DropInstance(zkSvr string, cluster string, instance string) {
-	conn := newConnection(adm.ZkSvr)
-	err := conn.Connect()
+// GetInstances reads the configs of the instances of the cluster, sorted by name
+func (adm *AdminClient) GetInstances(cluster string) ([]*InstanceConfig, error) {
+	info, err := adm.ListClusterInfo(cluster)
 	if err != nil {
-		fmt.Println("Failed to connect to zookeeper.")
+		return nil, err
+	}
+	return info.Instances, nil
+}
+
+// DropInstance removes the instance tree of a participating instance from the helix
+// cluster, leaving its config. Use DropNode to remove the instance altogether. Like
+// DropCluster, a tree too large for one transaction is removed znode by znode, and a
+// failure is returned as a *PartialDeleteError.
+func (adm *AdminClient) DropInstance(cluster string, instance string) error {
+	conn := adm.conn
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
 	}
-	defer conn.Disconnect()
 
 	kb := KeyBuilder{cluster}
 	instanceKey := kb.instance(instance)
-	err = conn.Delete(instanceKey)
-	must(err)
 
-	fmt.Printf("/%s/%s deleted from zookeeper.\n", cluster, instance)
+	if exists, err := conn.Exists(instanceKey); !exists || err != nil {
+		if !exists {
+			return ErrInstanceNotExist
+		}
+		return err
+	}
+
+	return conn.deleteTree(instanceKey)
 }
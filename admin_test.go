@@ -3,7 +3,9 @@ package gohelix
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,16 +36,45 @@ func TestAddAndDropCluster(t *testing.T) {
 	}
 
 	//listClusters
-	if info, err := a.ListClusters(); err != nil || !strings.Contains(info, cluster) {
+	if clusters, err := a.ListClusters(); err != nil || !contains(clusters, cluster) {
 		t.Error("Expect OK")
 	}
 
 	a.DropCluster(cluster)
-	if info, err := a.ListClusters(); err != nil || strings.Contains(info, cluster) {
+	if clusters, err := a.ListClusters(); err != nil || contains(clusters, cluster) {
 		t.Error("Expect dropped")
 	}
 }
 
+func TestDropLargeCluster(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestDropLargeCluster_" + now.Format("20060102150405")
+	node := "localhost_19937"
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	a.AddNode(cluster, node)
+
+	// more status updates than fit in one zookeeper request
+	conn := connectLocalZk(t)
+	defer conn.Close()
+
+	kb := KeyBuilder{cluster}
+	for i := 0; i < 5000; i++ {
+		path := fmt.Sprintf("%s/%s_%04d", kb.statusUpdates(node), strings.Repeat("x", 100), i)
+		if _, err := conn.Create(path, []byte{}, 0, zk.WorldACL(zk.PermAll)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := a.DropCluster(cluster); err != nil {
+		t.Fatal(err)
+	}
+	verifyNodeNotExist(t, "/"+cluster)
+}
+
 func TestAddCluster(t *testing.T) {
 	t.Parallel()
 
@@ -104,13 +135,165 @@ func TestSetConfig(t *testing.T) {
 
 	a.SetConfig(cluster, "CLUSTER", property)
 
-	prop := a.GetConfig(cluster, "CLUSTER", []string{"allowParticipantAutoJoin"})
+	prop, _ := a.GetConfig(cluster, "CLUSTER", []string{"allowParticipantAutoJoin"})
 
 	if prop["allowParticipantAutoJoin"] != "true" {
 		t.Error("allowParticipantAutoJoin config set/get failed")
 	}
 }
 
+func TestSetClusterConfig(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestSetClusterConfig_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	// the settings the controller reads from the cluster config
+	properties := map[string]string{
+		flappingTimeWindowKey:            "60000",
+		flappingMaxSessionChangesKey:     "5",
+		transitionCancellationEnabledKey: "true",
+	}
+	if err := a.SetConfig(cluster, "CLUSTER", properties); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{}
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	if config, err := a.GetConfig(cluster, "CLUSTER", keys); err != nil || !reflect.DeepEqual(config, properties) {
+		t.Errorf("expect the cluster config %v, got %v", properties, config)
+	}
+}
+
+func TestScopedConfig(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestScopedConfig_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	added := a.AddCluster(cluster)
+	if added {
+		defer a.DropCluster(cluster)
+	}
+
+	a.AddNode(cluster, "localhost_19932")
+	a.AddResource(cluster, "myDB", 2, "MasterSlave")
+
+	if err := a.SetConfig(cluster, "PARTICIPANT", map[string]string{"DOMAIN": "zone=z1"}, "localhost_19932"); err != nil {
+		t.Error(err)
+	}
+	if prop, err := a.GetConfig(cluster, "PARTICIPANT", []string{"DOMAIN"}, "localhost_19932"); err != nil || prop["DOMAIN"] != "zone=z1" {
+		t.Error("participant config set/get failed")
+	}
+
+	if err := a.SetConfig(cluster, "PARTITION", map[string]string{"k": "v"}, "myDB", "myDB_0"); err != nil {
+		t.Error(err)
+	}
+	if prop, err := a.GetConfig(cluster, "PARTITION", []string{"k"}, "myDB", "myDB_0"); err != nil || prop["k"] != "v" {
+		t.Error("partition config set/get failed")
+	}
+
+	if err := a.RemoveConfig(cluster, "PARTITION", []string{"k"}, "myDB", "myDB_0"); err != nil {
+		t.Error(err)
+	}
+	if prop, _ := a.GetConfig(cluster, "PARTITION", []string{"k"}, "myDB", "myDB_0"); prop["k"] != "" {
+		t.Error("expect the partition config to be removed")
+	}
+
+	if err := a.SetConfig(cluster, "PARTICIPANT", map[string]string{"k": "v"}, "localhost_1"); err != ErrNodeNotExist {
+		t.Error("expect ErrNodeNotExist")
+	}
+	if err := a.SetConfig(cluster, "RESOURCE", map[string]string{"k": "v"}, "otherDB"); err != ErrResourceNotExists {
+		t.Error("expect ErrResourceNotExists")
+	}
+	if _, err := a.GetConfig(cluster, "PARTITION", []string{"k"}, "myDB"); err != ErrInvalidConfigScope {
+		t.Error("expect ErrInvalidConfigScope")
+	}
+}
+
+func TestSetConstraintConfig(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestSetConstraintConfig_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	added := a.AddCluster(cluster)
+	if added {
+		defer a.DropCluster(cluster)
+	}
+
+	spec := "TRANSITION=OFFLINE-SLAVE,INSTANCE=.*,CONSTRAINT_VALUE=2"
+	if err := a.SetConfig(cluster, "CONSTRAINT", map[string]string{"bootstrap": spec}); err != nil {
+		t.Error(err)
+	}
+
+	if prop, _ := a.GetConfig(cluster, "CONSTRAINT", []string{"bootstrap"}); prop["bootstrap"] != spec {
+		t.Error("constraint config set/get failed")
+	}
+
+	if err := a.SetConfig(cluster, "CONSTRAINT", map[string]string{"bad": "INSTANCE=.*"}); err != ErrInvalidConstraint {
+		t.Error("expect ErrInvalidConstraint")
+	}
+
+	a.SetConfig(cluster, "CONSTRAINT", map[string]string{"bootstrap": ""})
+	if prop, _ := a.GetConfig(cluster, "CONSTRAINT", []string{"bootstrap"}); prop["bootstrap"] != "" {
+		t.Error("expect the constraint to be removed")
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestMaintenanceMode_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	added := a.AddCluster(cluster)
+	if added {
+		defer a.DropCluster(cluster)
+	}
+
+	if err := a.EnableMaintenanceMode(cluster, "upgrade"); err != nil {
+		t.Error(err)
+	}
+
+	if ok, err := a.IsInMaintenanceMode(cluster); !ok || err != nil {
+		t.Error("expect the cluster to be in maintenance mode")
+	}
+
+	if err := a.DisableMaintenanceMode(cluster); err != nil {
+		t.Error(err)
+	}
+
+	if ok, _ := a.IsInMaintenanceMode(cluster); ok {
+		t.Error("expect the maintenance mode to be disabled")
+	}
+
+	if err := a.PauseCluster(cluster, "upgrade"); err != nil {
+		t.Error(err)
+	}
+
+	if ok, err := a.IsPaused(cluster); !ok || err != nil {
+		t.Error("expect the cluster to be paused")
+	}
+
+	if err := a.ResumeCluster(cluster); err != nil {
+		t.Error(err)
+	}
+
+	if ok, _ := a.IsPaused(cluster); ok {
+		t.Error("expect the cluster to be resumed")
+	}
+}
+
 func TestAddDropNode(t *testing.T) {
 	t.Parallel()
 
@@ -140,7 +323,7 @@ func TestAddDropNode(t *testing.T) {
 	}
 
 	// listInstanceInfo
-	if info, err := a.ListInstanceInfo(cluster, node); err != nil || info == "" || !strings.Contains(info, node) {
+	if info, err := a.ListInstanceInfo(cluster, node); err != nil || info.Name != node || info.Host != "localhost" || !info.Enabled {
 		t.Error("expect OK")
 	}
 
@@ -163,6 +346,333 @@ func TestAddDropNode(t *testing.T) {
 	verifyNodeNotExist(t, fmt.Sprintf("/%s/CONFIGS/PARTICIPANT/%s", cluster, node))
 }
 
+func TestDropAssignedNode(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestDropAssignedNode_" + now.Format("20060102150405")
+	node := "localhost_19932"
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	a.AddNode(cluster, node)
+	a.AddResource(cluster, "myDB", 4, "MasterSlave")
+	if err := a.Rebalance(cluster, "myDB", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.DropNode(cluster, node); err != ErrInstanceInUse {
+		t.Error("expect ErrInstanceInUse")
+	}
+	verifyNodeExist(t, fmt.Sprintf("/%s/CONFIGS/PARTICIPANT/%s", cluster, node))
+
+	if err := a.DropNodeForce(cluster, node); err != nil {
+		t.Error("expect the forced drop to succeed")
+	}
+	verifyNodeNotExist(t, fmt.Sprintf("/%s/CONFIGS/PARTICIPANT/%s", cluster, node))
+
+	// without replicas, the resource is dropped right away
+	if err := a.DropResourceAndWait(cluster, "myDB", 10*time.Second); err != nil {
+		t.Error(err)
+	}
+	kb := KeyBuilder{cluster}
+	verifyNodeNotExist(t, kb.idealStateForResource("myDB"))
+}
+
+func TestAddStateModelDef(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestAddStateModelDef_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	def := NewStateModelDefinition("PrimaryBackup", "OFFLINE").
+		AddState("PRIMARY", CountUpTo(1)).
+		AddState("BACKUP", CountReplicas).
+		AddState("OFFLINE", CountUnlimited).
+		AddTransition("OFFLINE", "BACKUP").
+		AddTransition("BACKUP", "PRIMARY").
+		AddTransition("PRIMARY", "BACKUP").
+		AddTransition("BACKUP", "OFFLINE").
+		AddTransition("OFFLINE", "DROPPED")
+
+	if err := a.AddStateModelDef(cluster, def); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddStateModelDef(cluster, def); err != ErrStateModelDefExists {
+		t.Error("expect ErrStateModelDefExists")
+	}
+
+	names, err := a.ListStateModelDefs(cluster)
+	if err != nil || len(names) != 7 {
+		t.Error("expect the custom and the built-in state model definitions")
+	}
+
+	read, err := a.GetStateModelDef(cluster, "PrimaryBackup")
+	if err != nil || read.InitialState != "OFFLINE" || read.Counts["PRIMARY"] != CountUpTo(1) {
+		t.Error("expect to read the state model definition back")
+	}
+	if _, err := a.GetStateModelDef(cluster, "NotExist"); err != ErrStateModelDefNotExist {
+		t.Error("expect ErrStateModelDefNotExist")
+	}
+
+	// resources can use the custom state model
+	if err := a.AddResource(cluster, "myDB", 4, "PrimaryBackup"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportImportCluster(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestExportImportCluster_" + now.Format("20060102150405")
+	staging := cluster + "_staging"
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+	defer a.DropCluster(staging)
+
+	a.AddNode(cluster, "localhost_12913")
+	a.AddResource(cluster, "myDB", 4, "MasterSlave")
+	a.Rebalance(cluster, "myDB", 1)
+
+	// the cluster config of the new cluster is replaced, not a conflict
+	if err := a.SetConfig(cluster, "CLUSTER", map[string]string{"DELAY_REBALANCE_TIME": "60000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := a.ExportCluster(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.Marshal(FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err = NewClusterDefinitionFromBytes(data); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := a.ImportCluster(staging, d, ConflictFail)
+	if err != nil || len(report.Created) == 0 {
+		t.Fatal("expect the cluster to be created")
+	}
+	verifyNodeExist(t, fmt.Sprintf("/%s/INSTANCES/localhost_12913/MESSAGES", staging))
+	if config, _ := a.GetConfig(staging, "CLUSTER", []string{"DELAY_REBALANCE_TIME"}); config["DELAY_REBALANCE_TIME"] != "60000" {
+		t.Error("expect the cluster config to be imported")
+	}
+
+	// importing again changes nothing
+	if report, err = a.ImportCluster(staging, d, ConflictFail); err != nil || len(report.Created)+len(report.Updated) != 0 {
+		t.Error("expect no change")
+	}
+
+	d.IdealStates["myDB"].SetIntField("REPLICAS", 2)
+	if _, err := a.ImportCluster(staging, d, ConflictFail); err != ErrImportConflict {
+		t.Error("expect ErrImportConflict")
+	}
+	if report, err = a.ImportCluster(staging, d, ConflictOverwrite); err != nil || len(report.Updated) != 1 {
+		t.Error("expect the ideal state to be updated")
+	}
+}
+
+func TestAdminClient(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestAdminClient_" + now.Format("20060102150405")
+
+	a, err := NewAdminClient(testZkSvr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if !a.AddCluster(cluster) {
+		t.Fatal("Failed to add cluster: " + cluster)
+	}
+	defer a.DropCluster(cluster)
+
+	// many operations run concurrently on the one session
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			if err := a.AddNode(cluster, node); err != nil {
+				t.Error(err)
+			}
+			if err := a.AddInstanceTag(cluster, node, "SSD"); err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprintf("localhost_%d", 12000+i))
+	}
+	wg.Wait()
+
+	instances, err := a.GetInstances(cluster)
+	if err != nil || len(instances) != 20 {
+		t.Fatal("expect 20 instances")
+	}
+	for _, i := range instances {
+		if len(i.Tags) != 1 {
+			t.Errorf("expect %s tagged", i.Name)
+		}
+	}
+}
+
+func TestRepairCluster(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestRepairCluster_" + now.Format("20060102150405")
+	node := "localhost_19933"
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	if err := a.AddNode(cluster, node); err != nil {
+		t.Fatal(err)
+	}
+
+	// break the cluster as a failed operation would
+	conn := connectLocalZk(t)
+	defer conn.Close()
+
+	kb := KeyBuilder{cluster}
+	conn.Delete(kb.controllerHistory(), -1)
+	conn.Delete(kb.messages(node), -1)
+	conn.Create(kb.instance("localhost_19934"), []byte{}, 0, zk.WorldACL(zk.PermAll))
+	conn.Create(kb.messages("localhost_19934"), []byte{}, 0, zk.WorldACL(zk.PermAll))
+
+	helixConn := newConnection(testZkSvr)
+	if err := helixConn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer helixConn.Disconnect()
+	if ok, _ := helixConn.IsClusterSetup(cluster); ok {
+		t.Error("expect the cluster broken")
+	}
+
+	report, err := a.RepairCluster(cluster, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &RepairReport{
+		Created: []string{kb.controllerHistory(), kb.messages(node)},
+		Removed: []string{kb.messages("localhost_19934"), kb.instance("localhost_19934")},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expect the report %v, got %v", expected, report)
+	}
+	verifyNodeNotExist(t, kb.controllerHistory())
+
+	if _, err := a.RepairCluster(cluster, false); err != nil {
+		t.Fatal(err)
+	}
+	verifyNodeExist(t, kb.controllerHistory())
+	verifyNodeExist(t, kb.messages(node))
+	verifyNodeNotExist(t, kb.instance("localhost_19934"))
+	if ok, _ := helixConn.IsClusterSetup(cluster); !ok {
+		t.Error("expect the cluster repaired")
+	}
+
+	if report, err := a.RepairCluster(cluster, false); err != nil || !report.Empty() {
+		t.Error("expect nothing left to repair")
+	}
+}
+
+func TestVerifyCluster(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestVerifyCluster_" + now.Format("20060102150405")
+	node := "localhost_19935"
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+	a.AddNode(cluster, node)
+
+	if report, err := a.VerifyCluster(cluster, false); err != nil || len(report.Findings) != 0 {
+		t.Fatal("expect a new cluster healthy")
+	}
+
+	// a message and current states of a session that is gone
+	conn := connectLocalZk(t)
+	defer conn.Close()
+
+	kb := KeyBuilder{cluster}
+	m := NewRecord("m1")
+	m.SetSimpleField("TGT_NAME", node)
+	m.SetSimpleField("TGT_SESSION_ID", "12345")
+	data, _ := m.Marshal()
+	conn.Create(kb.message(node, "m1"), data, 0, zk.WorldACL(zk.PermAll))
+	conn.Create(kb.currentStatesForSession(node, "12345"), []byte{}, 0, zk.WorldACL(zk.PermAll))
+	conn.Delete(kb.errorsR(node), -1)
+
+	report, err := a.VerifyCluster(cluster, true)
+	if err != nil || len(report.Findings) != 3 || !report.OK() {
+		t.Fatal("expect three findings fixed")
+	}
+	if report.Findings[0].Severity != SeverityError || report.Findings[0].Path != kb.errorsR(node) {
+		t.Error("expect the missing znode first")
+	}
+	verifyNodeExist(t, kb.errorsR(node))
+	verifyNodeNotExist(t, kb.message(node, "m1"))
+	verifyNodeNotExist(t, kb.currentStatesForSession(node, "12345"))
+
+	if report, err := a.VerifyCluster(cluster, false); err != nil || len(report.Findings) != 0 {
+		t.Error("expect the cluster healthy once fixed")
+	}
+}
+
+func TestApplyClusterSpec(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestApplyClusterSpec_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	defer a.DropCluster(cluster)
+
+	spec := &ClusterSpec{
+		Cluster:   cluster,
+		Instances: []InstanceSpec{{Name: "localhost_12913", Tags: []string{"SSD"}}, {Name: "localhost_12914"}},
+		Resources: []ResourceSpec{{Name: "myDB", Partitions: 4, Replicas: 2, StateModel: "MasterSlave"}},
+	}
+
+	plan, err := a.PlanCluster(spec, false)
+	if err != nil || len(plan.Actions) == 0 {
+		t.Fatal("expect a plan")
+	}
+	if err := a.ApplyPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	// applying again changes nothing
+	if plan, err = a.PlanCluster(spec, false); err != nil || len(plan.Actions) != 0 {
+		t.Error("expect the cluster to match the spec")
+	}
+
+	spec.Instances = spec.Instances[:1]
+	spec.Resources[0].Replicas = 1
+	if plan, err = a.PlanCluster(spec, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ApplyPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	verifyNodeNotExist(t, fmt.Sprintf("/%s/CONFIGS/PARTICIPANT/localhost_12914", cluster))
+}
+
 func TestAddDropResource(t *testing.T) {
 	t.Parallel()
 
@@ -200,7 +710,7 @@ func TestAddDropResource(t *testing.T) {
 	if err := a.AddResource(cluster, resource, 32, "MasterSlave"); err != nil {
 		t.Error("fail addResource")
 	}
-	if info, err := a.ListResources(cluster); err != nil || info == "" {
+	if resources, err := a.ListResources(cluster); err != nil || len(resources) != 1 || resources[0] != resource {
 		t.Error("expect OK")
 	}
 
@@ -274,6 +784,341 @@ func TestEnableDisableResource(t *testing.T) {
 	}
 }
 
+func TestEnableDisableInstance(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestEnableDisableInstance_" + now.Format("20060102150405")
+	instance := "localhost_12913"
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	if err := a.DisableInstance(cluster, instance); err != ErrNodeNotExist {
+		t.Error("expect ErrNodeNotExist")
+	}
+
+	a.AddNode(cluster, instance)
+	if err := a.DisablePartitions(cluster, instance, "myDB", []string{"myDB_0"}); err != ErrResourceNotExists {
+		t.Error("expect ErrResourceNotExists")
+	}
+	a.AddResource(cluster, "myDB", 4, "MasterSlave")
+
+	if err := a.DisableInstance(cluster, instance); err != nil {
+		t.Error(err)
+	}
+	if err := a.DisablePartitions(cluster, instance, "myDB", []string{"myDB_2", "myDB_0"}); err != nil {
+		t.Error(err)
+	}
+
+	conn := newConnection(testZkSvr)
+	if err := conn.Connect(); err != nil {
+		t.Fatal("Failed to connect to test zookeeper")
+	}
+	defer conn.Disconnect()
+
+	kb := KeyBuilder{cluster}
+	path := kb.participantConfig(instance)
+	if conn.GetSimpleFieldBool(path, "HELIX_ENABLED") {
+		t.Error("instance not disabled")
+	}
+
+	config, err := conn.GetRecordFromPath(path)
+	if err != nil || config.GetMapField(disabledPartitionKey, "myDB") != "myDB_0,myDB_2" {
+		t.Error("partitions not disabled")
+	}
+
+	if err := a.EnableInstance(cluster, instance); err != nil {
+		t.Error(err)
+	}
+	if err := a.EnablePartitions(cluster, instance, "myDB", []string{"myDB_0", "myDB_2"}); err != nil {
+		t.Error(err)
+	}
+
+	config, err = conn.GetRecordFromPath(path)
+	if err != nil || !config.GetBooleanField("HELIX_ENABLED", false) || len(disabledPartitions(config, "myDB")) != 0 {
+		t.Error("instance and partitions not enabled")
+	}
+}
+
+func TestInstanceTags(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestInstanceTags_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	for _, i := range []string{"localhost_12913", "localhost_12914", "localhost_12915"} {
+		a.AddNode(cluster, i)
+	}
+	if err := a.AddInstanceTag(cluster, "localhost_12913", "SSD"); err != nil {
+		t.Error(err)
+	}
+	if err := a.AddInstanceTag(cluster, "localhost_12915", "SSD"); err != nil {
+		t.Error(err)
+	}
+
+	if err := a.SetResourceInstanceGroupTag(cluster, "myDB", "SSD"); err != ErrResourceNotExists {
+		t.Error("expect ErrResourceNotExists")
+	}
+	a.AddResource(cluster, "myDB", 8, "MasterSlave")
+	if err := a.SetResourceInstanceGroupTag(cluster, "myDB", "SSD"); err != nil {
+		t.Error(err)
+	}
+	if err := a.Rebalance(cluster, "myDB", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := newConnection(testZkSvr)
+	if err := conn.Connect(); err != nil {
+		t.Fatal("Failed to connect to test zookeeper")
+	}
+	defer conn.Disconnect()
+
+	kb := KeyBuilder{cluster}
+	is, err := conn.GetRecordFromPath(kb.idealStateForResource("myDB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := range is.ListFields {
+		if contains(is.GetListField(p), "localhost_12914") {
+			t.Error("expect no replica on the untagged instance")
+		}
+	}
+
+	if err := a.RemoveInstanceTag(cluster, "localhost_12915", "SSD"); err != nil {
+		t.Error(err)
+	}
+	config, err := conn.GetRecordFromPath(kb.participantConfig("localhost_12915"))
+	if err != nil || len(instanceTags(config)) != 0 {
+		t.Error("expect the tag to be removed")
+	}
+}
+
+func TestSwapInstance(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestSwapInstance_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	for _, i := range []string{"localhost_12913", "localhost_12914"} {
+		a.AddNode(cluster, i)
+	}
+	a.AddResource(cluster, "myDB", 4, "MasterSlave")
+	a.AddResource(cluster, "otherDB", 4, "MasterSlave")
+	if err := a.Rebalance(cluster, "myDB", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.SwapInstance(cluster, "localhost_12913", "localhost_12915", false); err != ErrNodeNotExist {
+		t.Error("expect ErrNodeNotExist")
+	}
+	a.AddNode(cluster, "localhost_12915")
+
+	resources, err := a.SwapInstance(cluster, "localhost_12913", "localhost_12915", true)
+	if err != nil || len(resources) != 1 || resources[0] != "myDB" {
+		t.Error("expect the dry run to list myDB")
+	}
+
+	conn := newConnection(testZkSvr)
+	if err := conn.Connect(); err != nil {
+		t.Fatal("Failed to connect to test zookeeper")
+	}
+	defer conn.Disconnect()
+
+	kb := KeyBuilder{cluster}
+	hasInstance := func(instance string) bool {
+		is, err := conn.GetRecordFromPath(kb.idealStateForResource("myDB"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for p := range is.ListFields {
+			if contains(is.GetListField(p), instance) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !hasInstance("localhost_12913") {
+		t.Error("expect the dry run to leave the ideal state unchanged")
+	}
+
+	if _, err := a.SwapInstance(cluster, "localhost_12913", "localhost_12915", false); err != nil {
+		t.Error(err)
+	}
+	if hasInstance("localhost_12913") || !hasInstance("localhost_12915") {
+		t.Error("expect localhost_12915 to replace localhost_12913")
+	}
+}
+
+func TestEvacuateInstance(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestEvacuateInstance_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	for _, i := range []string{"localhost_12913", "localhost_12914", "localhost_12915"} {
+		a.AddNode(cluster, i)
+	}
+	a.AddResource(cluster, "myDB", 6, "MasterSlave")
+	if err := a.Rebalance(cluster, "myDB", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.EvacuateInstance(cluster, "localhost_12916"); err != ErrNodeNotExist {
+		t.Error("expect ErrNodeNotExist")
+	}
+	if err := a.EvacuateInstance(cluster, "localhost_12913"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := newConnection(testZkSvr)
+	if err := conn.Connect(); err != nil {
+		t.Fatal("Failed to connect to test zookeeper")
+	}
+	defer conn.Disconnect()
+
+	kb := KeyBuilder{cluster}
+	is, err := conn.GetRecordFromPath(kb.idealStateForResource("myDB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := range is.ListFields {
+		if list := is.GetListField(p); len(list) != 2 || contains(list, "localhost_12913") {
+			t.Error("expect the preference lists to move off the evacuated instance")
+		}
+	}
+
+	progress, err := a.GetEvacuationProgress(cluster, "localhost_12913")
+	if err != nil || !progress.Done() {
+		t.Error("expect an instance without replicas to be evacuated")
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestRebalance_" + now.Format("20060102150405")
+	resource := "resource"
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	nodes := []string{"localhost_12913", "localhost_12914", "localhost_12915"}
+	for _, node := range nodes {
+		if err := a.AddNode(cluster, node); err != nil {
+			t.Error("Should be able to add node")
+		}
+	}
+
+	if err := a.AddResource(cluster, resource, 6, "MasterSlave"); err != nil {
+		t.Error("fail addResource")
+	}
+
+	conn := newConnection(testZkSvr)
+	if err := conn.Connect(); err != nil {
+		t.Error("Failed to connect to test zookeeper")
+	}
+	defer conn.Disconnect()
+
+	// bring all nodes alive
+	kb := KeyBuilder{cluster}
+	for _, node := range nodes {
+		conn.CreateRecordWithPath(kb.liveInstance(node), NewLiveInstanceNode(node, conn.GetSessionID()))
+	}
+
+	if err := a.Rebalance(cluster, resource, 2); err != nil {
+		t.Error("expect OK")
+	}
+
+	is, err := conn.GetRecordFromPath(kb.idealStateForResource(resource))
+	if err != nil {
+		t.FailNow()
+	}
+
+	for _, p := range partitionNames(resource, 6) {
+		if len(is.GetListField(p)) != 2 {
+			t.Errorf("partition %s should have 2 replicas", p)
+		}
+	}
+
+	// with a delay, the replicas of an offline node stay put
+	a.SetConfig(cluster, "CLUSTER", map[string]string{"DELAY_REBALANCE_TIME": "60000"})
+	a.SetResourceConfig(cluster, resource, map[string]string{"MIN_ACTIVE_REPLICAS": "1"})
+	conn.Delete(kb.liveInstance(nodes[0]))
+
+	if err := a.Rebalance(cluster, resource, 2); err != nil {
+		t.Error("expect OK")
+	}
+
+	delayed, err := conn.GetRecordFromPath(kb.idealStateForResource(resource))
+	if err != nil {
+		t.FailNow()
+	}
+
+	for _, p := range partitionNames(resource, 6) {
+		if strings.Join(is.GetListField(p), ",") != strings.Join(delayed.GetListField(p), ",") {
+			t.Errorf("partition %s should not move during the delay", p)
+		}
+	}
+}
+
+func TestSetInstanceDomain(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestSetInstanceDomain_" + now.Format("20060102150405")
+	node := "localhost_12913"
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	if err := a.AddNode(cluster, node); err != nil {
+		t.Error("Should be able to add node")
+	}
+
+	// domain can not be set before the topology
+	if err := a.SetInstanceDomain(cluster, node, "zone=us-east-1a,rack=r12,host=h1"); err != ErrTopologyNotSet {
+		t.Error("expect ErrTopologyNotSet")
+	}
+
+	if err := a.SetClusterTopology(cluster, "/zone/rack/host", "dc"); err != ErrInvalidFaultZoneType {
+		t.Error("expect ErrInvalidFaultZoneType")
+	}
+
+	if err := a.SetClusterTopology(cluster, "/zone/rack/host", "zone"); err != nil {
+		t.Error("expect OK")
+	}
+
+	if err := a.SetInstanceDomain(cluster, node, "zone=us-east-1a,host=h1"); err != ErrInvalidDomain {
+		t.Error("expect ErrInvalidDomain")
+	}
+
+	if err := a.SetInstanceDomain(cluster, node, "host=h1,rack=r12,zone=us-east-1a"); err != nil {
+		t.Error("expect OK")
+	}
+
+	if info, err := a.ListInstanceInfo(cluster, node); err != nil || info.Domain != "zone=us-east-1a,rack=r12,host=h1" {
+		t.Error("domain not saved in the instance config")
+	}
+}
+
 func connectLocalZk(t *testing.T) *zk.Conn {
 	zkServers := strings.Split(testZkSvr, ",")
 	conn, _, err := zk.Connect(zkServers, time.Second)
@@ -316,3 +1161,37 @@ func verifyChildrenCount(t *testing.T, path string, count int32) {
 		t.Errorf("Node %s should have %d children, but only have %d children", path, count, stat.NumChildren)
 	}
 }
+
+func TestWaitForConvergence(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "AdminTest_TestWaitForConvergence_" + now.Format("20060102150405")
+	node := "localhost_19936"
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+	a.AddNode(cluster, node)
+	a.AddResource(cluster, "myDB", 1, "MasterSlave")
+
+	// nothing is assigned without live instances
+	if report, err := a.WaitForConvergence(cluster, nil, 0); err != nil || !report.Converged() {
+		t.Fatal("expect the cluster without live instances converged")
+	}
+
+	// a replica left on an instance that is not live
+	conn := connectLocalZk(t)
+	defer conn.Close()
+
+	kb := KeyBuilder{cluster}
+	ev := NewRecord("myDB")
+	ev.SetMapField("myDB_0", node, "MASTER")
+	data, _ := ev.Marshal()
+	conn.Create(kb.externalViewForResource("myDB"), data, 0, zk.WorldACL(zk.PermAll))
+
+	report, err := a.WaitForConvergence(cluster, []string{"myDB"}, time.Second)
+	if err != ErrTimeout || len(report.Mismatches) != 1 || report.Mismatches[0].Partition != "myDB_0" {
+		t.Fatal("expect the replica on the instance that is not live reported")
+	}
+}
@@ -0,0 +1,338 @@
+package gohelix
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ClusterSpec is the desired state of a cluster, see Admin.PlanCluster. Config values
+// are set in the config of their scope.
+type ClusterSpec struct {
+	Cluster   string            `json:"cluster"`
+	Config    map[string]string `json:"config"`
+	Instances []InstanceSpec    `json:"instances"`
+	Resources []ResourceSpec    `json:"resources"`
+}
+
+// InstanceSpec is the desired state of an instance, named host_port
+type InstanceSpec struct {
+	Name   string            `json:"name"`
+	Tags   []string          `json:"tags"`
+	Config map[string]string `json:"config"`
+}
+
+// ResourceSpec is the desired state of a resource. The partitions are assigned to the
+// instances with the replication factor, and only to the instances with the
+// InstanceGroupTag if it is set.
+type ResourceSpec struct {
+	Name             string            `json:"name"`
+	Partitions       int               `json:"partitions"`
+	Replicas         int               `json:"replicas"`
+	StateModel       string            `json:"stateModel"`
+	InstanceGroupTag string            `json:"instanceGroupTag"`
+	Config           map[string]string `json:"config"`
+}
+
+// NewClusterSpecFromBytes reads a cluster spec in json or yaml
+func NewClusterSpecFromBytes(data []byte) (*ClusterSpec, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(fromYAML(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &ClusterSpec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// validate checks that the spec names the cluster, that its instances are named
+// host_port, that its instances and resources are named once, and that its resources
+// have partitions and a state model
+func (spec *ClusterSpec) validate() error {
+	if spec.Cluster == "" {
+		return ErrInvalidSpec
+	}
+
+	seen := make(map[string]bool)
+	for _, i := range spec.Instances {
+		if !strings.Contains(i.Name, "_") || seen["instance "+i.Name] {
+			return ErrInvalidSpec
+		}
+		seen["instance "+i.Name] = true
+	}
+
+	for _, r := range spec.Resources {
+		if r.Name == "" || r.Partitions <= 0 || r.Replicas < 0 || r.StateModel == "" || seen["resource "+r.Name] {
+			return ErrInvalidSpec
+		}
+		seen["resource "+r.Name] = true
+	}
+
+	return nil
+}
+
+// ApplyAction is a step of an ApplyPlan. The actions that wait, for a resource to drop
+// or an instance to evacuate, wait until the deadline.
+type ApplyAction struct {
+	Description string
+	apply       func(adm *AdminClient, deadline time.Time) error
+}
+
+// ApplyPlan is the list of actions that bring a cluster to its spec, see
+// Admin.PlanCluster and Admin.ApplyPlan. A cluster that matches its spec has an empty
+// plan. The Timeout bounds the time Admin.ApplyPlan waits for the pruned resources to
+// drop and the pruned instances to evacuate; it is 5 minutes unless changed.
+type ApplyPlan struct {
+	Cluster string
+	Actions []*ApplyAction
+	Timeout time.Duration
+}
+
+// defaultApplyTimeout is the Timeout of a new ApplyPlan
+const defaultApplyTimeout = 5 * time.Minute
+
+// ApplyError is returned when an action of a plan fails. The actions before it are
+// applied, and the ones after it are not.
+type ApplyError struct {
+	Action string
+	Err    error
+}
+
+func (e *ApplyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Action, e.Err.Error())
+}
+
+// planSpec computes the actions that bring the cluster of the definition to the spec. The
+// definition is nil if the cluster does not exist. With prune, the resources, the
+// instances and the instance tags that are not in the spec are removed; config values
+// are never removed.
+func planSpec(spec *ClusterSpec, d *ClusterDefinition, prune bool) ([]*ApplyAction, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+
+	cluster := spec.Cluster
+	actions := []*ApplyAction{}
+	addWaiting := func(apply func(adm *AdminClient, deadline time.Time) error, format string, args ...interface{}) {
+		actions = append(actions, &ApplyAction{fmt.Sprintf(format, args...), apply})
+	}
+	add := func(apply func(adm *AdminClient) error, format string, args ...interface{}) {
+		addWaiting(func(adm *AdminClient, _ time.Time) error {
+			return apply(adm)
+		}, format, args...)
+	}
+
+	if d == nil {
+		d = &ClusterDefinition{ClusterConfig: NewRecord(cluster)}
+		add(func(adm *AdminClient) error {
+			if !adm.AddCluster(cluster) {
+				return ErrClusterNotSetup
+			}
+			return nil
+		}, "create cluster %s", cluster)
+	}
+
+	if changed := changedConfig(d.ClusterConfig, spec.Config); len(changed) > 0 {
+		add(func(adm *AdminClient) error {
+			return adm.SetConfig(cluster, ClusterConfigScope, changed)
+		}, "set cluster config %s", formatConfig(changed))
+	}
+
+	// instances
+	inSpec := make(map[string]bool)
+	membershipChanged := false
+	for _, i := range spec.Instances {
+		instance := i
+		inSpec[instance.Name] = true
+
+		config, ok := d.Instances[instance.Name]
+		if !ok {
+			config = NewRecord(instance.Name)
+			membershipChanged = true
+			add(func(adm *AdminClient) error {
+				return adm.AddNode(cluster, instance.Name)
+			}, "add instance %s", instance.Name)
+		}
+
+		tags := instanceTags(config)
+		for _, tag := range instance.Tags {
+			if tag := tag; !contains(tags, tag) {
+				add(func(adm *AdminClient) error {
+					return adm.AddInstanceTag(cluster, instance.Name, tag)
+				}, "tag instance %s with %s", instance.Name, tag)
+			}
+		}
+		for _, tag := range tags {
+			if tag := tag; prune && !contains(instance.Tags, tag) {
+				add(func(adm *AdminClient) error {
+					return adm.RemoveInstanceTag(cluster, instance.Name, tag)
+				}, "remove tag %s from instance %s", tag, instance.Name)
+			}
+		}
+
+		if changed := changedConfig(config, instance.Config); len(changed) > 0 {
+			add(func(adm *AdminClient) error {
+				return adm.SetConfig(cluster, ParticipantConfigScope, changed, instance.Name)
+			}, "set config of instance %s %s", instance.Name, formatConfig(changed))
+		}
+	}
+
+	// resources, the ones to prune first
+	resourceInSpec := make(map[string]bool)
+	for _, r := range spec.Resources {
+		resourceInSpec[r.Name] = true
+	}
+	for _, name := range sortedKeys(d.IdealStates) {
+		if name := name; prune && !resourceInSpec[name] {
+			addWaiting(func(adm *AdminClient, deadline time.Time) error {
+				return adm.DropResourceAndWait(cluster, name, time.Until(deadline))
+			}, "drop resource %s", name)
+		}
+	}
+
+	rebalance := make(map[string]bool)
+	for _, r := range spec.Resources {
+		resource := r
+
+		is, ok := d.IdealStates[resource.Name]
+		if !ok {
+			is = NewRecord(resource.Name)
+			is.SetIntField("NUM_PARTITIONS", resource.Partitions)
+			is.SetSimpleField("STATE_MODEL_DEF_REF", resource.StateModel)
+			rebalance[resource.Name] = true
+			add(func(adm *AdminClient) error {
+				return adm.AddResource(cluster, resource.Name, resource.Partitions, resource.StateModel)
+			}, "add resource %s with %d partitions of %s", resource.Name, resource.Partitions, resource.StateModel)
+		}
+
+		if is.GetIntField("NUM_PARTITIONS", 0) != resource.Partitions || is.GetSimpleField("STATE_MODEL_DEF_REF") != resource.StateModel {
+			return nil, ErrResourceSpecChanged
+		}
+
+		if tag, _ := is.GetSimpleField(instanceGroupTagKey).(string); tag != resource.InstanceGroupTag {
+			rebalance[resource.Name] = true
+			add(func(adm *AdminClient) error {
+				return adm.SetResourceInstanceGroupTag(cluster, resource.Name, resource.InstanceGroupTag)
+			}, "set instance group tag of resource %s to %q", resource.Name, resource.InstanceGroupTag)
+		}
+
+		if is.GetIntField("REPLICAS", 0) != resource.Replicas {
+			rebalance[resource.Name] = true
+		}
+
+		config, ok := d.ResourceConfigs[resource.Name]
+		if !ok {
+			config = NewRecord(resource.Name)
+		}
+		if changed := changedConfig(config, resource.Config); len(changed) > 0 {
+			add(func(adm *AdminClient) error {
+				return adm.SetConfig(cluster, ResourceConfigScope, changed, resource.Name)
+			}, "set config of resource %s %s", resource.Name, formatConfig(changed))
+		}
+	}
+
+	// the instances to prune are evacuated, so the rebalance leaves them out
+	pruned := []string{}
+	for _, name := range sortedKeys(d.Instances) {
+		if name := name; prune && !inSpec[name] {
+			membershipChanged = true
+			pruned = append(pruned, name)
+			add(func(adm *AdminClient) error {
+				return adm.EvacuateInstance(cluster, name)
+			}, "evacuate instance %s", name)
+		}
+	}
+
+	// the partitions are assigned to the instances
+	for _, r := range spec.Resources {
+		resource := r
+		if resource.Replicas == 0 || (!rebalance[resource.Name] && !membershipChanged) {
+			continue
+		}
+
+		add(func(adm *AdminClient) error {
+			return adm.Rebalance(cluster, resource.Name, resource.Replicas)
+		}, "rebalance resource %s with %d replicas", resource.Name, resource.Replicas)
+	}
+
+	// and the pruned instances are dropped last, once their replicas have moved
+	for _, name := range pruned {
+		name := name
+		addWaiting(func(adm *AdminClient, deadline time.Time) error {
+			if err := waitForEvacuation(adm, cluster, name, deadline); err != nil {
+				return err
+			}
+			return adm.DropNode(cluster, name)
+		}, "drop instance %s", name)
+	}
+
+	return actions, nil
+}
+
+// waitForEvacuation waits until the evacuation of the instance is done, or returns
+// ErrEvacuationInProgress at the deadline
+func waitForEvacuation(adm *AdminClient, cluster string, instance string, deadline time.Time) error {
+	for {
+		progress, err := adm.GetEvacuationProgress(cluster, instance)
+		if err != nil {
+			return err
+		}
+		if progress.Done() {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return ErrEvacuationInProgress
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// changedConfig returns the values of the spec that differ from the config
+func changedConfig(config *Record, values map[string]string) map[string]string {
+	result := make(map[string]string)
+	for k, v := range values {
+		if current, ok := config.GetSimpleField(k).(string); !ok || current != v {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// formatConfig formats config values as k="v", sorted by key
+func formatConfig(values map[string]string) string {
+	keys := []string{}
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := []string{}
+	for _, k := range keys {
+		result = append(result, k+"="+strconv.Quote(values[k]))
+	}
+	return strings.Join(result, ", ")
+}
+
+// sortedKeys returns the names of the records, sorted
+func sortedKeys(records map[string]*Record) []string {
+	result := []string{}
+	for k := range records {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
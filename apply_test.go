@@ -0,0 +1,106 @@
+package gohelix
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testClusterSpec = []byte(`
+cluster: MYCLUSTER
+config:
+  DELAY_REBALANCE_TIME: "60000"
+instances:
+- name: localhost_12913
+  tags: [SSD]
+- name: localhost_12914
+resources:
+- name: myDB
+  partitions: 4
+  replicas: 2
+  stateModel: MasterSlave
+  config:
+    MIN_ACTIVE_REPLICAS: "1"
+`)
+
+func descriptions(actions []*ApplyAction) []string {
+	result := []string{}
+	for _, a := range actions {
+		result = append(result, a.Description)
+	}
+	return result
+}
+
+func TestPlanSpec(t *testing.T) {
+	t.Parallel()
+
+	spec, err := NewClusterSpecFromBytes(testClusterSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions, err := planSpec(spec, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create cluster MYCLUSTER",
+		`set cluster config DELAY_REBALANCE_TIME="60000"`,
+		"add instance localhost_12913",
+		"tag instance localhost_12913 with SSD",
+		"add instance localhost_12914",
+		"add resource myDB with 4 partitions of MasterSlave",
+		`set config of resource myDB MIN_ACTIVE_REPLICAS="1"`,
+		"rebalance resource myDB with 2 replicas",
+	}
+	if got := descriptions(actions); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expect the plan %v, got %v", expected, got)
+	}
+
+	// a cluster that matches the spec has an empty plan
+	clusterConfig := NewRecord("MYCLUSTER")
+	clusterConfig.SetSimpleField("DELAY_REBALANCE_TIME", "60000")
+	h1, h2, h3 := NewRecord("localhost_12913"), NewRecord("localhost_12914"), NewRecord("localhost_12915")
+	setInstanceTag(h1, "SSD", true)
+	setInstanceTag(h2, "HDD", true)
+	is := newTestIdealState("myDB", "SEMI_AUTO", 2)
+	is.SetIntField("NUM_PARTITIONS", 4)
+	resourceConfig := NewRecord("myDB")
+	resourceConfig.SetSimpleField("MIN_ACTIVE_REPLICAS", "1")
+
+	d := &ClusterDefinition{
+		Cluster:         "MYCLUSTER",
+		ClusterConfig:   clusterConfig,
+		Instances:       map[string]*Record{"localhost_12913": h1, "localhost_12914": h2, "localhost_12915": h3},
+		IdealStates:     map[string]*Record{"myDB": is, "otherDB": newTestIdealState("otherDB", "SEMI_AUTO", 1)},
+		ResourceConfigs: map[string]*Record{"myDB": resourceConfig},
+	}
+
+	if actions, err = planSpec(spec, d, false); err != nil || len(actions) != 0 {
+		t.Errorf("expect an empty plan, got %v", descriptions(actions))
+	}
+
+	// with prune, the rest goes
+	if actions, err = planSpec(spec, d, true); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"remove tag HDD from instance localhost_12914",
+		"drop resource otherDB",
+		"evacuate instance localhost_12915",
+		"rebalance resource myDB with 2 replicas",
+		"drop instance localhost_12915",
+	}
+	if got := descriptions(actions); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expect the plan %v, got %v", expected, got)
+	}
+
+	spec.Resources[0].Partitions = 8
+	if _, err := planSpec(spec, d, false); err != ErrResourceSpecChanged {
+		t.Error("expect ErrResourceSpecChanged")
+	}
+
+	spec.Instances = append(spec.Instances, InstanceSpec{Name: "localhost"})
+	if _, err := planSpec(spec, d, false); err != ErrInvalidSpec {
+		t.Error("expect ErrInvalidSpec")
+	}
+}
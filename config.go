@@ -0,0 +1,102 @@
+package gohelix
+
+// Config scopes that can supply the effective value of a key, from the most specific to
+// the least, see ConfigAccessor
+const (
+	PartitionConfigScope   = "PARTITION"
+	ResourceConfigScope    = "RESOURCE"
+	ParticipantConfigScope = "PARTICIPANT"
+	ClusterConfigScope     = "CLUSTER"
+)
+
+// ConfigValue is the effective value of a config key. Scope is the config scope that
+// supplied the value, or empty if the key is not set at any scope.
+type ConfigValue struct {
+	Key   string
+	Value string
+	Scope string
+}
+
+// ConfigAccessor resolves the effective value of a config key. A key set in the config of
+// a partition overrides the one of its resource, which overrides the one of the instance,
+// which overrides the one of the cluster. See Admin.SetConfig to set the values.
+type ConfigAccessor struct {
+	// zookeeper connection string
+	zkConnStr string
+
+	// The cluster of the configs
+	ClusterID string
+}
+
+// Get returns the effective value of a key for a replica. Empty resource, partition or
+// instance leave their scope out.
+func (a *ConfigAccessor) Get(key string, resource string, partition string, instance string) (ConfigValue, error) {
+	conn := newConnection(a.zkConnStr)
+	err := conn.Connect()
+	if err != nil {
+		return ConfigValue{}, err
+	}
+	defer conn.Disconnect()
+
+	// make sure the cluster is already setup
+	if ok, err := conn.IsClusterSetup(a.ClusterID); !ok || err != nil {
+		return ConfigValue{}, ErrClusterNotSetup
+	}
+
+	return readConfigValue(conn, KeyBuilder{a.ClusterID}, key, resource, partition, instance)
+}
+
+// readConfigValue reads the configs of the scopes and resolves the value of the key
+func readConfigValue(conn *connection, keys KeyBuilder, key string, resource string, partition string, instance string) (ConfigValue, error) {
+	var resourceConfig, instanceConfig *Record
+	var err error
+
+	if resource != "" {
+		if resourceConfig, err = getConfigRecord(conn, keys.resourceConfig(resource)); err != nil {
+			return ConfigValue{}, err
+		}
+	}
+
+	if instance != "" {
+		if instanceConfig, err = getConfigRecord(conn, keys.participantConfig(instance)); err != nil {
+			return ConfigValue{}, err
+		}
+	}
+
+	clusterConfig, err := getConfigRecord(conn, keys.clusterConfig())
+	if err != nil {
+		return ConfigValue{}, err
+	}
+
+	return resolveConfigValue(key, partition, resourceConfig, instanceConfig, clusterConfig), nil
+}
+
+// resolveConfigValue looks up the key from the most specific config to the least. The
+// partition config is the map field of the partition in the resource config. Nil configs
+// are skipped.
+func resolveConfigValue(key string, partition string, resourceConfig *Record, instanceConfig *Record, clusterConfig *Record) ConfigValue {
+	if resourceConfig != nil && partition != "" {
+		if v, ok := resourceConfig.MapFields[partition][key]; ok {
+			return ConfigValue{key, v, PartitionConfigScope}
+		}
+	}
+
+	for _, layer := range []struct {
+		scope  string
+		config *Record
+	}{
+		{ResourceConfigScope, resourceConfig},
+		{ParticipantConfigScope, instanceConfig},
+		{ClusterConfigScope, clusterConfig},
+	} {
+		if layer.config == nil {
+			continue
+		}
+
+		if v, ok := layer.config.GetSimpleField(key).(string); ok {
+			return ConfigValue{key, v, layer.scope}
+		}
+	}
+
+	return ConfigValue{Key: key}
+}
@@ -0,0 +1,40 @@
+package gohelix
+
+import "testing"
+
+func TestResolveConfigValue(t *testing.T) {
+	t.Parallel()
+
+	cluster := NewRecord("MYCLUSTER")
+	cluster.SetSimpleField("TIMEOUT", "1000")
+
+	instance := NewRecord("localhost_12913")
+	resource := NewRecord("myDB")
+
+	if v := resolveConfigValue("TIMEOUT", "myDB_0", resource, instance, cluster); v.Value != "1000" || v.Scope != ClusterConfigScope {
+		t.Error("expect the value of the cluster")
+	}
+
+	instance.SetSimpleField("TIMEOUT", "2000")
+	if v := resolveConfigValue("TIMEOUT", "myDB_0", resource, instance, cluster); v.Value != "2000" || v.Scope != ParticipantConfigScope {
+		t.Error("expect the instance to override the cluster")
+	}
+
+	resource.SetSimpleField("TIMEOUT", "3000")
+	if v := resolveConfigValue("TIMEOUT", "myDB_0", resource, instance, cluster); v.Value != "3000" || v.Scope != ResourceConfigScope {
+		t.Error("expect the resource to override the instance")
+	}
+
+	resource.SetMapField("myDB_0", "TIMEOUT", "4000")
+	if v := resolveConfigValue("TIMEOUT", "myDB_0", resource, instance, cluster); v.Value != "4000" || v.Scope != PartitionConfigScope {
+		t.Error("expect the partition to override the resource")
+	}
+
+	if v := resolveConfigValue("TIMEOUT", "myDB_1", nil, nil, cluster); v.Value != "1000" {
+		t.Error("expect the scopes that are left out to be skipped")
+	}
+
+	if v := resolveConfigValue("RETRIES", "myDB_0", resource, instance, cluster); v.Scope != "" || v.Value != "" {
+		t.Error("expect no scope for a key that is not set")
+	}
+}
@@ -22,6 +22,10 @@ var (
 	}
 )
 
+// connection is safe for concurrent use. The read-modify-write helpers, updateRecord and
+// the ones built on it, write with the version they read and retry on conflicts, so that
+// concurrent updates of a znode do not overwrite each other. SetRecordForPath and Set do
+// overwrite.
 type connection struct {
 	zkSvr       string
 	zkConn      *zk.Conn
@@ -50,25 +54,32 @@ func (conn *connection) Connect() error {
 		return err
 	}
 
+	conn.Lock()
 	conn.isConnected = true
 	conn.zkConn = zkConn
+	conn.Unlock()
 
 	return nil
 }
 
 func (conn *connection) IsConnected() bool {
-	if conn == nil || conn.isConnected == false {
+	if conn == nil {
 		return false
 	}
 
-	_, _, err := conn.zkConn.Exists("/zookeeper")
-	if err != nil {
-		conn.isConnected = false
+	conn.RLock()
+	isConnected := conn.isConnected
+	conn.RUnlock()
+	if !isConnected {
 		return false
 	}
 
-	conn.isConnected = true
-	return true
+	_, _, err := conn.zkConn.Exists("/zookeeper")
+
+	conn.Lock()
+	conn.isConnected = err == nil
+	conn.Unlock()
+	return err == nil
 }
 
 func (conn *connection) GetSessionID() string {
@@ -77,7 +88,9 @@ func (conn *connection) GetSessionID() string {
 
 func (conn *connection) Disconnect() {
 	conn.zkConn.Close()
+	conn.Lock()
 	conn.isConnected = false
+	conn.Unlock()
 }
 
 func (conn *connection) CreateEmptyNode(path string) {
@@ -123,7 +136,7 @@ func (conn *connection) Exists(path string) (bool, error) {
 		return retry.RetryBreak, nil
 	})
 
-	conn.stat = stat
+	conn.setStat(stat)
 	return result, err
 }
 
@@ -146,7 +159,7 @@ func (conn *connection) Get(path string) ([]byte, error) {
 			return retry.RetryContinue, nil
 		}
 		data = d
-		conn.stat = s
+		conn.setStat(s)
 		return retry.RetryBreak, nil
 	})
 
@@ -163,7 +176,7 @@ func (conn *connection) GetW(path string) ([]byte, <-chan zk.Event, error) {
 			return retry.RetryContinue, nil
 		}
 		data = d
-		conn.stat = s
+		conn.setStat(s)
 		events = evts
 		return retry.RetryBreak, nil
 	})
@@ -171,11 +184,42 @@ func (conn *connection) GetW(path string) ([]byte, <-chan zk.Event, error) {
 	return data, events, err
 }
 
+// setStat saves the stat of the last read, see Set
+func (conn *connection) setStat(stat *zk.Stat) {
+	conn.Lock()
+	conn.stat = stat
+	conn.Unlock()
+}
+
+// Set writes a znode with the version of the last read. Use getWithVersion to read and
+// write a znode when the connection is shared.
 func (conn *connection) Set(path string, data []byte) error {
-	_, err := conn.zkConn.Set(path, data, conn.stat.Version)
+	conn.RLock()
+	version := conn.stat.Version
+	conn.RUnlock()
+
+	_, err := conn.zkConn.Set(path, data, version)
 	return err
 }
 
+// getWithVersion reads a znode and its version, to write it back with the version
+func (conn *connection) getWithVersion(path string) ([]byte, int32, error) {
+	var data []byte
+	var version int32
+
+	err := retry.RetryWithBackoff(zkRetryOptions, func() (retry.RetryStatus, error) {
+		d, s, err := conn.zkConn.Get(path)
+		if err != nil {
+			return retry.RetryContinue, nil
+		}
+		data = d
+		version = s.Version
+		return retry.RetryBreak, nil
+	})
+
+	return data, version, err
+}
+
 func (conn *connection) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
 	return conn.zkConn.Create(path, data, flags, acl)
 }
@@ -189,7 +233,7 @@ func (conn *connection) Children(path string) ([]string, error) {
 			return retry.RetryContinue, nil
 		}
 		children = c
-		conn.stat = s
+		conn.setStat(s)
 		return retry.RetryBreak, nil
 	})
 
@@ -206,7 +250,7 @@ func (conn *connection) ChildrenW(path string) ([]string, <-chan zk.Event, error
 			return retry.RetryContinue, nil
 		}
 		children = c
-		conn.stat = s
+		conn.setStat(s)
 		eventChan = evts
 		return retry.RetryBreak, nil
 	})
@@ -225,7 +269,7 @@ func (conn *connection) ChildrenW(path string) ([]string, <-chan zk.Event, error
 // if we want to set the CURRENT_STATE to ONLINE, we call
 // UpdateMapField("/RELAY/INSTANCES/{instance}/CURRENT_STATE/{sessionID}/{db}", "eat1-app993.stg.linkedin.com_11932,BizProfile,p31_1,SLAVE", "CURRENT_STATE", "ONLINE")
 func (conn *connection) UpdateMapField(path string, key string, property string, value string) error {
-	data, err := conn.Get(path)
+	data, version, err := conn.getWithVersion(path)
 	if err != nil {
 		return err
 	}
@@ -246,30 +290,46 @@ func (conn *connection) UpdateMapField(path string, key string, property string,
 	}
 
 	// copy back to zookeeper
-	err = conn.Set(path, data)
+	_, err = conn.zkConn.Set(path, data, version)
 	return err
 }
 
-func (conn *connection) UpdateSimpleField(path string, key string, value string) {
+// UpdateSimpleField sets a simple field of the record at path, see updateRecord
+func (conn *connection) UpdateSimpleField(path string, key string, value string) error {
+	return conn.updateRecord(path, func(r *Record) error {
+		r.SetSimpleField(key, value)
+		return nil
+	})
+}
 
-	// get the current node
-	data, err := conn.Get(path)
-	must(err)
+// updateRecord reads the record at path, updates it and writes it back with the version
+// it read. The update is read and applied again when the record was changed meanwhile,
+// so that concurrent updates do not overwrite each other. It returns zk.ErrNoNode if the
+// record does not exist.
+func (conn *connection) updateRecord(path string, update func(r *Record) error) error {
+	for {
+		data, stat, err := conn.zkConn.Get(path)
+		if err != nil {
+			return err
+		}
 
-	// convert the result into Record
-	node, err := NewRecordFromBytes(data)
-	must(err)
+		r, err := NewRecordFromBytes(data)
+		if err != nil {
+			return err
+		}
 
-	// update the value
-	node.SetSimpleField(key, value)
+		if err := update(r); err != nil {
+			return err
+		}
 
-	// mashall to bytes
-	data, err = node.Marshal()
-	must(err)
+		if data, err = r.Marshal(); err != nil {
+			return err
+		}
 
-	// copy back to zookeeper
-	err = conn.Set(path, data)
-	must(err)
+		if _, err = conn.zkConn.Set(path, data, stat.Version); err != zk.ErrBadVersion {
+			return err
+		}
+	}
 }
 
 func (conn *connection) GetSimpleFieldValueByKey(path string, key string) string {
@@ -325,8 +385,132 @@ func (conn *connection) DeleteTree(path string) error {
 	return conn.Delete(path)
 }
 
+// treePaths returns the paths of the tree at path, children first, to delete it in a
+// transaction. The tree of a path that does not exist is empty.
+func (conn *connection) treePaths(path string) ([]string, error) {
+	children, _, err := conn.zkConn.Children(path)
+	if err == zk.ErrNoNode {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, c := range children {
+		paths, err := conn.treePaths(path + "/" + c)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, paths...)
+	}
+	return append(result, path), nil
+}
+
+// childrenIfExists returns the children of a path, or none if the path does not exist.
+// Unlike Children, it does not wait for the path to be created.
+func (conn *connection) childrenIfExists(path string) ([]string, error) {
+	children, _, err := conn.zkConn.Children(path)
+	if err == zk.ErrNoNode {
+		return []string{}, nil
+	}
+	return children, err
+}
+
+// missingZnodes returns the znodes that do not exist, in order
+func (conn *connection) missingZnodes(nodes []znode) ([]znode, error) {
+	result := []znode{}
+	for _, n := range nodes {
+		exists, _, err := conn.zkConn.Exists(n.path)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
+
+// multi creates the znodes and then deletes the paths in one transaction: either all
+// of them succeed or none does
+func (conn *connection) multi(creates []znode, deletes []string) error {
+	acl := zk.WorldACL(zk.PermAll)
+	ops := []interface{}{}
+
+	for _, n := range creates {
+		data := n.data
+		if data == nil {
+			data = []byte{}
+		}
+		ops = append(ops, &zk.CreateRequest{Path: n.path, Data: data, Acl: acl})
+	}
+	for _, p := range deletes {
+		ops = append(ops, &zk.DeleteRequest{Path: p, Version: -1})
+	}
+
+	if len(ops) == 0 {
+		return nil
+	}
+	_, err := conn.zkConn.Multi(ops...)
+	return err
+}
+
+// maxMultiSize bounds the size of the deletes of a transaction, well below the 1MB
+// jute.maxbuffer of zookeeper, which closes the session on larger requests
+const maxMultiSize = 512 * 1024
+
+// deleteTree deletes the tree at path in one transaction if it is small enough, see
+// maxMultiSize. A larger tree, or one that changes while it is deleted, is deleted
+// children first, one znode at a time, which is not atomic: if it fails after deleting
+// part of the tree, it returns a *PartialDeleteError with the znodes left behind, and
+// deleting again resumes.
+func (conn *connection) deleteTree(path string) error {
+	paths, err := conn.treePaths(path)
+	if err != nil {
+		return err
+	}
+
+	size := 0
+	for _, p := range paths {
+		size += len(p) + 32
+	}
+	if size <= maxMultiSize {
+		err := conn.multi(nil, paths)
+		if err != zk.ErrNotEmpty && err != zk.ErrNoNode {
+			return err
+		}
+	}
+
+	// children may be created while the tree is deleted, so it is listed again then
+	deleted := false
+	for attempt := 0; ; attempt++ {
+		if paths, err = conn.treePaths(path); err != nil {
+			break
+		}
+
+		for len(paths) > 0 {
+			if err = conn.zkConn.Delete(paths[0], -1); err != nil && err != zk.ErrNoNode {
+				break
+			}
+			err = nil
+			deleted = true
+			paths = paths[1:]
+		}
+
+		if err != zk.ErrNotEmpty || attempt == 4 {
+			break
+		}
+	}
+
+	if err != nil && deleted {
+		return &PartialDeleteError{Path: path, Remaining: paths, Err: err}
+	}
+	return err
+}
+
 func (conn *connection) RemoveMapFieldKey(path string, key string) error {
-	data, err := conn.Get(path)
+	data, version, err := conn.getWithVersion(path)
 	if err != nil {
 		return err
 	}
@@ -344,7 +528,7 @@ func (conn *connection) RemoveMapFieldKey(path string, key string) error {
 	}
 
 	// save the data back to zookeeper
-	err = conn.Set(path, data)
+	_, err = conn.zkConn.Set(path, data, version)
 	return err
 }
 
@@ -382,6 +566,9 @@ func (conn *connection) GetRecordFromPath(path string) (*Record, error) {
 	return NewRecordFromBytes(data)
 }
 
+// SetRecordForPath writes the record at path, creating the path if needed. It
+// overwrites whatever is there; use updateRecord to update a record without losing the
+// concurrent changes.
 func (conn *connection) SetRecordForPath(path string, r *Record) error {
 	if exists, _ := conn.Exists(path); !exists {
 		conn.ensurePath(path)
@@ -392,22 +579,26 @@ func (conn *connection) SetRecordForPath(path string, r *Record) error {
 		return err
 	}
 
-	// need to get the stat.version before calling set
-	conn.Lock()
+	_, err = conn.zkConn.Set(path, data, -1)
+	return err
+}
 
-	if _, err := conn.Get(path); err != nil {
-		conn.Unlock()
+// createRecordIfMissing creates the record at path, and the parents of the path, unless
+// the path exists, so that it can be updated with updateRecord
+func (conn *connection) createRecordIfMissing(p string, r *Record) error {
+	if err := conn.ensurePath(path.Dir(p)); err != nil {
 		return err
 	}
 
-	if err := conn.Set(path, data); err != nil {
-		conn.Unlock()
+	data, err := r.Marshal()
+	if err != nil {
 		return err
 	}
 
-	conn.Unlock()
+	if _, err := conn.Create(p, data, 0, zk.WorldACL(zk.PermAll)); err != nil && err != zk.ErrNodeExists {
+		return err
+	}
 	return nil
-
 }
 
 // EnsurePath makes sure the specified path exists.
@@ -423,7 +614,11 @@ func (conn *connection) ensurePath(p string) error {
 		conn.ensurePath(parent)
 	}
 
-	conn.CreateEmptyNode(p)
+	// the path may be created concurrently
+	_, err := conn.Create(p, []byte(""), 0, zk.WorldACL(zk.PermAll))
+	if err != nil && err != zk.ErrNodeExists {
+		return err
+	}
 	return nil
 }
 
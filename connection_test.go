@@ -2,8 +2,11 @@ package gohelix
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/yichen/go-zookeeper/zk"
 )
 
 func TestEnsurePath(t *testing.T) {
@@ -33,3 +36,37 @@ func TestEnsurePath(t *testing.T) {
 	}
 
 }
+
+func TestUpdateRecordConcurrently(t *testing.T) {
+	conn := newConnection(testZkSvr)
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Disconnect()
+
+	now := time.Now().Local()
+	p := "/gohelix_connection_test_TestUpdateRecordConcurrently_" + now.Format("20060102150405")
+	data, _ := NewRecord("test").Marshal()
+	if _, err := conn.Create(p, data, 0, zk.WorldACL(zk.PermAll)); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.DeleteTree(p)
+
+	// the updates of the same record do not overwrite each other
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if err := conn.UpdateSimpleField(p, key, "true"); err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprintf("KEY_%d", i))
+	}
+	wg.Wait()
+
+	r, err := conn.GetRecordFromPath(p)
+	if err != nil || len(r.SimpleFields) != 10 {
+		t.Errorf("expect the 10 updates, got %v", r)
+	}
+}
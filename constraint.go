@@ -0,0 +1,236 @@
+package gohelix
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keys of the message constraints. The constraints are the map fields of
+// /<cluster>/CONFIGS/CONSTRAINT/MESSAGE_CONSTRAINT, by constraint ID, for example:
+//
+//	"bootstrap": {
+//	  "MESSAGE_TYPE": "STATE_TRANSITION",
+//	  "TRANSITION": "OFFLINE-SLAVE",
+//	  "INSTANCE": ".*",
+//	  "CONSTRAINT_VALUE": "2"
+//	}
+//
+// limits each instance to two OFFLINE-SLAVE transitions in flight. An attribute value is
+// a regular expression the message must match. A constraint counts the messages of each
+// distinct value of its attributes separately, and the messages of all the values of a
+// missing attribute together. CONSTRAINT_VALUE is the maximum number of messages in
+// flight, or ANY for no limit.
+const (
+	messageConstraintType = "MESSAGE_CONSTRAINT"
+	constraintValueKey    = "CONSTRAINT_VALUE"
+	constraintValueAny    = "ANY"
+)
+
+// constraintAttributes are the attributes a message constraint can have
+var constraintAttributes = []string{"MESSAGE_TYPE", "TRANSITION", "RESOURCE", "PARTITION", "INSTANCE", "STATE_MODEL"}
+
+var (
+	// ErrInvalidConstraint the constraint is not of the form ATTRIBUTE=value,...,CONSTRAINT_VALUE=n
+	ErrInvalidConstraint = errors.New("invalid message constraint")
+)
+
+// messageConstraint limits the number of messages in flight
+type messageConstraint struct {
+	id         string
+	attributes map[string]*regexp.Regexp
+	value      int
+}
+
+// parseConstraint parses a constraint in the form of
+// TRANSITION=OFFLINE-SLAVE,INSTANCE=.*,CONSTRAINT_VALUE=2 into its attributes
+func parseConstraint(spec string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrInvalidConstraint
+		}
+
+		k := strings.ToUpper(strings.TrimSpace(kv[0]))
+		v := strings.TrimSpace(kv[1])
+		if v == "" || (k != constraintValueKey && !contains(constraintAttributes, k)) {
+			return nil, ErrInvalidConstraint
+		}
+		result[k] = v
+	}
+
+	if err := validateConstraint(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// validateConstraint makes sure the constraint has a valid value and valid expressions
+func validateConstraint(attributes map[string]string) error {
+	value, ok := attributes[constraintValueKey]
+	if !ok {
+		return ErrInvalidConstraint
+	}
+
+	if n, err := strconv.Atoi(value); value != constraintValueAny && (err != nil || n < 0) {
+		return ErrInvalidConstraint
+	}
+
+	for k, v := range attributes {
+		if k == constraintValueKey {
+			continue
+		}
+
+		if _, err := regexp.Compile("^(" + v + ")$"); err != nil {
+			return ErrInvalidConstraint
+		}
+	}
+
+	return nil
+}
+
+// formatConstraint is the reverse of parseConstraint
+func formatConstraint(attributes map[string]string) string {
+	pairs := []string{}
+	for _, k := range constraintAttributes {
+		if v, ok := attributes[k]; ok {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+	pairs = append(pairs, constraintValueKey+"="+attributes[constraintValueKey])
+	return strings.Join(pairs, ",")
+}
+
+// getMessageConstraints returns the valid message constraints of the record, sorted by
+// ID. Constraints without limit are left out.
+func getMessageConstraints(record *Record) []messageConstraint {
+	result := []messageConstraint{}
+	if record == nil {
+		return result
+	}
+
+	ids := []string{}
+	for id := range record.MapFields {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		attributes := record.MapFields[id]
+		if err := validateConstraint(attributes); err != nil {
+			Logger.Printf("Ignoring invalid message constraint %s\n", id)
+			continue
+		}
+
+		value, err := strconv.Atoi(attributes[constraintValueKey])
+		if err != nil {
+			continue
+		}
+
+		c := messageConstraint{id, make(map[string]*regexp.Regexp), value}
+		for k, v := range attributes {
+			if k != constraintValueKey {
+				c.attributes[k] = regexp.MustCompile("^(" + v + ")$")
+			}
+		}
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// messageAttributes returns the values of the constraint attributes of a message
+func messageAttributes(message *Record) map[string]string {
+	result := make(map[string]string)
+	for k, field := range map[string]string{
+		"MESSAGE_TYPE": "MSG_TYPE",
+		"RESOURCE":     "RESOURCE_NAME",
+		"PARTITION":    "PARTITION_NAME",
+		"INSTANCE":     "TGT_NAME",
+		"STATE_MODEL":  "STATE_MODEL_DEF",
+	} {
+		result[k], _ = message.GetSimpleField(field).(string)
+	}
+
+	from, _ := message.GetSimpleField("FROM_STATE").(string)
+	to, _ := message.GetSimpleField("TO_STATE").(string)
+	result["TRANSITION"] = from + "-" + to
+
+	return result
+}
+
+// bucket returns the key the message is counted under, or false if the constraint
+// does not apply to the message.
+func (c messageConstraint) bucket(attributes map[string]string) (string, bool) {
+	key := c.id
+	for _, k := range constraintAttributes {
+		re, ok := c.attributes[k]
+		if !ok {
+			continue
+		}
+
+		if !re.MatchString(attributes[k]) {
+			return "", false
+		}
+		key += "," + k + "=" + attributes[k]
+	}
+	return key, true
+}
+
+// throttleMessages returns the messages that can be sent without exceeding the message
+// constraints, in their original order. The pending messages of the snapshot count as
+// in flight.
+func throttleMessages(snapshot *ClusterSnapshot, messages []*Record) []*Record {
+	constraints := getMessageConstraints(snapshot.Constraints[messageConstraintType])
+	if len(constraints) == 0 {
+		return messages
+	}
+
+	inFlight := make(map[string]int)
+	for _, pending := range snapshot.Messages {
+		for _, m := range pending {
+			attributes := messageAttributes(m)
+			for _, c := range constraints {
+				if key, ok := c.bucket(attributes); ok {
+					inFlight[key]++
+				}
+			}
+		}
+	}
+
+	result := []*Record{}
+	for _, m := range messages {
+		attributes := messageAttributes(m)
+
+		keys := []string{}
+		allowed := true
+		for _, c := range constraints {
+			key, ok := c.bucket(attributes)
+			if !ok {
+				continue
+			}
+
+			if inFlight[key] >= c.value {
+				allowed = false
+				break
+			}
+			keys = append(keys, key)
+		}
+
+		if !allowed {
+			continue
+		}
+
+		for _, key := range keys {
+			inFlight[key]++
+		}
+		result = append(result, m)
+	}
+
+	return result
+}
@@ -0,0 +1,76 @@
+package gohelix
+
+import "testing"
+
+func TestParseConstraint(t *testing.T) {
+	t.Parallel()
+
+	c, err := parseConstraint("TRANSITION=OFFLINE-SLAVE, INSTANCE=.*, CONSTRAINT_VALUE=2")
+	if err != nil || c["TRANSITION"] != "OFFLINE-SLAVE" || c["INSTANCE"] != ".*" || c[constraintValueKey] != "2" {
+		t.Error("failed to parse the constraint")
+	}
+
+	if formatConstraint(c) != "TRANSITION=OFFLINE-SLAVE,INSTANCE=.*,CONSTRAINT_VALUE=2" {
+		t.Error("failed to format the constraint: " + formatConstraint(c))
+	}
+
+	for _, spec := range []string{
+		"TRANSITION=OFFLINE-SLAVE",
+		"HOST=h1,CONSTRAINT_VALUE=1",
+		"INSTANCE=(,CONSTRAINT_VALUE=1",
+		"CONSTRAINT_VALUE=-1",
+	} {
+		if _, err := parseConstraint(spec); err != ErrInvalidConstraint {
+			t.Errorf("expect %s to be invalid", spec)
+		}
+	}
+
+	if _, err := parseConstraint("RESOURCE=myDB,CONSTRAINT_VALUE=ANY"); err != nil {
+		t.Error("expect ANY to be a valid constraint value")
+	}
+}
+
+func TestThrottleMessages(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "SEMI_AUTO", 2)
+	for _, p := range partitionNames("myDB", 3) {
+		is.SetListField(p, []string{"h1", "h2"})
+	}
+	s.IdealStates["myDB"] = is
+
+	constraints := NewRecord(messageConstraintType)
+	constraints.SetMapField("bootstrap", "TRANSITION", "OFFLINE-SLAVE")
+	constraints.SetMapField("bootstrap", "INSTANCE", ".*")
+	constraints.SetMapField("bootstrap", constraintValueKey, "2")
+	s.Constraints[messageConstraintType] = constraints
+
+	messages := computeMessages(s, computeBestPossibleStates(s))
+	if len(messages) != 6 {
+		t.Fatalf("expect 6 messages before throttling, got %d", len(messages))
+	}
+
+	// two messages per instance
+	throttled := throttleMessages(s, messages)
+	perInstance := make(map[string]int)
+	for _, m := range throttled {
+		perInstance[m.GetSimpleField("TGT_NAME").(string)]++
+	}
+
+	if len(throttled) != 4 || perInstance["h1"] != 2 || perInstance["h2"] != 2 {
+		t.Errorf("expect two messages per instance: %v", perInstance)
+	}
+
+	// the pending messages count as in flight
+	s.Messages["h1"] = throttled[:1]
+	throttled = throttleMessages(s, messages)
+	perInstance = make(map[string]int)
+	for _, m := range throttled {
+		perInstance[m.GetSimpleField("TGT_NAME").(string)]++
+	}
+
+	if perInstance["h1"] != 1 || perInstance["h2"] != 2 {
+		t.Errorf("expect the pending message to take a slot: %v", perInstance)
+	}
+}
@@ -0,0 +1,849 @@
+package gohelix
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yichen/go-zookeeper/zk"
+)
+
+type controllerState uint8
+
+const (
+	controllerDisconnected controllerState = 0
+	controllerStarted      controllerState = 1
+)
+
+// Keys of the PAUSE and MAINTENANCE signals of the controller, see
+// Admin.EnableMaintenanceMode and Admin.PauseCluster.
+const (
+	signalReasonKey      = "REASON"
+	signalTriggeredByKey = "TRIGGERED_BY"
+	signalTimestampKey   = "TIMESTAMP"
+)
+
+// When STATE_TRANSITION_CANCELLATION_ENABLED is true in the cluster config, the controller
+// cancels the pending transitions that no longer lead to the best possible state, with a
+// STATE_TRANSITION_CANCELLATION message. Only the transitions the participant has not
+// started yet are cancelled.
+const (
+	transitionCancellationEnabledKey = "STATE_TRANSITION_CANCELLATION_ENABLED"
+	cancellationMessageType          = "STATE_TRANSITION_CANCELLATION"
+	cancelledMessageIDKey            = "CANCELLED_MSG_ID"
+)
+
+var (
+	// ErrRebalancerNotRegistered the REBALANCER_CLASS_NAME of a resource is not registered,
+	// see RegisterRebalancer
+	ErrRebalancerNotRegistered = errors.New("rebalancer not registered")
+)
+
+// Controller is the Helix role that manages the state of the cluster. One of the
+// controllers connected to a cluster is elected as the leader through the ephemeral
+// /<cluster>/CONTROLLER/LEADER znode, the others stand by. Whenever the cluster changes,
+// the leader runs its pipeline: it computes the best possible state of each resource
+// with its Rebalancer, sends the state transition messages to the participants, and
+// updates the external views.
+type Controller struct {
+	// HelixManager
+	conn *connection
+
+	// a separate connection for the watches, so that they do not interfere with the
+	// pipeline
+	watchConn *connection
+
+	// zookeeper connection string
+	zkConnStr string
+
+	// The cluster this controller manages
+	ClusterID string
+
+	// ControllerID is the name of this controller
+	ControllerID string
+
+	// RebalanceInterval is the time between two pipeline runs without cluster changes
+	RebalanceInterval time.Duration
+
+	// PurgeInterval is the time between two purges of the old status updates and errors
+	PurgeInterval time.Duration
+
+	// keybuilder
+	keys KeyBuilder
+
+	// whether this controller is the leader
+	leader bool
+
+	// channel to wake up the event loop on cluster changes
+	changes chan struct{}
+	// channel to receive stop controller event
+	stop chan bool
+	// channel closed to stop all the watches and the purger
+	stopWatch chan struct{}
+	// channel closed when the event loop returns
+	done chan struct{}
+
+	// the znodes being watched
+	watched map[string]bool
+
+	// status, guarded by the mutex
+	state controllerState
+
+	sync.Mutex
+}
+
+// Connect the controller to the cluster. The controller takes part in the leader election
+// and runs the pipeline in the background when it is the leader. A controller can connect
+// again after Disconnect.
+func (c *Controller) Connect() error {
+	c.Lock()
+	started := c.state == controllerStarted
+	c.Unlock()
+	if started {
+		return nil
+	}
+
+	c.conn = newConnection(c.zkConnStr)
+	if err := c.conn.Connect(); err != nil {
+		return err
+	}
+
+	if ok, err := c.conn.IsClusterSetup(c.ClusterID); !ok || err != nil {
+		c.conn.Disconnect()
+		return ErrClusterNotSetup
+	}
+
+	c.watchConn = newConnection(c.zkConnStr)
+	if err := c.watchConn.Connect(); err != nil {
+		c.conn.Disconnect()
+		return err
+	}
+
+	// the state is set before the event loop starts, so that a Disconnect that comes
+	// right after stops it. Disconnect closes the channels, so each connection gets its
+	// own.
+	c.Lock()
+	c.state = controllerStarted
+	c.stop = make(chan bool)
+	c.stopWatch = make(chan struct{})
+	c.done = make(chan struct{})
+	c.watched = make(map[string]bool)
+	c.Unlock()
+
+	c.loop()
+	c.purgeLoop()
+	c.notify()
+
+	return nil
+}
+
+// Disconnect the controller from the cluster. If it is the leader, another controller
+// takes over.
+func (c *Controller) Disconnect() {
+	c.Lock()
+	started := c.state == controllerStarted
+	c.state = controllerDisconnected
+	c.Unlock()
+
+	if !started {
+		return
+	}
+
+	// wait for the event loop to return before its connections are closed
+	close(c.stop)
+	<-c.done
+
+	close(c.stopWatch)
+	c.watchConn.Disconnect()
+	c.conn.Disconnect()
+
+	c.Lock()
+	c.leader = false
+	c.Unlock()
+}
+
+// IsLeader tests if this controller is the leader of the cluster
+func (c *Controller) IsLeader() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.leader
+}
+
+// loop is the event loop of the controller. It runs the pipeline on cluster changes,
+// and every RebalanceInterval in case a change was missed.
+func (c *Controller) loop() {
+	stop, done := c.stop, c.done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(c.RebalanceInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.changes:
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+
+			if !c.acquireLeadership() {
+				continue
+			}
+
+			if err := c.rebalance(); err != nil {
+				Logger.Printf("Controller %s failed to rebalance %s: %s\n", c.ControllerID, c.ClusterID, err.Error())
+			}
+		}
+	}()
+}
+
+// notify wakes up the event loop. Changes that arrive while the pipeline is running are
+// coalesced into one more run.
+func (c *Controller) notify() {
+	select {
+	case c.changes <- struct{}{}:
+	default:
+	}
+}
+
+// acquireLeadership tries to become the leader, and returns whether this controller is
+// the leader. The standby controllers watch the leader znode to take over when it is
+// gone.
+func (c *Controller) acquireLeadership() bool {
+	path := c.keys.controllerLeader()
+
+	node := NewLiveInstanceNode(c.ControllerID, c.conn.GetSessionID())
+	data, err := node.Marshal()
+	if err != nil {
+		return false
+	}
+
+	// the leader znode may be gone between a failed create and its read, when the session
+	// of the leader expires, and then the create is tried again
+	leader := false
+	for attempt := 0; attempt < 3; attempt++ {
+		_, err = c.conn.Create(path, data, int32(zk.FlagEphemeral), zk.WorldACL(zk.PermAll))
+		if err == nil {
+			leader = true
+			break
+		}
+		if err != zk.ErrNodeExists {
+			Logger.Printf("Controller %s failed to create %s: %s\n", c.ControllerID, path, err.Error())
+			return false
+		}
+
+		r, err := readRecordIfExists(c.conn, path)
+		if err != nil {
+			Logger.Printf("Controller %s failed to read %s: %s\n", c.ControllerID, path, err.Error())
+			return false
+		}
+		if r != nil {
+			session, _ := r.GetSimpleField("SESSION_ID").(string)
+			leader = r.ID == c.ControllerID && session == c.conn.GetSessionID()
+			break
+		}
+	}
+
+	c.Lock()
+	elected := leader && !c.leader
+	c.leader = leader
+	c.Unlock()
+
+	if elected {
+		c.recordLeadership()
+	}
+
+	c.watch(path, false)
+	return leader
+}
+
+// rebalance runs the controller pipeline once, and records the run
+func (c *Controller) rebalance() error {
+	start := time.Now()
+	sent, err := c.runPipeline()
+	c.recordPipelineRun(start, sent, err)
+	return err
+}
+
+// runPipeline runs the controller pipeline and returns the messages it sent
+func (c *Controller) runPipeline() ([]*Record, error) {
+	snapshot, err := readClusterSnapshot(c.conn, c.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	// start the delay window of the instances that went offline unnoticed
+	if err := snapshot.stampOfflineTimes(c.conn); err != nil {
+		return nil, err
+	}
+
+	// and disable the instances that reconnect too often
+	snapshot.trackSessions(c.conn)
+
+	assignments := computeBestPossibleStates(snapshot)
+	messages := computeMessages(snapshot, assignments)
+	messages = append(messages, computeCancellations(snapshot, assignments)...)
+
+	// no partition movement while the cluster is paused or in maintenance
+	if snapshot.isFrozen() {
+		messages = frozenMessages(messages)
+	}
+
+	sent := []*Record{}
+	for _, m := range throttleMessages(snapshot, messages) {
+		if err := c.sendMessage(m); err != nil {
+			Logger.Printf("Failed to send message %s: %s\n", m.ID, err.Error())
+			continue
+		}
+		sent = append(sent, m)
+	}
+
+	if err := c.updateExternalViews(snapshot); err != nil {
+		return nil, err
+	}
+
+	c.watchCluster(snapshot)
+	return sent, nil
+}
+
+// sendMessage writes a message to the message queue of its target instance
+func (c *Controller) sendMessage(message *Record) error {
+	message.SetSimpleField("SRC_NAME", c.ControllerID)
+	message.SetSimpleField("SRC_SESSION_ID", c.conn.GetSessionID())
+
+	target, _ := message.GetSimpleField("TGT_NAME").(string)
+	path := c.keys.message(target, message.ID)
+
+	data, err := message.Marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.conn.Create(path, data, 0, zk.WorldACL(zk.PermAll))
+	return err
+}
+
+// updateExternalViews writes the external views that changed, and removes the ones of
+// the resources without replicas.
+func (c *Controller) updateExternalViews(snapshot *ClusterSnapshot) error {
+	existing := make(map[string]*Record)
+	if err := readRecords(c.conn, c.keys.externalView(), existing); err != nil {
+		return err
+	}
+
+	for _, resource := range snapshot.resources() {
+		ev := computeExternalView(snapshot, resource)
+		if ev == nil {
+			continue
+		}
+
+		if old, ok := existing[resource]; ok && reflect.DeepEqual(old.SimpleFields, ev.SimpleFields) && reflect.DeepEqual(old.MapFields, ev.MapFields) {
+			delete(existing, resource)
+			continue
+		}
+		delete(existing, resource)
+
+		if err := c.conn.SetRecordForPath(c.keys.externalViewForResource(resource), ev); err != nil {
+			return err
+		}
+	}
+
+	for resource := range existing {
+		if err := c.conn.DeleteTree(c.keys.externalViewForResource(resource)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// watchCluster watches the znodes that trigger the pipeline: the ideal states, the
+// instance configs, the live instances and their messages, which are removed when the
+// transitions complete.
+func (c *Controller) watchCluster(snapshot *ClusterSnapshot) {
+	c.watch(c.keys.clusterConfig(), false)
+	c.watch(c.keys.idealStates(), true)
+	c.watch(c.keys.participantConfigs(), true)
+	c.watch(c.keys.liveInstances(), true)
+
+	for resource := range snapshot.IdealStates {
+		c.watch(c.keys.idealStateForResource(resource), false)
+	}
+
+	for instance := range snapshot.InstanceConfigs {
+		c.watch(c.keys.participantConfig(instance), false)
+	}
+
+	for instance := range snapshot.LiveInstances {
+		c.watch(c.keys.messages(instance), true)
+	}
+}
+
+// watch notifies the event loop when the znode, or its list of children, changes. The
+// watch lasts until the znode is deleted or the controller disconnects. A znode is only
+// watched once at a time.
+func (c *Controller) watch(path string, children bool) {
+	c.Lock()
+	watched, stopWatch, conn := c.watched, c.stopWatch, c.watchConn
+	if watched[path] {
+		c.Unlock()
+		return
+	}
+	watched[path] = true
+	c.Unlock()
+
+	go func() {
+		defer func() {
+			c.Lock()
+			delete(watched, path)
+			c.Unlock()
+		}()
+
+		for {
+			var events <-chan zk.Event
+			var err error
+
+			if children {
+				_, _, events, err = conn.zkConn.ChildrenW(path)
+			} else {
+				_, _, events, err = conn.zkConn.GetW(path)
+			}
+
+			if err != nil {
+				return
+			}
+
+			select {
+			case evt := <-events:
+				c.notify()
+				if evt.Type == zk.EventNodeDeleted || evt.Err != nil {
+					return
+				}
+			case <-stopWatch:
+				return
+			}
+		}
+	}()
+}
+
+// resources returns the resources with an ideal state or with replicas, sorted
+func (s *ClusterSnapshot) resources() []string {
+	seen := make(map[string]bool)
+	for r := range s.IdealStates {
+		seen[r] = true
+	}
+	for _, resources := range s.CurrentStates {
+		for r := range resources {
+			seen[r] = true
+		}
+	}
+
+	result := []string{}
+	for r := range seen {
+		result = append(result, r)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// computeBestPossibleStates computes the assignment of each resource. Resources whose
+// rebalancer fails are left out, so their replicas stay as they are. The rebalancers keep
+// the replicas in ERROR as they are, so while the cluster is frozen they are reset to the
+// initial state instead, the only movement frozenMessages lets through.
+func computeBestPossibleStates(snapshot *ClusterSnapshot) map[string]*ResourceAssignment {
+	result := make(map[string]*ResourceAssignment)
+
+	for _, resource := range snapshot.resources() {
+		assignment, err := computeResourceAssignment(snapshot, resource)
+		if err != nil {
+			Logger.Printf("Failed to rebalance resource %s: %s\n", resource, err.Error())
+			continue
+		}
+		if snapshot.isFrozen() {
+			resetErrorReplicas(snapshot, resource, assignment)
+		}
+		result[resource] = assignment
+	}
+
+	return result
+}
+
+// resetErrorReplicas targets the initial state for the replicas in ERROR that the
+// assignment keeps in ERROR.
+func resetErrorReplicas(snapshot *ClusterSnapshot, resource string, assignment *ResourceAssignment) {
+	stateModelDef, err := snapshot.stateModelDefOf(resource)
+	if err != nil {
+		return
+	}
+
+	for p := range assignment.Partitions {
+		for instance, state := range assignment.GetStates(p) {
+			if state == errorState && snapshot.CurrentState(instance, resource, p) == errorState {
+				assignment.SetState(p, instance, initialState(stateModelDef))
+			}
+		}
+	}
+}
+
+// computeResourceAssignment computes the assignment of a resource with its rebalancer.
+// The replicas of a disabled resource are brought back to the initial state, and the
+// replicas of a resource without an ideal state are dropped.
+func computeResourceAssignment(snapshot *ClusterSnapshot, resource string) (*ResourceAssignment, error) {
+	is, ok := snapshot.IdealStates[resource]
+
+	if ok && is.GetBooleanField("HELIX_ENABLED", true) {
+		rebalancer, ok := getRebalancer(is, snapshot.ResourceConfigs[resource])
+		if !ok {
+			return nil, ErrRebalancerNotRegistered
+		}
+		return rebalancer.ComputeAssignment(is, snapshot)
+	}
+
+	state := droppedState
+	if ok {
+		stateModelDef, err := snapshot.stateModelDefOf(resource)
+		if err != nil {
+			return nil, err
+		}
+		state = initialState(stateModelDef)
+	}
+
+	result := NewResourceAssignment(resource)
+	for instance, resources := range snapshot.CurrentStates {
+		if cs, ok := resources[resource]; ok {
+			for p := range cs.MapFields {
+				if snapshot.CurrentState(instance, resource, p) != droppedState {
+					result.SetState(p, instance, state)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// replicaKey identifies the replica of a partition on an instance
+type replicaKey struct {
+	instance  string
+	resource  string
+	partition string
+}
+
+// pendingTransitions maps the replicas with a pending state transition message to the
+// target state of the message.
+func pendingTransitions(snapshot *ClusterSnapshot) map[replicaKey]string {
+	result := make(map[replicaKey]string)
+
+	for instance, messages := range snapshot.Messages {
+		for _, m := range messages {
+			if t, _ := m.GetSimpleField("MSG_TYPE").(string); t != "STATE_TRANSITION" {
+				continue
+			}
+
+			resource, _ := m.GetSimpleField("RESOURCE_NAME").(string)
+			partition, _ := m.GetSimpleField("PARTITION_NAME").(string)
+			toState, _ := m.GetSimpleField("TO_STATE").(string)
+			result[replicaKey{instance, resource, partition}] = toState
+		}
+	}
+
+	return result
+}
+
+// computeMessages returns the state transition messages that bring the replicas one
+// step closer to their best possible states. Replicas with a pending message get no new
+// message. A transition into a state with a count is held back while the state is full,
+// counting the replicas in the state and the ones on their way to it, so that for example
+// a new MASTER is only promoted after the old one has stepped down. The messages of a
+// partition are ordered by the transition priorities of the state model. The source of
+// the messages is set when they are sent.
+func computeMessages(snapshot *ClusterSnapshot, assignments map[string]*ResourceAssignment) []*Record {
+	result := []*Record{}
+	pending := pendingTransitions(snapshot)
+
+	resources := []string{}
+	for r := range assignments {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+
+	for _, resource := range resources {
+		assignment := assignments[resource]
+
+		stateModelDef, err := snapshot.stateModelDefOf(resource)
+		if err != nil {
+			Logger.Printf("No state model definition for resource %s\n", resource)
+			continue
+		}
+
+		replicas := 0
+		if is, ok := snapshot.IdealStates[resource]; ok {
+			replicas = getReplicas(is, snapshot)
+		}
+
+		partitions := []string{}
+		for p := range assignment.Partitions {
+			partitions = append(partitions, p)
+		}
+		sort.Strings(partitions)
+
+		for _, p := range partitions {
+			result = append(result, computePartitionMessages(snapshot, stateModelDef, resource, p, assignment.GetStates(p), replicas, pending)...)
+		}
+	}
+
+	return result
+}
+
+// computePartitionMessages computes the messages of one partition, see computeMessages
+func computePartitionMessages(snapshot *ClusterSnapshot, stateModelDef *Record, resource string, partition string, targets map[string]string, replicas int, pending map[replicaKey]string) []*Record {
+	current := snapshot.CurrentStateMap(resource, partition)
+
+	if replicas <= 0 {
+		for _, state := range targets {
+			if state != droppedState {
+				replicas++
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, state := range current {
+		counts[state]++
+	}
+	for key, state := range pending {
+		if key.resource == resource && key.partition == partition {
+			counts[state]++
+		}
+	}
+
+	transitions := byTransitionPriority{stateModelDef: stateModelDef}
+
+	instances := []string{}
+	for i := range targets {
+		instances = append(instances, i)
+	}
+	sort.Strings(instances)
+
+	for _, i := range instances {
+		if !snapshot.IsLive(i) {
+			continue
+		}
+
+		if _, ok := pending[replicaKey{i, resource, partition}]; ok {
+			continue
+		}
+
+		from, ok := current[i]
+		if !ok {
+			from = initialState(stateModelDef)
+		}
+
+		target := targets[i]
+		if from == target || (!ok && target == droppedState) {
+			continue
+		}
+
+		to := nextState(stateModelDef, from, target)
+		if to == "" {
+			continue
+		}
+
+		transitions.list = append(transitions.list, transition{i, from, to})
+	}
+
+	sort.Stable(transitions)
+
+	result := []*Record{}
+	for _, t := range transitions.list {
+		count := stateCount(stateModelDef, t.to, replicas, len(snapshot.LiveInstances))
+		if t.to != droppedState && count >= 0 && counts[t.to] >= count {
+			continue
+		}
+		counts[t.to]++
+
+		result = append(result, newStateTransitionMessage(snapshot, stateModelDef, resource, partition, t))
+	}
+
+	return result
+}
+
+// computeCancellations returns the cancellation messages of the pending transitions that
+// no longer lead to the best possible states, when the cancellation is enabled.
+func computeCancellations(snapshot *ClusterSnapshot, assignments map[string]*ResourceAssignment) []*Record {
+	result := []*Record{}
+	if !snapshot.ClusterConfig.GetBooleanField(transitionCancellationEnabledKey, false) {
+		return result
+	}
+
+	instances := []string{}
+	for i := range snapshot.Messages {
+		instances = append(instances, i)
+	}
+	sort.Strings(instances)
+
+	for _, instance := range instances {
+		cancelled := make(map[string]bool)
+		for _, m := range snapshot.Messages[instance] {
+			if id, ok := m.GetSimpleField(cancelledMessageIDKey).(string); ok {
+				cancelled[id] = true
+			}
+		}
+
+		for _, m := range snapshot.Messages[instance] {
+			msgType, _ := m.GetSimpleField("MSG_TYPE").(string)
+			msgState, _ := m.GetSimpleField("MSG_STATE").(string)
+			if msgType != "STATE_TRANSITION" || !strings.EqualFold(msgState, "NEW") || cancelled[m.ID] {
+				continue
+			}
+
+			resource, _ := m.GetSimpleField("RESOURCE_NAME").(string)
+			partition, _ := m.GetSimpleField("PARTITION_NAME").(string)
+			from, _ := m.GetSimpleField("FROM_STATE").(string)
+			to, _ := m.GetSimpleField("TO_STATE").(string)
+
+			assignment, ok := assignments[resource]
+			if !ok {
+				continue
+			}
+
+			target, ok := assignment.GetStates(partition)[instance]
+			if !ok {
+				continue
+			}
+
+			stateModelDef, err := snapshot.stateModelDefOf(resource)
+			if err != nil || (from != target && nextState(stateModelDef, from, target) == to) {
+				continue
+			}
+
+			cancellation := newStateTransitionMessage(snapshot, stateModelDef, resource, partition, transition{instance, from, to})
+			cancellation.SetSimpleField("MSG_TYPE", cancellationMessageType)
+			cancellation.SetSimpleField(cancelledMessageIDKey, m.ID)
+			result = append(result, cancellation)
+		}
+	}
+
+	return result
+}
+
+// frozenMessages keeps the messages that are allowed while the cluster is paused or in
+// maintenance: the resets of the replicas in ERROR and the cancellations.
+func frozenMessages(messages []*Record) []*Record {
+	result := []*Record{}
+	for _, m := range messages {
+		msgType, _ := m.GetSimpleField("MSG_TYPE").(string)
+		from, _ := m.GetSimpleField("FROM_STATE").(string)
+
+		if msgType == cancellationMessageType || from == errorState {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// transition is a state transition of the replica on an instance
+type transition struct {
+	instance string
+	from     string
+	to       string
+}
+
+// byTransitionPriority sorts the transitions by the priorities of the state model
+type byTransitionPriority struct {
+	stateModelDef *Record
+	list          []transition
+}
+
+func (b byTransitionPriority) Len() int      { return len(b.list) }
+func (b byTransitionPriority) Swap(i, j int) { b.list[i], b.list[j] = b.list[j], b.list[i] }
+func (b byTransitionPriority) Less(i, j int) bool {
+	return transitionPriority(b.stateModelDef, b.list[i].from, b.list[i].to) < transitionPriority(b.stateModelDef, b.list[j].from, b.list[j].to)
+}
+
+// newStateTransitionMessage creates the message of a transition, see
+// Participant.processMessage for an example.
+func newStateTransitionMessage(snapshot *ClusterSnapshot, stateModelDef *Record, resource string, partition string, t transition) *Record {
+	id := newMessageID()
+	sessionID, _ := snapshot.LiveInstances[t.instance].GetSimpleField("SESSION_ID").(string)
+
+	factory := "DEFAULT"
+	if cs, ok := snapshot.CurrentStates[t.instance][resource]; ok {
+		if f, ok := cs.GetSimpleField("STATE_MODEL_FACTORY_NAME").(string); ok && f != "" {
+			factory = f
+		}
+	}
+
+	m := NewRecord(id)
+	m.SetSimpleField("MSG_ID", id)
+	m.SetSimpleField("MSG_TYPE", "STATE_TRANSITION")
+	m.SetSimpleField("MSG_STATE", "new")
+	m.SetSimpleField("CREATE_TIMESTAMP", strconv.FormatInt(time.Now().UnixNano()/1000000, 10))
+	m.SetSimpleField("FROM_STATE", t.from)
+	m.SetSimpleField("TO_STATE", t.to)
+	m.SetSimpleField("PARTITION_NAME", partition)
+	m.SetSimpleField("RESOURCE_NAME", resource)
+	m.SetSimpleField("STATE_MODEL_DEF", stateModelDef.ID)
+	m.SetSimpleField("STATE_MODEL_FACTORY_NAME", factory)
+	m.SetSimpleField("TGT_NAME", t.instance)
+	m.SetSimpleField("TGT_SESSION_ID", sessionID)
+
+	return m
+}
+
+// newMessageID generates a random UUID for a message
+func newMessageID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	// version 4, variant 10
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// computeExternalView builds the external view of a resource from the current states of
+// the live instances. It returns nil if the resource has no replicas left.
+func computeExternalView(snapshot *ClusterSnapshot, resource string) *Record {
+	ev := NewRecord(resource)
+
+	for instance, resources := range snapshot.CurrentStates {
+		cs, ok := resources[resource]
+		if !ok {
+			continue
+		}
+
+		for p := range cs.MapFields {
+			if state := snapshot.CurrentState(instance, resource, p); state != "" && state != droppedState {
+				ev.SetMapField(p, instance, state)
+			}
+		}
+	}
+
+	is, ok := snapshot.IdealStates[resource]
+	if !ok && len(ev.MapFields) == 0 {
+		return nil
+	}
+
+	if ok {
+		for _, k := range []string{"NUM_PARTITIONS", "REPLICAS", "REBALANCE_MODE", "STATE_MODEL_DEF_REF", "BUCKET_SIZE"} {
+			if v, ok := is.GetSimpleField(k).(string); ok {
+				ev.SetSimpleField(k, v)
+			}
+		}
+	}
+
+	return ev
+}
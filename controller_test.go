@@ -0,0 +1,489 @@
+package gohelix
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestSnapshot creates a snapshot of a cluster with the MasterSlave state model. The
+// live instances get the session ID of their name.
+func newTestSnapshot(instances []string, live []string) *ClusterSnapshot {
+	s := &ClusterSnapshot{
+		ClusterID:       "MYCLUSTER",
+		ClusterConfig:   NewRecord("MYCLUSTER"),
+		IdealStates:     make(map[string]*Record),
+		ResourceConfigs: make(map[string]*Record),
+		LiveInstances:   make(map[string]*Record),
+		InstanceConfigs: make(map[string]*Record),
+		CurrentStates:   make(map[string]map[string]*Record),
+		Messages:        make(map[string][]*Record),
+		StateModelDefs:  make(map[string]*Record),
+		Constraints:     make(map[string]*Record),
+		OfflineTimes:    make(map[string]int64),
+		Time:            time.Now(),
+	}
+
+	def, _ := NewRecordFromBytes([]byte(HelixDefaultNodes["MasterSlave"]))
+	s.StateModelDefs["MasterSlave"] = def
+
+	for _, i := range instances {
+		s.InstanceConfigs[i] = NewRecord(i)
+	}
+
+	for _, i := range live {
+		li := NewRecord(i)
+		li.SetSimpleField("SESSION_ID", i)
+		s.LiveInstances[i] = li
+		s.CurrentStates[i] = make(map[string]*Record)
+	}
+
+	return s
+}
+
+// setCurrentState sets the current state of a replica in the snapshot
+func setCurrentState(s *ClusterSnapshot, instance string, resource string, partition string, state string) {
+	cs, ok := s.CurrentStates[instance][resource]
+	if !ok {
+		cs = NewRecord(resource)
+		cs.SetSimpleField("STATE_MODEL_DEF", "MasterSlave")
+		s.CurrentStates[instance][resource] = cs
+	}
+	cs.SetMapField(partition, "CURRENT_STATE", state)
+}
+
+func newTestIdealState(resource string, mode string, replicas int) *Record {
+	is := NewRecord(resource)
+	is.SetSimpleField("REBALANCE_MODE", mode)
+	is.SetSimpleField("STATE_MODEL_DEF_REF", "MasterSlave")
+	is.SetIntField("REPLICAS", replicas)
+	return is
+}
+
+func TestComputeMessages(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "SEMI_AUTO", 2)
+	is.SetListField("myDB_0", []string{"h1", "h2"})
+	s.IdealStates["myDB"] = is
+
+	// both replicas start with the transition to SLAVE
+	messages := computeMessages(s, computeBestPossibleStates(s))
+	if len(messages) != 2 {
+		t.Fatalf("expect 2 messages, got %d", len(messages))
+	}
+
+	for _, m := range messages {
+		if m.GetSimpleField("FROM_STATE") != "OFFLINE" || m.GetSimpleField("TO_STATE") != "SLAVE" {
+			t.Error("expect OFFLINE to SLAVE transitions")
+		}
+		if m.GetSimpleField("TGT_SESSION_ID") != m.GetSimpleField("TGT_NAME") {
+			t.Error("expect the message to target the session of the live instance")
+		}
+	}
+
+	// no new message while the transitions are pending
+	s.Messages["h1"] = []*Record{messages[0]}
+	s.Messages["h2"] = []*Record{messages[1]}
+	if messages := computeMessages(s, computeBestPossibleStates(s)); len(messages) != 0 {
+		t.Error("expect no message for the replicas with pending messages")
+	}
+
+	// then the first instance of the preference list is promoted
+	s.Messages = make(map[string][]*Record)
+	setCurrentState(s, "h1", "myDB", "myDB_0", "SLAVE")
+	setCurrentState(s, "h2", "myDB", "myDB_0", "SLAVE")
+
+	messages = computeMessages(s, computeBestPossibleStates(s))
+	if len(messages) != 1 || messages[0].GetSimpleField("TGT_NAME") != "h1" || messages[0].GetSimpleField("TO_STATE") != "MASTER" {
+		t.Error("expect h1 to be promoted to MASTER")
+	}
+}
+
+func TestComputeMessagesMasterHandoff(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "SEMI_AUTO", 2)
+	is.SetListField("myDB_0", []string{"h2", "h1"})
+	s.IdealStates["myDB"] = is
+
+	setCurrentState(s, "h1", "myDB", "myDB_0", "MASTER")
+	setCurrentState(s, "h2", "myDB", "myDB_0", "SLAVE")
+
+	// the old master steps down before the new one is promoted
+	messages := computeMessages(s, computeBestPossibleStates(s))
+	if len(messages) != 1 || messages[0].GetSimpleField("TGT_NAME") != "h1" || messages[0].GetSimpleField("TO_STATE") != "SLAVE" {
+		t.Fatal("expect only h1 to step down to SLAVE")
+	}
+
+	setCurrentState(s, "h1", "myDB", "myDB_0", "SLAVE")
+	messages = computeMessages(s, computeBestPossibleStates(s))
+	if len(messages) != 1 || messages[0].GetSimpleField("TGT_NAME") != "h2" || messages[0].GetSimpleField("TO_STATE") != "MASTER" {
+		t.Error("expect h2 to be promoted to MASTER")
+	}
+}
+
+func TestFrozenMessages(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "SEMI_AUTO", 1)
+	is.SetListField("myDB_0", []string{"h2"})
+	s.IdealStates["myDB"] = is
+
+	// the replica in ERROR moved from h1 to h2
+	setCurrentState(s, "h1", "myDB", "myDB_0", "ERROR")
+
+	// only the reset of the replica in ERROR is allowed in maintenance
+	messages := frozenMessages(computeMessages(s, computeBestPossibleStates(s)))
+	if len(messages) != 1 || messages[0].GetSimpleField("TGT_NAME") != "h1" || messages[0].GetSimpleField("FROM_STATE") != "ERROR" {
+		t.Error("expect only the reset of h1")
+	}
+}
+
+func TestFrozenErrorReset(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "SEMI_AUTO", 2)
+	is.SetListField("myDB_0", []string{"h1", "h2"})
+	s.IdealStates["myDB"] = is
+	setCurrentState(s, "h1", "myDB", "myDB_0", "ERROR")
+	setCurrentState(s, "h2", "myDB", "myDB_0", "SLAVE")
+
+	// the replica in ERROR stays in ERROR until the cluster is frozen
+	for _, m := range computeMessages(s, computeBestPossibleStates(s)) {
+		if m.GetSimpleField("TGT_NAME") == "h1" {
+			t.Fatal("expect no message for the replica in ERROR")
+		}
+	}
+
+	s.Maintenance = NewRecord("maintenance")
+	if !s.isFrozen() {
+		t.Fatal("expect the cluster to be frozen")
+	}
+
+	// the replica in ERROR is reset, while the SLAVE is not promoted
+	messages := frozenMessages(computeMessages(s, computeBestPossibleStates(s)))
+	if len(messages) != 1 || messages[0].GetSimpleField("TGT_NAME") != "h1" ||
+		messages[0].GetSimpleField("FROM_STATE") != "ERROR" || messages[0].GetSimpleField("TO_STATE") != "OFFLINE" {
+		t.Errorf("expect only the reset of h1, got %d messages", len(messages))
+	}
+}
+
+func TestComputeCancellations(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "SEMI_AUTO", 1)
+	is.SetListField("myDB_0", []string{"h1"})
+	s.IdealStates["myDB"] = is
+
+	// h2 was about to get a replica that moved to h1
+	m := NewRecord("m1")
+	m.SetSimpleField("MSG_TYPE", "STATE_TRANSITION")
+	m.SetSimpleField("MSG_STATE", "new")
+	m.SetSimpleField("RESOURCE_NAME", "myDB")
+	m.SetSimpleField("PARTITION_NAME", "myDB_0")
+	m.SetSimpleField("FROM_STATE", "OFFLINE")
+	m.SetSimpleField("TO_STATE", "SLAVE")
+	s.Messages["h2"] = []*Record{m}
+	setCurrentState(s, "h2", "myDB", "myDB_0", "OFFLINE")
+
+	if len(computeCancellations(s, computeBestPossibleStates(s))) != 0 {
+		t.Error("expect no cancellation when it is not enabled")
+	}
+
+	s.ClusterConfig.SetBooleanField(transitionCancellationEnabledKey, true)
+	cancellations := computeCancellations(s, computeBestPossibleStates(s))
+	if len(cancellations) != 1 || cancellations[0].GetSimpleField(cancelledMessageIDKey) != "m1" {
+		t.Fatal("expect the transition on h2 to be cancelled")
+	}
+
+	// the cancellation is sent once
+	s.Messages["h2"] = append(s.Messages["h2"], cancellations[0])
+	if len(computeCancellations(s, computeBestPossibleStates(s))) != 0 {
+		t.Error("expect no new cancellation")
+	}
+}
+
+func TestComputeResourceAssignment(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1"}, []string{"h1"})
+	setCurrentState(s, "h1", "myDB", "myDB_0", "MASTER")
+
+	// the replicas of a resource without ideal state are dropped
+	a, err := computeResourceAssignment(s, "myDB")
+	if err != nil || a.GetStates("myDB_0")["h1"] != droppedState {
+		t.Error("expect the replica of the dropped resource to be dropped")
+	}
+
+	// and those of a disabled resource go back to the initial state
+	is := newTestIdealState("myDB", "SEMI_AUTO", 1)
+	is.SetListField("myDB_0", []string{"h1"})
+	is.SetBooleanField("HELIX_ENABLED", false)
+	s.IdealStates["myDB"] = is
+
+	a, err = computeResourceAssignment(s, "myDB")
+	if err != nil || a.GetStates("myDB_0")["h1"] != "OFFLINE" {
+		t.Error("expect the replica of the disabled resource to be OFFLINE")
+	}
+}
+
+func TestRegisterRebalancer(t *testing.T) {
+	t.Parallel()
+
+	RegisterRebalancer("TestRegisterRebalancer", RebalancerFunc(func(is *Record, s *ClusterSnapshot) (*ResourceAssignment, error) {
+		a := NewResourceAssignment(is.ID)
+		a.SetState("myDB_0", "h2", "MASTER")
+		return a, nil
+	}))
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "FULL_AUTO", 1)
+	is.SetSimpleField(rebalancerClassNameKey, "TestRegisterRebalancer")
+	s.IdealStates["myDB"] = is
+
+	a, err := computeResourceAssignment(s, "myDB")
+	if err != nil || a.GetStates("myDB_0")["h2"] != "MASTER" {
+		t.Error("expect the registered rebalancer to be used")
+	}
+
+	is.SetSimpleField(rebalancerClassNameKey, "com.example.UnknownRebalancer")
+	if _, err := computeResourceAssignment(s, "myDB"); err != ErrRebalancerNotRegistered {
+		t.Error("expect ErrRebalancerNotRegistered")
+	}
+}
+
+func TestFullAutoRebalance(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2", "h3"}, []string{"h1", "h2", "h3"})
+	is := newTestIdealState("myDB", "FULL_AUTO", 2)
+	is.SetIntField("NUM_PARTITIONS", 3)
+	s.IdealStates["myDB"] = is
+
+	a, err := computeResourceAssignment(s, "myDB")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	masters := make(map[string]int)
+	for _, p := range partitionNames("myDB", 3) {
+		counts := make(map[string]int)
+		for i, state := range a.GetStates(p) {
+			counts[state]++
+			if state == "MASTER" {
+				masters[i]++
+			}
+		}
+
+		if counts["MASTER"] != 1 || counts["SLAVE"] != 1 {
+			t.Errorf("partition %s should have one MASTER and one SLAVE: %v", p, a.GetStates(p))
+		}
+	}
+
+	if len(masters) != 3 {
+		t.Errorf("expect the masters to be spread over the instances: %v", masters)
+	}
+}
+
+func TestComputeExternalView(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	setCurrentState(s, "h1", "myDB", "myDB_0", "MASTER")
+	setCurrentState(s, "h2", "myDB", "myDB_0", "DROPPED")
+
+	ev := computeExternalView(s, "myDB")
+	if ev == nil || ev.GetMapField("myDB_0", "h1") != "MASTER" || ev.GetMapField("myDB_0", "h2") != "" {
+		t.Error("expect the external view to have the replicas that are not dropped")
+	}
+
+	setCurrentState(s, "h1", "myDB", "myDB_0", "DROPPED")
+	if computeExternalView(s, "myDB") != nil {
+		t.Error("expect no external view for a dropped resource without replicas")
+	}
+}
+
+func TestControllerConnect(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "controller_test_TestControllerConnect_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	manager := NewHelixManager(testZkSvr)
+	c1 := manager.NewController(cluster, "controller1")
+	c2 := manager.NewController(cluster, "controller2")
+
+	if err := c1.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	if err := c2.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Disconnect()
+	time.Sleep(time.Second)
+
+	if !c1.IsLeader() || c2.IsLeader() {
+		t.Error("expect the first controller to be the leader")
+	}
+
+	// the standby controller takes over when the leader is gone
+	c1.Disconnect()
+	time.Sleep(2 * time.Second)
+
+	if !c2.IsLeader() {
+		t.Error("expect the standby controller to take over")
+	}
+}
+
+func TestControllerDisconnectAfterConnect(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "controller_test_TestControllerDisconnectAfterConnect_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	// a controller that never connected has nothing to disconnect
+	manager := NewHelixManager(testZkSvr)
+	manager.NewController(cluster, "controller0").Disconnect()
+
+	// the event loop is stopped even if it has not run yet
+	for i := 0; i < 10; i++ {
+		c := manager.NewController(cluster, fmt.Sprintf("controller%d", i+1))
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		c.Disconnect()
+
+		select {
+		case <-c.done:
+		default:
+			t.Fatal("expect the event loop to return")
+		}
+		c.Disconnect()
+	}
+
+	// and a controller connects again after it disconnected
+	c := manager.NewController(cluster, "controller11")
+	for i := 0; i < 2; i++ {
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Second)
+		if !c.IsLeader() {
+			t.Error("expect the reconnected controller to be the leader")
+		}
+		c.Disconnect()
+	}
+}
+
+func TestDisabledPartition(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "SEMI_AUTO", 2)
+	is.SetListField("myDB_0", []string{"h1", "h2"})
+	is.SetListField("myDB_1", []string{"h1", "h2"})
+	s.IdealStates["myDB"] = is
+
+	setCurrentState(s, "h1", "myDB", "myDB_0", "MASTER")
+	setCurrentState(s, "h1", "myDB", "myDB_1", "MASTER")
+	setPartitionsDisabled(s.InstanceConfigs["h1"], "myDB", []string{"myDB_0"}, true)
+
+	a, err := computeResourceAssignment(s, "myDB")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.GetStates("myDB_0")["h1"] != "OFFLINE" || a.GetStates("myDB_0")["h2"] != "MASTER" {
+		t.Error("expect the disabled partition to move its master to h2")
+	}
+	if a.GetStates("myDB_1")["h1"] != "MASTER" {
+		t.Error("expect the other partitions to stay on h1")
+	}
+
+	setPartitionsDisabled(s.InstanceConfigs["h1"], "myDB", []string{"myDB_0"}, false)
+	if _, ok := s.InstanceConfigs["h1"].MapFields[disabledPartitionKey]; ok {
+		t.Error("expect no disabled partition left")
+	}
+}
+
+func TestInstanceGroupTag(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2", "h3", "h4"}, []string{"h1", "h2", "h3", "h4"})
+	setInstanceTag(s.InstanceConfigs["h1"], "SSD", true)
+	setInstanceTag(s.InstanceConfigs["h3"], "SSD", true)
+	setInstanceTag(s.InstanceConfigs["h3"], "HDD", true)
+	setInstanceTag(s.InstanceConfigs["h3"], "HDD", false)
+
+	is := newTestIdealState("myDB", "FULL_AUTO", 2)
+	is.SetIntField("NUM_PARTITIONS", 4)
+	is.SetSimpleField(instanceGroupTagKey, "SSD")
+	s.IdealStates["myDB"] = is
+
+	a, err := computeResourceAssignment(s, "myDB")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range s.Partitions("myDB") {
+		states := a.GetStates(p)
+		if len(states) != 2 || states["h1"] == "" || states["h3"] == "" {
+			t.Errorf("expect partition %s on the SSD instances only, got %v", p, states)
+		}
+	}
+
+	if tags := instanceTags(s.InstanceConfigs["h3"]); len(tags) != 1 || tags[0] != "SSD" {
+		t.Error("expect h3 to be tagged SSD only")
+	}
+
+	is.SetSimpleField("REPLICAS", "ANY_LIVEINSTANCE")
+	if getReplicas(is, s) != 2 {
+		t.Error("expect ANY_LIVEINSTANCE to count the tagged instances")
+	}
+}
+
+func TestEvacuatingInstanceReplicas(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "FULL_AUTO", 1)
+	is.SetIntField("NUM_PARTITIONS", 1)
+	s.IdealStates["myDB"] = is
+
+	setCurrentState(s, "h1", "myDB", "myDB_0", "MASTER")
+	s.InstanceConfigs["h1"].SetSimpleField(instanceOperationKey, evacuateOperation)
+
+	// h1 keeps its replica, and the only MASTER, while the one on h2 is bootstrapped
+	a, err := computeResourceAssignment(s, "myDB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GetStates("myDB_0")["h1"] != "MASTER" || a.GetStates("myDB_0")["h2"] != "SLAVE" {
+		t.Errorf("expect h1 to keep the MASTER until h2 is up, got %v", a.GetStates("myDB_0"))
+	}
+
+	setCurrentState(s, "h2", "myDB", "myDB_0", "SLAVE")
+	a, err = computeResourceAssignment(s, "myDB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GetStates("myDB_0")["h1"] != droppedState || a.GetStates("myDB_0")["h2"] != "MASTER" {
+		t.Errorf("expect h1 to hand the MASTER off once h2 is up, got %v", a.GetStates("myDB_0"))
+	}
+}
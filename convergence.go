@@ -0,0 +1,148 @@
+package gohelix
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PartitionMismatch is a partition whose external view does not match its best possible
+// state, the states the controller computes from the ideal state, by instance
+type PartitionMismatch struct {
+	Resource  string
+	Partition string
+	Expected  map[string]string
+	Actual    map[string]string
+	Problems  []string
+}
+
+// ConvergenceReport lists the partitions that have not converged, by resource and
+// partition, see Admin.WaitForConvergence
+type ConvergenceReport struct {
+	Cluster    string
+	Mismatches []*PartitionMismatch
+}
+
+// Converged tests if the external views match the best possible states
+func (r *ConvergenceReport) Converged() bool {
+	return len(r.Mismatches) == 0
+}
+
+// computeConvergence compares the external views of the resources with their best
+// possible states and with the state model constraints. Replicas in the external view
+// must be on live instances. All the resources with an ideal state are compared if
+// resources is empty.
+func computeConvergence(snapshot *ClusterSnapshot, externalViews map[string]*Record, resources []string) *ConvergenceReport {
+	report := &ConvergenceReport{Cluster: snapshot.ClusterID, Mismatches: []*PartitionMismatch{}}
+
+	if len(resources) == 0 {
+		resources = sortedKeys(snapshot.IdealStates)
+	}
+
+	for _, resource := range resources {
+		assignment, err := computeResourceAssignment(snapshot, resource)
+		if err != nil {
+			report.Mismatches = append(report.Mismatches, &PartitionMismatch{
+				Resource: resource,
+				Problems: []string{"no best possible state: " + err.Error()},
+			})
+			continue
+		}
+
+		ev := externalViews[resource]
+		if ev == nil {
+			ev = NewRecord(resource)
+		}
+
+		partitions := []string{}
+		for p := range assignment.Partitions {
+			partitions = append(partitions, p)
+		}
+		for p := range ev.MapFields {
+			if _, ok := assignment.Partitions[p]; !ok {
+				partitions = append(partitions, p)
+			}
+		}
+		sort.Strings(partitions)
+
+		for _, p := range partitions {
+			if m := comparePartition(snapshot, resource, p, assignment.GetStates(p), ev.MapFields[p]); m != nil {
+				report.Mismatches = append(report.Mismatches, m)
+			}
+		}
+	}
+
+	return report
+}
+
+// comparePartition compares the states of a partition in the external view with its best
+// possible states. It returns nil if they match.
+func comparePartition(snapshot *ClusterSnapshot, resource string, partition string, bestPossible map[string]string, actual map[string]string) *PartitionMismatch {
+	expected := make(map[string]string)
+	for instance, state := range bestPossible {
+		if state != droppedState {
+			expected[instance] = state
+		}
+	}
+	if actual == nil {
+		actual = make(map[string]string)
+	}
+
+	m := &PartitionMismatch{
+		Resource:  resource,
+		Partition: partition,
+		Expected:  expected,
+		Actual:    actual,
+		Problems:  []string{},
+	}
+
+	instances := []string{}
+	for i := range expected {
+		instances = append(instances, i)
+	}
+	for i := range actual {
+		if _, ok := expected[i]; !ok {
+			instances = append(instances, i)
+		}
+	}
+	sort.Strings(instances)
+
+	// a replica that is not in the external view is dropped
+	for _, i := range instances {
+		state, ok := actual[i]
+		if !ok {
+			state = droppedState
+		}
+
+		switch want, assigned := bestPossible[i]; {
+		case ok && !snapshot.IsLive(i):
+			m.Problems = append(m.Problems, fmt.Sprintf("%s on %s that is not live", state, i))
+		case !assigned:
+			// replicas left out of the best possible state are left as they are
+		case state != want:
+			m.Problems = append(m.Problems, fmt.Sprintf("%s on %s, expected %s", state, i, want))
+		}
+	}
+
+	if stateModelDef, err := snapshot.stateModelDefOf(resource); err == nil {
+		replicas := len(expected)
+		if is, ok := snapshot.IdealStates[resource]; ok && getReplicas(is, snapshot) > 0 {
+			replicas = getReplicas(is, snapshot)
+		}
+
+		counts := make(map[string]int)
+		for _, state := range actual {
+			counts[state]++
+		}
+		for _, state := range statePriorities(stateModelDef) {
+			if bound := stateCount(stateModelDef, state, replicas, len(snapshot.LiveInstances)); bound >= 0 && counts[state] > bound {
+				m.Problems = append(m.Problems, fmt.Sprintf("%d %s replicas, at most %d", counts[state], state, bound))
+			}
+		}
+	}
+
+	if len(m.Problems) == 0 {
+		return nil
+	}
+	sort.Strings(m.Problems)
+	return m
+}
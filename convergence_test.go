@@ -0,0 +1,58 @@
+package gohelix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeConvergence(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2", "h3"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "SEMI_AUTO", 2)
+	is.SetListField("myDB_0", []string{"h1", "h2"})
+	s.IdealStates["myDB"] = is
+
+	ev := NewRecord("myDB")
+	ev.SetMapField("myDB_0", "h1", "MASTER")
+	ev.SetMapField("myDB_0", "h2", "SLAVE")
+	views := map[string]*Record{"myDB": ev}
+
+	if r := computeConvergence(s, views, nil); !r.Converged() {
+		t.Errorf("expect the cluster to have converged: %v", r.Mismatches[0].Problems)
+	}
+
+	problems := func() []string {
+		r := computeConvergence(s, views, []string{"myDB"})
+		if r.Converged() {
+			return nil
+		}
+		return r.Mismatches[0].Problems
+	}
+
+	ev.SetMapField("myDB_0", "h2", "MASTER")
+	expected := []string{"2 MASTER replicas, at most 1", "MASTER on h2, expected SLAVE"}
+	if p := problems(); !reflect.DeepEqual(p, expected) {
+		t.Errorf("expect %v, got %v", expected, p)
+	}
+
+	ev.SetMapField("myDB_0", "h2", "SLAVE")
+	ev.SetMapField("myDB_0", "h3", "SLAVE")
+	expected = []string{"SLAVE on h3 that is not live"}
+	if p := problems(); !reflect.DeepEqual(p, expected) {
+		t.Errorf("expect %v, got %v", expected, p)
+	}
+
+	// a replica missing from the external view is dropped
+	delete(ev.MapFields["myDB_0"], "h3")
+	delete(ev.MapFields["myDB_0"], "h2")
+	expected = []string{"DROPPED on h2, expected SLAVE"}
+	if p := problems(); !reflect.DeepEqual(p, expected) {
+		t.Errorf("expect %v, got %v", expected, p)
+	}
+
+	// a dropped resource without external view has converged
+	if r := computeConvergence(s, views, []string{"otherDB"}); !r.Converged() {
+		t.Error("expect the dropped resource to have converged")
+	}
+}
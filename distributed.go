@@ -0,0 +1,117 @@
+package gohelix
+
+import (
+	"sync"
+)
+
+// superClusterStateModel is the state model of the clusters managed by distributed
+// controllers, see DistributedController
+const superClusterStateModel = "LeaderStandby"
+
+// DistributedController runs the controllers of many clusters in a single process. The
+// distributed controllers join a super cluster as participants. Each managed cluster is
+// a partition of the super cluster with the LeaderStandby state model, see
+// Admin.ActivateCluster, and the distributed controller that becomes the LEADER of a
+// partition runs the controller of that cluster.
+//
+// The distributed controllers also take part in the leader election of the super cluster
+// itself, so no standalone controller is needed.
+type DistributedController struct {
+	manager *HelixManager
+
+	// the super cluster the controller joins
+	SuperClusterID string
+
+	// ControllerID is the participant ID of the controller in the super cluster, host_port
+	ControllerID string
+
+	// the participant of the super cluster
+	participant *Participant
+
+	// the controller of the super cluster
+	superController *Controller
+
+	// the controllers of the managed clusters this controller leads, by cluster
+	controllers map[string]*Controller
+
+	sync.Mutex
+}
+
+// Connect joins the super cluster
+func (d *DistributedController) Connect() error {
+	d.superController = d.manager.NewController(d.SuperClusterID, d.ControllerID)
+	if err := d.superController.Connect(); err != nil {
+		return err
+	}
+
+	sm := NewStateModel([]Transition{
+		{"OFFLINE", "STANDBY", func(cluster string) {}},
+		{"STANDBY", "LEADER", d.startController},
+		{"LEADER", "STANDBY", d.stopController},
+		{"STANDBY", "OFFLINE", d.stopController},
+		{"OFFLINE", "DROPPED", func(cluster string) {}},
+	})
+	d.participant.RegisterStateModel(superClusterStateModel, sm)
+
+	if err := d.participant.Connect(); err != nil {
+		d.superController.Disconnect()
+		return err
+	}
+
+	return nil
+}
+
+// Disconnect leaves the super cluster and stops the controllers of the managed clusters,
+// the other distributed controllers take over.
+func (d *DistributedController) Disconnect() {
+	d.participant.Disconnect()
+
+	d.Lock()
+	for cluster, c := range d.controllers {
+		c.Disconnect()
+		delete(d.controllers, cluster)
+	}
+	d.Unlock()
+
+	d.superController.Disconnect()
+}
+
+// Clusters returns the clusters this controller is the LEADER of
+func (d *DistributedController) Clusters() []string {
+	d.Lock()
+	defer d.Unlock()
+
+	result := []string{}
+	for cluster := range d.controllers {
+		result = append(result, cluster)
+	}
+	return result
+}
+
+// startController starts the controller of a managed cluster, on STANDBY to LEADER
+func (d *DistributedController) startController(cluster string) {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, ok := d.controllers[cluster]; ok {
+		return
+	}
+
+	c := d.manager.NewController(cluster, d.ControllerID)
+	if err := c.Connect(); err != nil {
+		Logger.Printf("Failed to start the controller of cluster %s: %s\n", cluster, err.Error())
+		return
+	}
+	d.controllers[cluster] = c
+}
+
+// stopController stops the controller of a managed cluster, on LEADER to STANDBY
+func (d *DistributedController) stopController(cluster string) {
+	d.Lock()
+	defer d.Unlock()
+
+	if c, ok := d.controllers[cluster]; ok {
+		c.Disconnect()
+		delete(d.controllers, cluster)
+	}
+}
@@ -0,0 +1,41 @@
+package gohelix
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDistributedController(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	superCluster := "distributed_test_TestDistributedController_super_" + now.Format("20060102150405")
+	cluster := "distributed_test_TestDistributedController_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	a.AddCluster(superCluster)
+	defer a.DropCluster(superCluster)
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	a.AddNode(superCluster, "localhost_9000")
+	if err := a.ActivateCluster(cluster, superCluster, true); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewHelixManager(testZkSvr)
+	d := manager.NewDistributedController(superCluster, "localhost", "9000")
+	if err := d.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Disconnect()
+
+	// the controller goes OFFLINE-STANDBY-LEADER for the cluster
+	for i := 0; i < 10 && len(d.Clusters()) == 0; i++ {
+		time.Sleep(time.Second)
+	}
+
+	if clusters := d.Clusters(); len(clusters) != 1 || clusters[0] != cluster {
+		t.Error("expect the distributed controller to lead the cluster")
+	}
+}
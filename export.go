@@ -0,0 +1,211 @@
+package gohelix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ClusterDefinition holds the definition of a cluster: its configs, instances, ideal
+// states and state model definitions, but not its runtime state such as the live
+// instances and the current states. See Admin.ExportCluster and Admin.ImportCluster.
+type ClusterDefinition struct {
+	Cluster         string             `json:"cluster"`
+	ClusterConfig   *Record            `json:"clusterConfig"`
+	StateModelDefs  map[string]*Record `json:"stateModelDefs"`
+	Instances       map[string]*Record `json:"instances"`
+	ResourceConfigs map[string]*Record `json:"resourceConfigs"`
+	IdealStates     map[string]*Record `json:"idealStates"`
+	Constraints     map[string]*Record `json:"constraints"`
+}
+
+// Formats of a cluster definition, see ClusterDefinition.Marshal
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Marshal generates the beautified json or yaml of the cluster definition, see
+// NewClusterDefinitionFromBytes. The yaml document has the same keys as the json one.
+func (d *ClusterDefinition) Marshal(format string) ([]byte, error) {
+	data, err := json.MarshalIndent(d, "", "    ")
+	if err != nil || format == FormatJSON {
+		return data, err
+	}
+
+	if format != FormatYAML {
+		return nil, ErrInvalidFormat
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// NewClusterDefinitionFromBytes reads a cluster definition in json or yaml
+func NewClusterDefinitionFromBytes(data []byte) (*ClusterDefinition, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if data, err = json.Marshal(fromYAML(doc)); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &ClusterDefinition{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// fromYAML converts the maps of a yaml document to the ones of a json document
+func fromYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{})
+		for k, item := range v {
+			result[fmt.Sprint(k)] = fromYAML(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromYAML(item)
+		}
+	}
+	return v
+}
+
+// ConflictMode tells Admin.ImportCluster what to do with the records that already exist
+// and differ from the ones of the cluster definition
+type ConflictMode string
+
+// ConflictFail imports nothing if any record conflicts. ConflictOverwrite replaces the
+// existing records. ConflictMerge keeps the fields of the existing records that are not
+// in the cluster definition, and the map field entries.
+const (
+	ConflictFail      ConflictMode = "fail"
+	ConflictOverwrite ConflictMode = "overwrite"
+	ConflictMerge     ConflictMode = "merge"
+)
+
+// ImportReport lists the paths of the records an import created or updated, and the
+// ones that conflict in the ConflictFail mode
+type ImportReport struct {
+	Created   []string
+	Updated   []string
+	Conflicts []string
+}
+
+// definitionRecords maps the paths of the records of the cluster definition to the
+// records, for the given cluster
+func (d *ClusterDefinition) definitionRecords(cluster string) map[string]*Record {
+	keys := KeyBuilder{cluster}
+	result := make(map[string]*Record)
+
+	if d.ClusterConfig != nil {
+		config := copyRecord(d.ClusterConfig)
+		config.ID = cluster
+		result[keys.clusterConfig()] = config
+	}
+
+	for name, r := range d.StateModelDefs {
+		result[keys.stateModel(name)] = r
+	}
+	for name, r := range d.Instances {
+		result[keys.participantConfig(name)] = r
+	}
+	for name, r := range d.ResourceConfigs {
+		result[keys.resourceConfig(name)] = r
+	}
+	for name, r := range d.IdealStates {
+		result[keys.idealStateForResource(name)] = r
+	}
+	for name, r := range d.Constraints {
+		result[keys.constraint(name)] = r
+	}
+
+	return result
+}
+
+// copyRecord makes a deep copy of a record
+func copyRecord(r *Record) *Record {
+	data, _ := json.Marshal(r)
+	result, _ := NewRecordFromBytes(data)
+	return result
+}
+
+// recordsEqual tests if two records have the same content
+func recordsEqual(a *Record, b *Record) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+// mergeRecords returns a copy of the existing record updated with the fields of the
+// other record. Map fields are merged by entry.
+func mergeRecords(existing *Record, other *Record) *Record {
+	result := copyRecord(existing)
+
+	for k, v := range other.SimpleFields {
+		result.SetSimpleField(k, v)
+	}
+	for k := range other.ListFields {
+		result.SetListField(k, other.GetListField(k))
+	}
+	for k, m := range other.MapFields {
+		for property, v := range m {
+			result.SetMapField(k, property, v)
+		}
+	}
+
+	return result
+}
+
+// planImport computes the records to write for the conflict mode, by path
+func planImport(existing map[string]*Record, records map[string]*Record, mode ConflictMode) (map[string]*Record, *ImportReport) {
+	writes := make(map[string]*Record)
+	report := &ImportReport{
+		Created:   []string{},
+		Updated:   []string{},
+		Conflicts: []string{},
+	}
+
+	for path, r := range records {
+		current, ok := existing[path]
+		if !ok {
+			writes[path] = r
+			report.Created = append(report.Created, path)
+			continue
+		}
+
+		if mode == ConflictMerge {
+			r = mergeRecords(current, r)
+		}
+		if recordsEqual(current, r) {
+			continue
+		}
+
+		if mode == ConflictFail {
+			report.Conflicts = append(report.Conflicts, path)
+			continue
+		}
+
+		writes[path] = r
+		report.Updated = append(report.Updated, path)
+	}
+
+	sort.Strings(report.Created)
+	sort.Strings(report.Updated)
+	sort.Strings(report.Conflicts)
+	return writes, report
+}
@@ -0,0 +1,74 @@
+package gohelix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClusterDefinitionFormats(t *testing.T) {
+	t.Parallel()
+
+	is := NewRecord("myDB")
+	is.SetIntField("NUM_PARTITIONS", 2)
+	is.SetSimpleField("REBALANCE_MODE", "SEMI_AUTO")
+	is.SetListField("myDB_0", []string{"h1", "h2"})
+	is.SetMapField("myDB_1", "h1", "MASTER")
+
+	d := &ClusterDefinition{
+		Cluster:       "MYCLUSTER",
+		ClusterConfig: NewRecord("MYCLUSTER"),
+		IdealStates:   map[string]*Record{"myDB": is},
+	}
+
+	for _, format := range []string{FormatJSON, FormatYAML} {
+		data, err := d.Marshal(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := NewClusterDefinitionFromBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := read.IdealStates["myDB"]
+		if read.Cluster != "MYCLUSTER" || r == nil || !recordsEqual(r, is) {
+			t.Errorf("expect the %s definition to read back", format)
+		}
+	}
+
+	if _, err := d.Marshal("xml"); err != ErrInvalidFormat {
+		t.Error("expect ErrInvalidFormat")
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	t.Parallel()
+
+	existing := NewRecord("h1")
+	existing.SetSimpleField("HELIX_HOST", "h1")
+	existing.SetMapField("HELIX_DISABLED_PARTITION", "myDB", "myDB_0")
+
+	imported := NewRecord("h1")
+	imported.SetSimpleField("HELIX_HOST", "h1.example.com")
+	imported.SetMapField("HELIX_DISABLED_PARTITION", "otherDB", "otherDB_0")
+
+	current := map[string]*Record{"/c/h1": existing, "/c/h2": NewRecord("h2")}
+	records := map[string]*Record{"/c/h1": imported, "/c/h2": NewRecord("h2"), "/c/h3": NewRecord("h3")}
+
+	_, report := planImport(current, records, ConflictFail)
+	if !reflect.DeepEqual(report.Conflicts, []string{"/c/h1"}) || !reflect.DeepEqual(report.Created, []string{"/c/h3"}) {
+		t.Errorf("expect h1 to conflict and h3 to be created, got %v", report)
+	}
+
+	writes, report := planImport(current, records, ConflictOverwrite)
+	if !reflect.DeepEqual(report.Updated, []string{"/c/h1"}) || writes["/c/h1"] != imported {
+		t.Error("expect h1 to be overwritten")
+	}
+
+	writes, _ = planImport(current, records, ConflictMerge)
+	merged := writes["/c/h1"]
+	if merged.GetSimpleField("HELIX_HOST") != "h1.example.com" || merged.GetMapField("HELIX_DISABLED_PARTITION", "myDB") != "myDB_0" {
+		t.Error("expect h1 to be merged")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/yichen/gohelix"
+)
+
+// helix -z localhost:2181 apply -f cluster.yaml --prune
+//
+// The pruned instances are dropped once they are evacuated; an instance that is still
+// evacuating, or still running, is dropped by applying again.
+func applyHelixClusterSpec(c *cli.Context) {
+	data, err := ioutil.ReadFile(c.String("file"))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	spec, err := gohelix.NewClusterSpecFromBytes(data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	admin, err := gohelix.NewAdminClient(c.GlobalString("zkSvr"))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer admin.Close()
+
+	plan, err := admin.PlanCluster(spec, c.Bool("prune"))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	if len(plan.Actions) == 0 {
+		fmt.Printf("Cluster %s matches the spec\n", plan.Cluster)
+		return
+	}
+
+	fmt.Printf("Plan for cluster %s:\n", plan.Cluster)
+	for _, action := range plan.Actions {
+		fmt.Println("  " + action.Description)
+	}
+
+	if c.Bool("dryRun") {
+		return
+	}
+
+	plan.Timeout = time.Duration(c.Int("timeout")) * time.Second
+	if err := admin.ApplyPlan(plan); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Println("Applied")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/codegangsta/cli"
+	"github.com/yichen/gohelix"
+)
+
+// helix -z localhost:2181 doctor --fix MYCLUSTER
+func doctorHelixCluster(c *cli.Context) {
+	admin := gohelix.Admin{c.GlobalString("zkSvr")}
+	report, err := admin.VerifyCluster(c.Args().First(), c.Bool("fix"))
+	if report != nil {
+		printVerifyReport(report)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+func printVerifyReport(report *gohelix.VerifyReport) {
+	if len(report.Findings) == 0 {
+		fmt.Printf("Cluster %s is healthy\n", report.Cluster)
+		return
+	}
+
+	for _, f := range report.Findings {
+		status := ""
+		if f.Fixed {
+			status = " (fixed)"
+		} else if !f.Fixable {
+			status = " (not fixable)"
+		}
+		fmt.Printf("%-7s %s: %s%s\n", f.Severity, f.Path, f.Problem, status)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/yichen/gohelix"
+)
+
+// helix -z localhost:2181 evacuate --wait MYCLUSTER localhost_12913
+func startHelixEvacuation(c *cli.Context) {
+	cluster, instance := c.Args().Get(0), c.Args().Get(1)
+	admin, err := gohelix.NewAdminClient(c.GlobalString("zkSvr"))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer admin.Close()
+
+	if err := admin.EvacuateInstance(cluster, instance); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	for {
+		progress, err := admin.GetEvacuationProgress(cluster, instance)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		printEvacuationProgress(progress)
+		if progress.Done() || !c.Bool("wait") {
+			return
+		}
+
+		time.Sleep(time.Duration(c.Int("interval")) * time.Second)
+	}
+}
+
+func printEvacuationProgress(progress *gohelix.EvacuationProgress) {
+	if progress.Done() {
+		fmt.Printf("%s is evacuated\n", progress.Instance)
+		return
+	}
+
+	remaining := 0
+	for _, partitions := range progress.Remaining {
+		remaining += len(partitions)
+	}
+
+	sole := 0
+	for _, partitions := range progress.SoleReplicas {
+		sole += len(partitions)
+	}
+
+	fmt.Printf("%s holds %d replicas, %d partitions have no other active replica\n", progress.Instance, remaining, sole)
+}
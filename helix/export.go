@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/codegangsta/cli"
+	"github.com/yichen/gohelix"
+)
+
+// helix -z localhost:2181 exportCluster --format yaml MYCLUSTER > mycluster.yaml
+func exportHelixCluster(c *cli.Context) {
+	admin := gohelix.Admin{c.GlobalString("zkSvr")}
+	d, err := admin.ExportCluster(c.Args().First())
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	data, err := d.Marshal(c.String("format"))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// helix -z localhost:2181 importCluster -f mycluster.yaml --cluster STAGING --mode merge
+func importHelixCluster(c *cli.Context) {
+	data, err := ioutil.ReadFile(c.String("file"))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	d, err := gohelix.NewClusterDefinitionFromBytes(data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	admin := gohelix.Admin{c.GlobalString("zkSvr")}
+	report, err := admin.ImportCluster(c.String("cluster"), d, gohelix.ConflictMode(c.String("mode")))
+	if report != nil {
+		printImportReport(report)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+func printImportReport(report *gohelix.ImportReport) {
+	for _, path := range report.Created {
+		fmt.Println("created   " + path)
+	}
+	for _, path := range report.Updated {
+		fmt.Println("updated   " + path)
+	}
+	for _, path := range report.Conflicts {
+		fmt.Println("conflicts " + path)
+	}
+}
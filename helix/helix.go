@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/yichen/gohelix"
@@ -68,6 +69,40 @@ func main() {
 				}
 			},
 		},
+		{
+			Name:  "repairCluster",
+			Usage: "helix -z <zk> repairCluster [--dryRun] <cluster>, complete or remove the partial structures of a cluster",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dryRun",
+					Usage: "list the znodes to create and remove without changing them",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 1); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				report, err := admin.RepairCluster(c.Args().First(), c.Bool("dryRun"))
+				if err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				if report.Empty() {
+					fmt.Println("Nothing to repair")
+					return
+				}
+				for _, p := range report.Created {
+					fmt.Println("create " + p)
+				}
+				for _, p := range report.Removed {
+					fmt.Println("remove " + p)
+				}
+			},
+		},
 		{
 			Name:  "addNode",
 			Usage: "add a node to cluster",
@@ -95,6 +130,12 @@ func main() {
 		{
 			Name:  "dropNode",
 			Usage: "drop a node from cluster",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "drop the node even if it is live or assigned partitions",
+				},
+			},
 			Action: func(c *cli.Context) {
 				if err := mustArgc(c, 2); err != nil {
 					fmt.Println(err.Error())
@@ -108,7 +149,13 @@ func main() {
 					node = strings.Replace(node, ":", "_", 1)
 				}
 
-				if err := admin.DropNode(cluster, node); err != nil {
+				var err error
+				if c.Bool("force") {
+					err = admin.DropNodeForce(cluster, node)
+				} else {
+					err = admin.DropNode(cluster, node)
+				}
+				if err != nil {
 					fmt.Println(err.Error())
 				}
 			},
@@ -135,6 +182,102 @@ func main() {
 				}
 			},
 		},
+		{
+			Name:  "dropResource",
+			Usage: "helix -z <zk> dropResource [--wait <seconds>] <cluster> <resource>",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "wait",
+					Usage: "disable the resource and wait up to the seconds for its replicas to be dropped",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 2); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				cluster, resource := c.Args().Get(0), c.Args().Get(1)
+
+				var err error
+				if wait := c.Int("wait"); wait > 0 {
+					err = admin.DropResourceAndWait(cluster, resource, time.Duration(wait)*time.Second)
+				} else {
+					err = admin.DropResource(cluster, resource)
+				}
+				if err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "addStateModelDef",
+			Usage: "helix -z <zk> addStateModelDef <cluster> <name> -i <initial state> --state <state>=<count>... --transition <from>-<to>...",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "initialState, i",
+					Value: "OFFLINE",
+					Usage: "initial state",
+				},
+				cli.StringSliceFlag{
+					Name:  "state",
+					Usage: "state and its count: a number, R for the replicas, N for the live instances or -1, from the highest priority to the lowest",
+				},
+				cli.StringSliceFlag{
+					Name:  "transition",
+					Usage: "transition, from the most urgent to the least",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 2); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				addHelixStateModelDef(c)
+			},
+		},
+		{
+			Name:  "listStateModelDefs",
+			Usage: "list the state model definitions of a cluster",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 1); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				names, err := admin.ListStateModelDefs(c.Args().First())
+				if err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				for _, name := range names {
+					fmt.Println(name)
+				}
+			},
+		},
+		{
+			Name:  "getStateModelDef",
+			Usage: "helix -z <zk> getStateModelDef <cluster> <name>",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 2); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				def, err := admin.GetStateModelDef(c.Args().Get(0), c.Args().Get(1))
+				if err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				printStateModelDef(def)
+			},
+		},
 		{
 			Name:  "enableResource",
 			Usage: "enable a resource",
@@ -169,6 +312,278 @@ func main() {
 				}
 			},
 		},
+		{
+			Name:  "activateCluster",
+			Usage: "let the distributed controllers of a super cluster manage a cluster",
+			Action: func(c *cli.Context) {
+				if len(c.Args()) != 2 && len(c.Args()) != 3 {
+					fmt.Println("Wrong number of arguments")
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				cluster := c.Args().Get(0)
+				superCluster := c.Args().Get(1)
+				enable := true
+				if len(c.Args()) == 3 {
+					var err error
+					if enable, err = strconv.ParseBool(c.Args().Get(2)); err != nil {
+						fmt.Println("Invalid parameter")
+						return
+					}
+				}
+
+				if err := admin.ActivateCluster(cluster, superCluster, enable); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "enableInstance",
+			Usage: "enable an instance",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 2); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				if err := admin.EnableInstance(c.Args().Get(0), c.Args().Get(1)); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "disableInstance",
+			Usage: "disable an instance, its replicas are moved to other instances",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 2); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				if err := admin.DisableInstance(c.Args().Get(0), c.Args().Get(1)); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "enablePartitions",
+			Usage: "helix -z <zk> enablePartitions <cluster> <instance> <resource> <partition>...",
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 4 {
+					fmt.Println("Wrong number of arguments")
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				args := []string(c.Args())
+				if err := admin.EnablePartitions(args[0], args[1], args[2], args[3:]); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "disablePartitions",
+			Usage: "helix -z <zk> disablePartitions <cluster> <instance> <resource> <partition>...",
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 4 {
+					fmt.Println("Wrong number of arguments")
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				args := []string(c.Args())
+				if err := admin.DisablePartitions(args[0], args[1], args[2], args[3:]); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "addInstanceTag",
+			Usage: "helix -z <zk> addInstanceTag <cluster> <instance> <tag>",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 3); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				if err := admin.AddInstanceTag(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2)); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "removeInstanceTag",
+			Usage: "helix -z <zk> removeInstanceTag <cluster> <instance> <tag>",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 3); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				if err := admin.RemoveInstanceTag(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2)); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "setInstanceGroupTag",
+			Usage: "helix -z <zk> setInstanceGroupTag <cluster> <resource> [tag], restrict a resource to the instances with the tag",
+			Action: func(c *cli.Context) {
+				if len(c.Args()) != 2 && len(c.Args()) != 3 {
+					fmt.Println("Wrong number of arguments")
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				if err := admin.SetResourceInstanceGroupTag(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2)); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "swapInstance",
+			Usage: "helix -z <zk> swapInstance [--dryRun] <cluster> <old instance> <new instance>, replace a dead instance",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dryRun",
+					Usage: "list the resources to change without changing them",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 3); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				resources, err := admin.SwapInstance(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2), c.Bool("dryRun"))
+				if err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				for _, r := range resources {
+					fmt.Println(r)
+				}
+			},
+		},
+		{
+			Name:  "evacuate",
+			Usage: "helix -z <zk> evacuate [--wait] <cluster> <instance>, move all the replicas off an instance",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "wait",
+					Usage: "wait until the instance is evacuated",
+				},
+				cli.IntFlag{
+					Name:  "interval",
+					Value: 5,
+					Usage: "seconds between the progress reports when waiting",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 2); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				startHelixEvacuation(c)
+			},
+		},
+		{
+			Name:  "rebalance",
+			Usage: "assign the partitions of a resource to the instances",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 3); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				cluster := c.Args().Get(0)
+				resource := c.Args().Get(1)
+				replicas, err := strconv.Atoi(c.Args().Get(2))
+				if err != nil {
+					fmt.Println("Invalid parameter")
+					return
+				}
+
+				if err := admin.Rebalance(cluster, resource, replicas); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "enableMaintenanceMode",
+			Usage: "freeze the partition movement in a cluster",
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 2 {
+					fmt.Println("Wrong number of arguments")
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				cluster := c.Args().Get(0)
+				reason := strings.Join(c.Args()[1:], " ")
+
+				if err := admin.EnableMaintenanceMode(cluster, reason); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "disableMaintenanceMode",
+			Usage: "let the controller move partitions again",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 1); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				if err := admin.DisableMaintenanceMode(c.Args().Get(0)); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "pauseCluster",
+			Usage: "pause the controller of a cluster",
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 2 {
+					fmt.Println("Wrong number of arguments")
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				cluster := c.Args().Get(0)
+				reason := strings.Join(c.Args()[1:], " ")
+
+				if err := admin.PauseCluster(cluster, reason); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "resumeCluster",
+			Usage: "resume the controller of a paused cluster",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 1); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				if err := admin.ResumeCluster(c.Args().Get(0)); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
 		{
 			Name:  "listClusterInfo",
 			Usage: "list existing cluster resources and instances",
@@ -182,7 +597,7 @@ func main() {
 				if err != nil {
 					fmt.Println(err.Error())
 				} else {
-					fmt.Println(info)
+					printClusterInfo(info)
 				}
 			},
 		},
@@ -200,7 +615,7 @@ func main() {
 					fmt.Println(err.Error())
 					return
 				}
-				fmt.Println(clusters)
+				printNames("Existing clusters", clusters)
 			},
 		},
 		{
@@ -217,7 +632,7 @@ func main() {
 					fmt.Println(err.Error())
 					return
 				}
-				fmt.Println(resources)
+				printNames("Existing resources in cluster "+cluster, resources)
 			},
 		},
 		{
@@ -234,7 +649,7 @@ func main() {
 					fmt.Println(err.Error())
 					return
 				}
-				fmt.Println(instances)
+				printNames("Existing instances in cluster "+cluster, instances)
 			},
 		},
 		{
@@ -254,31 +669,70 @@ func main() {
 					fmt.Println(err.Error())
 					return
 				}
-				fmt.Println(info)
+				printInstanceConfig(info)
 			},
 		},
 		{
 			Name:  "setConfig",
-			Usage: "configure the helix cluster",
+			Usage: "helix -z <zk> setConfig <scope> <cluster> [<scope keys>] <key>=<value>...",
 			Action: func(c *cli.Context) {
-				if err := mustArgc(c, 3); err != nil {
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				scope, cluster, scopeKeys, args, err := configArgs(c)
+				if err != nil {
 					fmt.Println(err.Error())
 					return
 				}
 
-				scope := c.Args().Get(0)
+				properties := map[string]string{}
+				for _, arg := range args {
+					configTuple := strings.SplitN(arg, "=", 2)
+					if len(configTuple) != 2 {
+						fmt.Println("Config must be in the form of key=value")
+						return
+					}
+					properties[strings.TrimSpace(configTuple[0])] = strings.TrimSpace(configTuple[1])
+				}
+
+				if err := admin.SetConfig(cluster, scope, properties, scopeKeys...); err != nil {
+					fmt.Println(err.Error())
+				}
+			},
+		},
+		{
+			Name:  "getConfig",
+			Usage: "helix -z <zk> getConfig <scope> <cluster> [<scope keys>] <key>...",
+			Action: func(c *cli.Context) {
 				admin := gohelix.Admin{c.GlobalString("zkSvr")}
-				if strings.ToLower(scope) != "cluster" {
-					fmt.Println("Not supported")
+				scope, cluster, scopeKeys, keys, err := configArgs(c)
+				if err != nil {
+					fmt.Println(err.Error())
 					return
 				}
 
-				cluster := c.Args().Get(1)
-				configTuple := strings.Split(c.Args().Get(2), "=")
-				properties := map[string]string{}
-				properties[strings.TrimSpace(configTuple[0])] = strings.TrimSpace(configTuple[1])
-				if err := admin.SetConfig(cluster, scope, properties); err != nil {
-					panic(err)
+				properties, err := admin.GetConfig(cluster, scope, keys, scopeKeys...)
+				if err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				for _, k := range keys {
+					fmt.Printf("%s=%s\n", k, properties[k])
+				}
+			},
+		},
+		{
+			Name:  "removeConfig",
+			Usage: "helix -z <zk> removeConfig <scope> <cluster> [<scope keys>] <key>...",
+			Action: func(c *cli.Context) {
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				scope, cluster, scopeKeys, keys, err := configArgs(c)
+				if err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				if err := admin.RemoveConfig(cluster, scope, keys, scopeKeys...); err != nil {
+					fmt.Println(err.Error())
 				}
 			},
 		},
@@ -309,6 +763,209 @@ func main() {
 				startHelixParticipant(c.GlobalString("zkSvr"), cluster, host, port, stateModel)
 			},
 		},
+		{
+			Name:  "controller",
+			Usage: "helix -z <zk> controller -c <cluster> -n <name> [-m distributed]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "cluster, c",
+					Usage: "cluster name, or the super cluster in distributed mode",
+				},
+				cli.StringFlag{
+					Name:  "name, n",
+					Usage: "controller name, host_port in distributed mode",
+				},
+				cli.StringFlag{
+					Name:  "mode, m",
+					Value: "standalone",
+					Usage: "standalone or distributed",
+				},
+			},
+			Action: func(c *cli.Context) {
+				cluster := c.String("cluster")
+				name := c.String("name")
+
+				switch strings.ToLower(c.String("mode")) {
+				case "standalone":
+					startHelixController(c.GlobalString("zkSvr"), cluster, name)
+				case "distributed":
+					startHelixDistributedController(c.GlobalString("zkSvr"), cluster, name)
+				default:
+					fmt.Println("Invalid mode " + c.String("mode"))
+				}
+			},
+		},
+		{
+			Name:  "exportSnapshot",
+			Usage: "print the cluster data the controller works on, as json",
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 1); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				admin := gohelix.Admin{c.GlobalString("zkSvr")}
+				snapshot, err := admin.GetClusterSnapshot(c.Args().Get(0))
+				if err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				data, err := snapshot.Marshal()
+				if err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+				fmt.Println(string(data))
+			},
+		},
+		{
+			Name:  "exportCluster",
+			Usage: "helix -z <zk> exportCluster [--format json|yaml] <cluster>, print the definition of a cluster",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Value: gohelix.FormatJSON,
+					Usage: "json or yaml",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 1); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				exportHelixCluster(c)
+			},
+		},
+		{
+			Name:  "importCluster",
+			Usage: "helix -z <zk> importCluster -f <file> [--cluster <cluster>] [--mode fail|overwrite|merge]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "cluster definition exported by exportCluster, json or yaml",
+				},
+				cli.StringFlag{
+					Name:  "cluster, c",
+					Usage: "cluster to create or update, the one of the definition by default",
+				},
+				cli.StringFlag{
+					Name:  "mode, m",
+					Value: string(gohelix.ConflictFail),
+					Usage: "what to do with the existing records that differ: fail, overwrite or merge",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if c.String("file") == "" {
+					fmt.Println("Missing the cluster definition file")
+					return
+				}
+
+				importHelixCluster(c)
+			},
+		},
+		{
+			Name:  "apply",
+			Usage: "helix -z <zk> apply -f <spec> [--prune] [--timeout <secs>] [--dryRun], bring a cluster to its spec",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "cluster spec, json or yaml",
+				},
+				cli.BoolFlag{
+					Name:  "prune",
+					Usage: "remove the resources, instances and tags that are not in the spec",
+				},
+				cli.IntFlag{
+					Name:  "timeout",
+					Value: 300,
+					Usage: "seconds to wait for the pruned resources to drop and the pruned instances to evacuate",
+				},
+				cli.BoolFlag{
+					Name:  "dryRun",
+					Usage: "print the plan without applying it",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if c.String("file") == "" {
+					fmt.Println("Missing the cluster spec file")
+					return
+				}
+
+				applyHelixClusterSpec(c)
+			},
+		},
+		{
+			Name:  "doctor",
+			Usage: "helix -z <zk> doctor [--fix] <cluster>, check the znode layout of a cluster",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "fix",
+					Usage: "fix the problems that can be fixed",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := mustArgc(c, 1); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+
+				doctorHelixCluster(c)
+			},
+		},
+		{
+			Name:  "verify",
+			Usage: "helix -z <zk> verify [--timeout <secs>] <cluster> [<resource>...], wait until the external views match the ideal states",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "timeout",
+					Value: 60,
+					Usage: "seconds to wait for the cluster to converge",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 1 {
+					fmt.Println("Missing the cluster")
+					os.Exit(1)
+				}
+
+				verifyHelixCluster(c)
+			},
+		},
+		{
+			Name:  "simulate",
+			Usage: "helix -z <zk> simulate -c <cluster> | -f <snapshot> [--addInstance <name>] [--removeInstance <name>] [--disableInstance <name>] [--replicas <resource>=<n>]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "cluster, c",
+					Usage: "cluster name",
+				},
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "snapshot exported by exportSnapshot",
+				},
+				cli.StringSliceFlag{
+					Name:  "addInstance",
+					Usage: "instance to add",
+				},
+				cli.StringSliceFlag{
+					Name:  "removeInstance",
+					Usage: "instance to remove",
+				},
+				cli.StringSliceFlag{
+					Name:  "disableInstance",
+					Usage: "instance to disable",
+				},
+				cli.StringSliceFlag{
+					Name:  "replicas",
+					Usage: "new replication factor of a resource, as <resource>=<n>",
+				},
+			},
+			Action: func(c *cli.Context) {
+				startHelixSimulation(c)
+			},
+		},
 		{
 			Name:  "spectator",
 			Usage: "helix -z <zk> spectator -c <cluster>",
@@ -358,6 +1015,36 @@ func main() {
 	app.Run(os.Args)
 }
 
+// configScopeKeys is the number of scope keys of each config scope
+var configScopeKeys = map[string]int{
+	"CLUSTER":     0,
+	"CONSTRAINT":  0,
+	"PARTICIPANT": 1,
+	"RESOURCE":    1,
+	"PARTITION":   2,
+}
+
+// configArgs splits the arguments of the config commands into the scope, the cluster,
+// the scope keys and the remaining arguments
+func configArgs(c *cli.Context) (string, string, []string, []string, error) {
+	args := []string(c.Args())
+	if len(args) < 3 {
+		return "", "", nil, nil, fmt.Errorf("Wrong number of arguments")
+	}
+
+	scope := strings.ToUpper(args[0])
+	n, ok := configScopeKeys[scope]
+	if !ok {
+		return "", "", nil, nil, fmt.Errorf("Not supported")
+	}
+
+	if len(args) < 3+n {
+		return "", "", nil, nil, fmt.Errorf("Wrong number of arguments")
+	}
+
+	return scope, args[1], args[2 : 2+n], args[2+n:], nil
+}
+
 func mustArgc(c *cli.Context, n int) error {
 	if len(c.Args()) != n {
 		return fmt.Errorf("Wrong number of arguments")
@@ -400,6 +1087,51 @@ func startHelixParticipant(zk string, cluster string, host string, port string,
 	<-c
 }
 
+// helix -z localhost:2181 controller -c MYCLUSTER -n controller1
+func startHelixController(zk string, cluster string, name string) {
+	if name == "" {
+		hostname, _ := os.Hostname()
+		name = fmt.Sprintf("%s_%d", hostname, os.Getpid())
+	}
+
+	manager := gohelix.NewHelixManager(zk)
+	controller := manager.NewController(cluster, name)
+
+	if err := controller.Connect(); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer controller.Disconnect()
+
+	// block until SIGINT and SIGTERM
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+}
+
+// helix -z localhost:2181 controller -m distributed -c SUPERCLUSTER -n localhost_9000
+func startHelixDistributedController(zk string, superCluster string, name string) {
+	parts := strings.Split(name, "_")
+	if len(parts) != 2 {
+		fmt.Println("The name of a distributed controller must be host_port")
+		return
+	}
+
+	manager := gohelix.NewHelixManager(zk)
+	controller := manager.NewDistributedController(superCluster, parts[0], parts[1])
+
+	if err := controller.Connect(); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer controller.Disconnect()
+
+	// block until SIGINT and SIGTERM
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+}
+
 // helix -z localhost:2181 spectator -c MYCLUSTER
 func startHelixSpectator(zk string, cluster string) {
 
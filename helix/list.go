@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yichen/gohelix"
+)
+
+// printNames prints a heading and the names under it
+func printNames(heading string, names []string) {
+	fmt.Println(heading + ":")
+	for _, name := range names {
+		fmt.Println("  " + name)
+	}
+}
+
+// printClusterInfo prints the resources and the instances of a cluster
+func printClusterInfo(info *gohelix.ClusterInfo) {
+	fmt.Println("Existing resources in cluster " + info.Cluster + ":")
+	for _, is := range info.IdealStates {
+		fmt.Printf("  %s: %d partitions of %s, %s replicas, %s", is.Resource, is.Partitions, is.StateModel, is.Replicas, is.RebalanceMode)
+		if !is.Enabled {
+			fmt.Print(", disabled")
+		}
+		fmt.Println()
+	}
+
+	fmt.Println("\nInstances in cluster " + info.Cluster + ":")
+	for _, i := range info.Instances {
+		fmt.Print("  " + i.Name)
+		if !i.Enabled {
+			fmt.Print(", disabled")
+		}
+		fmt.Println()
+	}
+}
+
+// printInstanceConfig prints the config of an instance
+func printInstanceConfig(config *gohelix.InstanceConfig) {
+	fmt.Println("Instance " + config.Name)
+	fmt.Printf("  host: %s\n", config.Host)
+	fmt.Printf("  port: %s\n", config.Port)
+	fmt.Printf("  enabled: %t\n", config.Enabled)
+	if len(config.Tags) > 0 {
+		fmt.Printf("  tags: %s\n", strings.Join(config.Tags, ","))
+	}
+	if config.Domain != "" {
+		fmt.Printf("  domain: %s\n", config.Domain)
+	}
+	if config.Evacuating {
+		fmt.Println("  evacuating")
+	}
+
+	if len(config.DisabledPartitions) > 0 {
+		resources := []string{}
+		for r := range config.DisabledPartitions {
+			resources = append(resources, r)
+		}
+		sort.Strings(resources)
+
+		fmt.Println("  disabled partitions:")
+		for _, r := range resources {
+			fmt.Printf("    %s: %s\n", r, strings.Join(config.DisabledPartitions[r], ","))
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/yichen/gohelix"
+)
+
+// helix -z localhost:2181 simulate -c MYCLUSTER --addInstance localhost_12003 --replicas myDB=3
+func startHelixSimulation(c *cli.Context) {
+	var snapshot *gohelix.ClusterSnapshot
+	var err error
+
+	if file := c.String("file"); file != "" {
+		var data []byte
+		if data, err = ioutil.ReadFile(file); err == nil {
+			snapshot, err = gohelix.NewClusterSnapshotFromBytes(data)
+		}
+	} else {
+		admin := gohelix.Admin{c.GlobalString("zkSvr")}
+		snapshot, err = admin.GetClusterSnapshot(c.String("cluster"))
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	sim, err := gohelix.NewSimulator(snapshot)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	for _, i := range c.StringSlice("addInstance") {
+		if err := sim.AddInstance(i); err != nil {
+			fmt.Println(i + ": " + err.Error())
+			return
+		}
+	}
+
+	for _, i := range c.StringSlice("removeInstance") {
+		if err := sim.RemoveInstance(i); err != nil {
+			fmt.Println(i + ": " + err.Error())
+			return
+		}
+	}
+
+	for _, i := range c.StringSlice("disableInstance") {
+		if err := sim.DisableInstance(i); err != nil {
+			fmt.Println(i + ": " + err.Error())
+			return
+		}
+	}
+
+	for _, r := range c.StringSlice("replicas") {
+		kv := strings.SplitN(r, "=", 2)
+		if len(kv) != 2 {
+			fmt.Println("Invalid parameter " + r)
+			return
+		}
+
+		replicas, err := strconv.Atoi(kv[1])
+		if err != nil {
+			fmt.Println("Invalid parameter " + r)
+			return
+		}
+
+		if err := sim.SetReplicas(kv[0], replicas); err != nil {
+			fmt.Println(kv[0] + ": " + err.Error())
+			return
+		}
+	}
+
+	printSimulationResult(sim.Run())
+}
+
+func printSimulationResult(result *gohelix.SimulationResult) {
+	fmt.Println("Assignment:")
+
+	resources := []string{}
+	for r := range result.Assignments {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+
+	for _, r := range resources {
+		fmt.Println("  " + r)
+
+		assignment := result.Assignments[r]
+		partitions := []string{}
+		for p := range assignment.Partitions {
+			partitions = append(partitions, p)
+		}
+		sort.Strings(partitions)
+
+		for _, p := range partitions {
+			states := assignment.GetStates(p)
+			instances := []string{}
+			for i := range states {
+				instances = append(instances, i)
+			}
+			sort.Strings(instances)
+
+			replicas := []string{}
+			for _, i := range instances {
+				replicas = append(replicas, i+"="+states[i])
+			}
+			fmt.Printf("    %s: %s\n", p, strings.Join(replicas, ", "))
+		}
+	}
+
+	fmt.Println("Messages:")
+	for n, step := range result.Steps {
+		fmt.Printf("  step %d\n", n+1)
+		for _, m := range step {
+			fmt.Printf("    %v %v %v: %v -> %v\n",
+				m.GetSimpleField("TGT_NAME"),
+				m.GetSimpleField("RESOURCE_NAME"),
+				m.GetSimpleField("PARTITION_NAME"),
+				m.GetSimpleField("FROM_STATE"),
+				m.GetSimpleField("TO_STATE"))
+		}
+	}
+
+	if !result.Converged {
+		fmt.Println("The simulation stopped before reaching the assignment")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/yichen/gohelix"
+)
+
+// helix -z localhost:2181 addStateModelDef MYCLUSTER OnOff -i OFF --state ON=R --state OFF=-1 --transition OFF-ON --transition ON-OFF --transition OFF-DROPPED
+func addHelixStateModelDef(c *cli.Context) {
+	def := gohelix.NewStateModelDefinition(c.Args().Get(1), c.String("initialState"))
+
+	for _, s := range c.StringSlice("state") {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			fmt.Println("Invalid parameter " + s)
+			return
+		}
+		def.AddState(kv[0], gohelix.StateCount(kv[1]))
+	}
+
+	for _, t := range c.StringSlice("transition") {
+		states := strings.SplitN(t, "-", 2)
+		if len(states) != 2 {
+			fmt.Println("Invalid parameter " + t)
+			return
+		}
+		def.AddTransition(states[0], states[1])
+	}
+
+	admin := gohelix.Admin{c.GlobalString("zkSvr")}
+	if err := admin.AddStateModelDef(c.Args().Get(0), def); err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+func printStateModelDef(def *gohelix.StateModelDefinition) {
+	fmt.Println("State model " + def.Name)
+	fmt.Println("  initial state: " + def.InitialState)
+
+	fmt.Println("  states:")
+	for _, s := range def.States {
+		fmt.Printf("    %s: %s\n", s, def.Counts[s])
+	}
+
+	fmt.Println("  transitions:")
+	for _, t := range def.Transitions {
+		fmt.Printf("    %s-%s\n", t.From, t.To)
+	}
+}
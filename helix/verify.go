@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/yichen/gohelix"
+)
+
+// helix -z localhost:2181 verify --timeout 300 MYCLUSTER myDB
+//
+// The exit status is 1 if the cluster has not converged, so deploy scripts can block on
+// it.
+func verifyHelixCluster(c *cli.Context) {
+	admin := gohelix.Admin{c.GlobalString("zkSvr")}
+	timeout := time.Duration(c.Int("timeout")) * time.Second
+
+	report, err := admin.WaitForConvergence(c.Args().First(), c.Args().Tail(), timeout)
+	if report != nil {
+		printConvergenceReport(report)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+func printConvergenceReport(report *gohelix.ConvergenceReport) {
+	if report.Converged() {
+		fmt.Printf("Cluster %s has converged\n", report.Cluster)
+		return
+	}
+
+	fmt.Printf("Cluster %s has not converged:\n", report.Cluster)
+	for _, m := range report.Mismatches {
+		fmt.Printf("  %s %s\n", m.Resource, m.Partition)
+		fmt.Printf("    expected: %s\n", formatStates(m.Expected))
+		fmt.Printf("    actual:   %s\n", formatStates(m.Actual))
+		for _, p := range m.Problems {
+			fmt.Println("    " + p)
+		}
+	}
+}
+
+// formatStates formats the states of the replicas of a partition as instance=state,
+// sorted by instance
+func formatStates(states map[string]string) string {
+	instances := []string{}
+	for i := range states {
+		instances = append(instances, i)
+	}
+	sort.Strings(instances)
+
+	result := []string{}
+	for _, i := range instances {
+		result = append(result, i+"="+states[i])
+	}
+	return strings.Join(result, ", ")
+}
@@ -0,0 +1,192 @@
+package gohelix
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of the participant history. LAST_OFFLINE_TIME is the time in milliseconds the
+// participant went offline, -1 means the participant is live. HISTORY lists the last
+// sessions of the participant and OFFLINE the last times it went offline, oldest first,
+// in the format of the Java participant history:
+//
+//	{DATE=2015-06-01T10:00:00:000, SESSION=14dab5ba0f70000, TIME=1433152800000}
+const (
+	lastOfflineTimeKey     = "LAST_OFFLINE_TIME"
+	sessionHistoryKey      = "HISTORY"
+	offlineHistoryKey      = "OFFLINE"
+	historyDateFormat      = "2006-01-02T15:04:05"
+	participantHistorySize = 20
+)
+
+// Flapping detection is enabled by setting both FLAPPING_TIME_WINDOW, in milliseconds,
+// and FLAPPING_MAX_SESSION_CHANGES in the cluster config. The controller disables an
+// instance that starts more sessions than FLAPPING_MAX_SESSION_CHANGES within the window,
+// with the reason in HELIX_DISABLED_REASON of the instance config.
+const (
+	flappingTimeWindowKey        = "FLAPPING_TIME_WINDOW"
+	flappingMaxSessionChangesKey = "FLAPPING_MAX_SESSION_CHANGES"
+	disabledReasonKey            = "HELIX_DISABLED_REASON"
+	disabledTimestampKey         = "HELIX_DISABLED_TIMESTAMP"
+)
+
+// getParticipantHistory reads the history record of a participant from
+// /<cluster>/INSTANCES/<participant>/HISTORY. An empty record is returned if
+// the participant does not have a history yet.
+func getParticipantHistory(conn *connection, keys KeyBuilder, participantID string) (*Record, error) {
+	path := keys.participantHistory(participantID)
+
+	exists, err := conn.Exists(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return NewRecord(participantID), nil
+	}
+
+	return conn.GetRecordFromPath(path)
+}
+
+// setLastOfflineTime saves the time in milliseconds the participant went offline
+// in the participant history. Use -1 when the participant is live.
+func setLastOfflineTime(conn *connection, keys KeyBuilder, participantID string, millis int64) error {
+	history, err := getParticipantHistory(conn, keys, participantID)
+	if err != nil {
+		return err
+	}
+
+	history.SetSimpleField(lastOfflineTimeKey, strconv.FormatInt(millis, 10))
+	if millis >= 0 {
+		appendHistoryEntry(history, offlineHistoryKey, map[string]string{}, millis)
+	}
+
+	return conn.SetRecordForPath(keys.participantHistory(participantID), history)
+}
+
+// recordSession adds a session of the participant to its history, unless the session is
+// already there, and returns the history.
+func recordSession(conn *connection, keys KeyBuilder, participantID string, sessionID string, millis int64) (*Record, error) {
+	history, err := getParticipantHistory(conn, keys, participantID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range history.GetListField(sessionHistoryKey) {
+		if parseHistoryEntry(entry)["SESSION"] == sessionID {
+			return history, nil
+		}
+	}
+
+	appendHistoryEntry(history, sessionHistoryKey, map[string]string{"SESSION": sessionID}, millis)
+	return history, conn.SetRecordForPath(keys.participantHistory(participantID), history)
+}
+
+// appendHistoryEntry adds an entry at the end of a list of the history, and drops the
+// oldest entries beyond participantHistorySize. The fields of the entry are sorted
+// between its DATE and TIME.
+func appendHistoryEntry(history *Record, key string, fields map[string]string, millis int64) {
+	date := time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(historyDateFormat)
+	entry := fmt.Sprintf("{DATE=%s:%03d", date, millis%1000)
+
+	keys := []string{}
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		entry += ", " + k + "=" + fields[k]
+	}
+	entry += fmt.Sprintf(", TIME=%d}", millis)
+
+	list := append(history.GetListField(key), entry)
+	if len(list) > participantHistorySize {
+		list = list[len(list)-participantHistorySize:]
+	}
+	history.SetListField(key, list)
+}
+
+// parseHistoryEntry parses an entry of the participant history into its fields
+func parseHistoryEntry(entry string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(strings.Trim(entry, "{}"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) == 2 {
+			result[kv[0]] = kv[1]
+		}
+	}
+	return result
+}
+
+// countSessions returns the number of sessions in the history that started after the
+// time in milliseconds
+func countSessions(history *Record, since int64) int {
+	count := 0
+	for _, entry := range history.GetListField(sessionHistoryKey) {
+		t, err := strconv.ParseInt(parseHistoryEntry(entry)["TIME"], 10, 64)
+		if err == nil && t >= since {
+			count++
+		}
+	}
+	return count
+}
+
+// trackSessions records the sessions of the live instances in their history. When
+// flapping detection is enabled, the instances that started too many sessions within
+// the window are disabled, in zookeeper and in the snapshot. This is bookkeeping that
+// must not hold the rebalance up, so the errors are logged and the instance is skipped.
+func (s *ClusterSnapshot) trackSessions(conn *connection) {
+	keys := KeyBuilder{s.ClusterID}
+	nowMilli := s.Time.UnixNano() / 1000000
+
+	window := int64(s.ClusterConfig.GetIntField(flappingTimeWindowKey, 0))
+	maxChanges := s.ClusterConfig.GetIntField(flappingMaxSessionChangesKey, 0)
+
+	for _, instance := range s.Instances() {
+		live, ok := s.LiveInstances[instance]
+		if !ok {
+			continue
+		}
+
+		sessionID, _ := live.GetSimpleField("SESSION_ID").(string)
+		history, err := recordSession(conn, keys, instance, sessionID, nowMilli)
+		if err != nil {
+			Logger.Printf("Failed to record the session of %s: %s\n", instance, err.Error())
+			continue
+		}
+
+		if window <= 0 || maxChanges <= 0 || !s.IsEnabled(instance) {
+			continue
+		}
+
+		// the sessions before the instance was last disabled are forgiven
+		since := nowMilli - window
+		if t := int64(s.InstanceConfigs[instance].GetIntField(disabledTimestampKey, 0)); t > since {
+			since = t
+		}
+
+		count := countSessions(history, since)
+		if count <= maxChanges {
+			continue
+		}
+
+		Logger.Printf("Disabling flapping instance %s\n", instance)
+
+		// the instance is only disabled in the snapshot once it is in zookeeper
+		disable := func(config *Record) error {
+			config.SetBooleanField("HELIX_ENABLED", false)
+			config.SetSimpleField(disabledReasonKey, fmt.Sprintf("flapping: %d sessions in %d ms", count, window))
+			config.SetSimpleField(disabledTimestampKey, strconv.FormatInt(nowMilli, 10))
+			return nil
+		}
+		if err := conn.updateRecord(keys.participantConfig(instance), disable); err != nil {
+			Logger.Printf("Failed to disable flapping instance %s: %s\n", instance, err.Error())
+			continue
+		}
+		disable(s.InstanceConfigs[instance])
+	}
+}
@@ -0,0 +1,29 @@
+package gohelix
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestParticipantHistory(t *testing.T) {
+	t.Parallel()
+
+	history := NewRecord("localhost_12913")
+	for i := 0; i < participantHistorySize+5; i++ {
+		appendHistoryEntry(history, sessionHistoryKey, map[string]string{"SESSION": strconv.Itoa(i)}, int64(1000*i))
+	}
+
+	list := history.GetListField(sessionHistoryKey)
+	if len(list) != participantHistorySize {
+		t.Fatalf("expect the history to keep %d sessions, got %d", participantHistorySize, len(list))
+	}
+
+	if list[0] != "{DATE=1970-01-01T00:00:05:000, SESSION=5, TIME=5000}" {
+		t.Error("expect the oldest sessions to be dropped: " + list[0])
+	}
+
+	// the sessions 20 to 24 started in the last 5 seconds
+	if n := countSessions(history, 20000); n != 5 {
+		t.Errorf("expect 5 sessions in the window, got %d", n)
+	}
+}
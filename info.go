@@ -0,0 +1,101 @@
+package gohelix
+
+// InstanceConfig is the config of a participant instance, see Admin.ListInstanceInfo. The
+// Record holds the fields that are not broken out.
+type InstanceConfig struct {
+	Name               string
+	Host               string
+	Port               string
+	Enabled            bool
+	Tags               []string
+	Domain             string
+	Evacuating         bool
+	DisabledPartitions map[string][]string
+	Record             *Record
+}
+
+// NewInstanceConfigFromRecord reads an instance config from its record
+func NewInstanceConfigFromRecord(r *Record) *InstanceConfig {
+	c := &InstanceConfig{
+		Name:               r.ID,
+		Enabled:            r.GetBooleanField("HELIX_ENABLED", true),
+		Tags:               instanceTags(r),
+		DisabledPartitions: make(map[string][]string),
+		Record:             r,
+	}
+	c.Host, _ = r.GetSimpleField("HELIX_HOST").(string)
+	c.Port, _ = r.GetSimpleField("HELIX_PORT").(string)
+	c.Domain, _ = r.GetSimpleField(domainKey).(string)
+	c.Evacuating = r.GetSimpleField(instanceOperationKey) == evacuateOperation
+
+	for resource := range r.MapFields[disabledPartitionKey] {
+		if partitions := disabledPartitions(r, resource); len(partitions) > 0 {
+			c.DisabledPartitions[resource] = partitions
+		}
+	}
+
+	return c
+}
+
+// IdealState is the ideal state of a resource, see Admin.ListClusterInfo. Replicas is a
+// number, or ANY_LIVEINSTANCE for a replica on every live instance. The preference lists
+// are by partition, and the Record holds the fields that are not broken out.
+type IdealState struct {
+	Resource         string
+	Partitions       int
+	Replicas         string
+	RebalanceMode    string
+	StateModel       string
+	InstanceGroupTag string
+	Enabled          bool
+	PreferenceLists  map[string][]string
+	Record           *Record
+}
+
+// NewIdealStateFromRecord reads an ideal state from its record
+func NewIdealStateFromRecord(r *Record) *IdealState {
+	is := &IdealState{
+		Resource:        r.ID,
+		Partitions:      r.GetIntField("NUM_PARTITIONS", 0),
+		Enabled:         r.GetBooleanField("HELIX_ENABLED", true),
+		PreferenceLists: make(map[string][]string),
+		Record:          r,
+	}
+	is.Replicas, _ = r.GetSimpleField("REPLICAS").(string)
+	is.RebalanceMode, _ = r.GetSimpleField("REBALANCE_MODE").(string)
+	is.StateModel, _ = r.GetSimpleField("STATE_MODEL_DEF_REF").(string)
+	is.InstanceGroupTag, _ = r.GetSimpleField(instanceGroupTagKey).(string)
+
+	for partition := range r.ListFields {
+		is.PreferenceLists[partition] = r.GetListField(partition)
+	}
+
+	return is
+}
+
+// ClusterInfo holds the ideal states of the resources of a cluster and the configs of
+// its instances, sorted by name
+type ClusterInfo struct {
+	Cluster     string
+	IdealStates []*IdealState
+	Instances   []*InstanceConfig
+}
+
+// newClusterInfo builds the cluster info from the records of the ideal states and the
+// instance configs, by name
+func newClusterInfo(cluster string, idealStates map[string]*Record, instanceConfigs map[string]*Record) *ClusterInfo {
+	info := &ClusterInfo{
+		Cluster:     cluster,
+		IdealStates: []*IdealState{},
+		Instances:   []*InstanceConfig{},
+	}
+
+	for _, name := range sortedKeys(idealStates) {
+		info.IdealStates = append(info.IdealStates, NewIdealStateFromRecord(idealStates[name]))
+	}
+	for _, name := range sortedKeys(instanceConfigs) {
+		info.Instances = append(info.Instances, NewInstanceConfigFromRecord(instanceConfigs[name]))
+	}
+
+	return info
+}
@@ -0,0 +1,55 @@
+package gohelix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewClusterInfo(t *testing.T) {
+	t.Parallel()
+
+	h1 := NewRecord("localhost_12913")
+	h1.SetSimpleField("HELIX_HOST", "localhost")
+	h1.SetSimpleField("HELIX_PORT", "12913")
+	h1.SetSimpleField(domainKey, "zone=z1,host=h1")
+	setInstanceTag(h1, "SSD", true)
+	setPartitionsDisabled(h1, "myDB", []string{"myDB_1", "myDB_0"}, true)
+
+	h2 := NewRecord("localhost_12914")
+	h2.SetBooleanField("HELIX_ENABLED", false)
+	h2.SetSimpleField(instanceOperationKey, evacuateOperation)
+
+	is := newTestIdealState("myDB", "SEMI_AUTO", 2)
+	is.SetIntField("NUM_PARTITIONS", 4)
+	is.SetSimpleField(instanceGroupTagKey, "SSD")
+	is.SetListField("myDB_0", []string{"localhost_12913", "localhost_12914"})
+
+	info := newClusterInfo("MYCLUSTER",
+		map[string]*Record{"myDB": is, "anotherDB": newTestIdealState("anotherDB", "FULL_AUTO", 1)},
+		map[string]*Record{"localhost_12914": h2, "localhost_12913": h1})
+
+	if len(info.IdealStates) != 2 || info.IdealStates[0].Resource != "anotherDB" {
+		t.Fatal("expect the ideal states sorted by resource")
+	}
+	myDB := info.IdealStates[1]
+	if myDB.Partitions != 4 || myDB.Replicas != "2" || myDB.RebalanceMode != "SEMI_AUTO" || myDB.InstanceGroupTag != "SSD" || !myDB.Enabled {
+		t.Errorf("unexpected ideal state %+v", myDB)
+	}
+	if !reflect.DeepEqual(myDB.PreferenceLists["myDB_0"], []string{"localhost_12913", "localhost_12914"}) {
+		t.Error("expect the preference list of myDB_0")
+	}
+
+	if len(info.Instances) != 2 || info.Instances[0].Name != "localhost_12913" {
+		t.Fatal("expect the instances sorted by name")
+	}
+	i1, i2 := info.Instances[0], info.Instances[1]
+	if i1.Host != "localhost" || i1.Port != "12913" || !i1.Enabled || i1.Evacuating || i1.Domain != "zone=z1,host=h1" {
+		t.Errorf("unexpected instance config %+v", i1)
+	}
+	if !reflect.DeepEqual(i1.Tags, []string{"SSD"}) || !reflect.DeepEqual(i1.DisabledPartitions, map[string][]string{"myDB": {"myDB_0", "myDB_1"}}) {
+		t.Errorf("unexpected instance config %+v", i1)
+	}
+	if i2.Enabled || !i2.Evacuating || len(i2.Tags) != 0 || len(i2.DisabledPartitions) != 0 {
+		t.Errorf("unexpected instance config %+v", i2)
+	}
+}
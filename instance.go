@@ -0,0 +1,210 @@
+package gohelix
+
+import (
+	"sort"
+	"strings"
+)
+
+// disabledPartitionKey is the map field of the instance config that holds the partitions
+// disabled on the instance, by resource, as a comma separated list
+const disabledPartitionKey = "HELIX_DISABLED_PARTITION"
+
+// disabledPartitions returns the partitions of the resource disabled on the instance
+func disabledPartitions(instanceConfig *Record, resource string) []string {
+	result := []string{}
+	for _, p := range strings.Split(instanceConfig.GetMapField(disabledPartitionKey, resource), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// setPartitionsDisabled disables or enables partitions of the resource on the instance
+func setPartitionsDisabled(instanceConfig *Record, resource string, partitions []string, disabled bool) {
+	set := make(map[string]bool)
+	for _, p := range disabledPartitions(instanceConfig, resource) {
+		set[p] = true
+	}
+	for _, p := range partitions {
+		set[p] = disabled
+	}
+
+	list := []string{}
+	for p, ok := range set {
+		if ok {
+			list = append(list, p)
+		}
+	}
+	sort.Strings(list)
+
+	if len(list) > 0 {
+		instanceConfig.SetMapField(disabledPartitionKey, resource, strings.Join(list, ","))
+		return
+	}
+
+	delete(instanceConfig.MapFields[disabledPartitionKey], resource)
+	if len(instanceConfig.MapFields[disabledPartitionKey]) == 0 {
+		instanceConfig.RemoveMapField(disabledPartitionKey)
+	}
+}
+
+// tagListKey is the list field of the instance config that holds the tags of the
+// instance. instanceGroupTagKey in the ideal state of a resource restricts its replicas to
+// the instances with the tag.
+const (
+	tagListKey          = "TAG_LIST"
+	instanceGroupTagKey = "INSTANCE_GROUP_TAG"
+)
+
+// instanceTags returns the tags of the instance
+func instanceTags(instanceConfig *Record) []string {
+	return instanceConfig.GetListField(tagListKey)
+}
+
+// setInstanceTag adds the tag to the instance or removes it
+func setInstanceTag(instanceConfig *Record, tag string, tagged bool) {
+	tags := []string{}
+	for _, t := range instanceTags(instanceConfig) {
+		if t != tag {
+			tags = append(tags, t)
+		}
+	}
+	if tagged {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	instanceConfig.SetListField(tagListKey, tags)
+}
+
+// swapInstance replaces the old instance with the new one in the preference lists and
+// the map fields of an ideal state. It returns whether the ideal state was changed, or
+// ErrInstanceSwapConflict if the new instance already holds a partition of the old one.
+func swapInstance(idealState *Record, oldInstance string, newInstance string) (bool, error) {
+	changed := false
+
+	for p := range idealState.ListFields {
+		list := idealState.GetListField(p)
+		if !contains(list, oldInstance) {
+			continue
+		}
+		if contains(list, newInstance) {
+			return false, ErrInstanceSwapConflict
+		}
+
+		swapped := make([]string, len(list))
+		for n, i := range list {
+			if i == oldInstance {
+				i = newInstance
+			}
+			swapped[n] = i
+		}
+		idealState.SetListField(p, swapped)
+		changed = true
+	}
+
+	for _, states := range idealState.MapFields {
+		state, ok := states[oldInstance]
+		if !ok {
+			continue
+		}
+		if _, ok := states[newInstance]; ok {
+			return false, ErrInstanceSwapConflict
+		}
+
+		delete(states, oldInstance)
+		states[newInstance] = state
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// instanceOperationKey in the instance config is set to evacuateOperation while the
+// replicas of the instance are moved elsewhere, see Admin.EvacuateInstance
+const (
+	instanceOperationKey = "INSTANCE_OPERATION"
+	evacuateOperation    = "EVACUATE"
+)
+
+// EvacuationProgress is the progress of the evacuation of an instance, see
+// Admin.EvacuateInstance. The partitions are listed by resource.
+type EvacuationProgress struct {
+	Instance string
+
+	// Remaining are the partitions the instance still holds in its current states
+	Remaining map[string][]string
+
+	// SoleReplicas are the partitions the instance is the only active holder of in the
+	// external view
+	SoleReplicas map[string][]string
+}
+
+// Done tests if the instance can be decommissioned: it holds no replicas anymore and
+// no partition relies on it alone
+func (p *EvacuationProgress) Done() bool {
+	return len(p.Remaining) == 0 && len(p.SoleReplicas) == 0
+}
+
+// computeEvacuationProgress compares the current states of the instance with the
+// external views of the resources, by resource
+func computeEvacuationProgress(snapshot *ClusterSnapshot, externalViews map[string]*Record, instance string) *EvacuationProgress {
+	result := &EvacuationProgress{
+		Instance:     instance,
+		Remaining:    make(map[string][]string),
+		SoleReplicas: make(map[string][]string),
+	}
+
+	for resource, cs := range snapshot.CurrentStates[instance] {
+		for p := range cs.MapFields {
+			if state := cs.GetMapField(p, "CURRENT_STATE"); state != "" && state != droppedState {
+				result.Remaining[resource] = append(result.Remaining[resource], p)
+			}
+		}
+		sort.Strings(result.Remaining[resource])
+	}
+
+	for resource, ev := range externalViews {
+		inactive := map[string]bool{droppedState: true, errorState: true}
+		if def, err := snapshot.stateModelDefOf(resource); err == nil {
+			inactive[initialState(def)] = true
+		}
+
+		for p, states := range ev.MapFields {
+			if inactive[states[instance]] || states[instance] == "" {
+				continue
+			}
+
+			sole := true
+			for i, state := range states {
+				if i != instance && !inactive[state] {
+					sole = false
+				}
+			}
+			if sole {
+				result.SoleReplicas[resource] = append(result.SoleReplicas[resource], p)
+			}
+		}
+		sort.Strings(result.SoleReplicas[resource])
+	}
+
+	return result
+}
+
+// isAssigned tests if the instance is named in the preference lists or the map fields of
+// the ideal state
+func isAssigned(idealState *Record, instance string) bool {
+	for p := range idealState.ListFields {
+		if contains(idealState.GetListField(p), instance) {
+			return true
+		}
+	}
+
+	for _, states := range idealState.MapFields {
+		if _, ok := states[instance]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package gohelix
+
+import "testing"
+
+func TestSwapIdealStateInstance(t *testing.T) {
+	t.Parallel()
+
+	is := NewRecord("myDB")
+	is.SetListField("myDB_0", []string{"h1", "h2"})
+	is.SetListField("myDB_1", []string{"h2", "h3"})
+	is.SetMapField("myDB_0", "h1", "MASTER")
+	is.SetMapField("myDB_0", "h2", "SLAVE")
+
+	changed, err := swapInstance(is, "h1", "h4")
+	if err != nil || !changed {
+		t.Fatal("expect the ideal state to change")
+	}
+
+	if list := is.GetListField("myDB_0"); len(list) != 2 || list[0] != "h4" || list[1] != "h2" {
+		t.Error("expect h4 to take the place of h1 in the preference list")
+	}
+	if is.GetMapField("myDB_0", "h4") != "MASTER" || is.GetMapField("myDB_0", "h1") != "" {
+		t.Error("expect h4 to take the place of h1 in the map field")
+	}
+
+	if changed, _ := swapInstance(is, "h1", "h4"); changed {
+		t.Error("expect no change without the old instance")
+	}
+
+	if _, err := swapInstance(is, "h2", "h3"); err != ErrInstanceSwapConflict {
+		t.Error("expect ErrInstanceSwapConflict")
+	}
+}
+
+func TestEvacuationProgress(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	s.IdealStates["myDB"] = newTestIdealState("myDB", "FULL_AUTO", 1)
+	setCurrentState(s, "h1", "myDB", "myDB_0", "MASTER")
+	setCurrentState(s, "h1", "myDB", "myDB_1", droppedState)
+
+	ev := NewRecord("myDB")
+	ev.SetMapField("myDB_0", "h1", "MASTER")
+	ev.SetMapField("myDB_0", "h2", "OFFLINE")
+	externalViews := map[string]*Record{"myDB": ev}
+
+	progress := computeEvacuationProgress(s, externalViews, "h1")
+	if progress.Done() {
+		t.Error("expect the evacuation not to be done")
+	}
+	if p := progress.Remaining["myDB"]; len(p) != 1 || p[0] != "myDB_0" {
+		t.Errorf("expect myDB_0 to remain, got %v", progress.Remaining)
+	}
+	if p := progress.SoleReplicas["myDB"]; len(p) != 1 || p[0] != "myDB_0" {
+		t.Errorf("expect h1 to be the only holder of myDB_0, got %v", progress.SoleReplicas)
+	}
+
+	setCurrentState(s, "h1", "myDB", "myDB_0", droppedState)
+	ev.SetMapField("myDB_0", "h2", "MASTER")
+	delete(ev.MapFields["myDB_0"], "h1")
+	if !computeEvacuationProgress(s, externalViews, "h1").Done() {
+		t.Error("expect the evacuation to be done")
+	}
+}
+
+func TestIsAssigned(t *testing.T) {
+	t.Parallel()
+
+	is := NewRecord("myDB")
+	is.SetListField("myDB_0", []string{"h1"})
+	is.SetMapField("myDB_1", "h2", "MASTER")
+
+	if !isAssigned(is, "h1") || !isAssigned(is, "h2") {
+		t.Error("expect h1 and h2 to be assigned")
+	}
+	if isAssigned(is, "h3") {
+		t.Error("expect h3 not to be assigned")
+	}
+}
@@ -33,10 +33,26 @@ func (k *KeyBuilder) controller() string {
 	return fmt.Sprintf("/%s/CONTROLLER", k.ClusterID)
 }
 
+func (k *KeyBuilder) controllerLeader() string {
+	return fmt.Sprintf("/%s/CONTROLLER/LEADER", k.ClusterID)
+}
+
+func (k *KeyBuilder) controllerMaintenance() string {
+	return fmt.Sprintf("/%s/CONTROLLER/MAINTENANCE", k.ClusterID)
+}
+
+func (k *KeyBuilder) controllerPause() string {
+	return fmt.Sprintf("/%s/CONTROLLER/PAUSE", k.ClusterID)
+}
+
 func (k *KeyBuilder) controllerErrors() string {
 	return fmt.Sprintf("/%s/CONTROLLER/ERRORS", k.ClusterID)
 }
 
+func (k *KeyBuilder) controllerError(sessionID string, ID string) string {
+	return fmt.Sprintf("/%s/CONTROLLER/ERRORS/%s/%s", k.ClusterID, sessionID, ID)
+}
+
 func (k *KeyBuilder) controllerHistory() string {
 	return fmt.Sprintf("/%s/CONTROLLER/HISTORY", k.ClusterID)
 }
@@ -53,6 +69,10 @@ func (k *KeyBuilder) controllerStatusUpdates() string {
 	return fmt.Sprintf("/%s/CONTROLLER/STATUSUPDATES", k.ClusterID)
 }
 
+func (k *KeyBuilder) controllerStatusUpdate(sessionID string, ID string) string {
+	return fmt.Sprintf("/%s/CONTROLLER/STATUSUPDATES/%s/%s", k.ClusterID, sessionID, ID)
+}
+
 func (k *KeyBuilder) idealStates() string {
 	return fmt.Sprintf("/%s/IDEALSTATES", k.ClusterID)
 }
@@ -61,10 +81,22 @@ func (k *KeyBuilder) idealStateForResource(resource string) string {
 	return fmt.Sprintf("/%s/IDEALSTATES/%s", k.ClusterID, resource)
 }
 
+func (k *KeyBuilder) resourceConfigs() string {
+	return fmt.Sprintf("/%s/CONFIGS/RESOURCE", k.ClusterID)
+}
+
 func (k *KeyBuilder) resourceConfig(resource string) string {
 	return fmt.Sprintf("/%s/CONFIGS/RESOURCE/%s", k.ClusterID, resource)
 }
 
+func (k *KeyBuilder) constraints() string {
+	return fmt.Sprintf("/%s/CONFIGS/CONSTRAINT", k.ClusterID)
+}
+
+func (k *KeyBuilder) constraint(constraintType string) string {
+	return fmt.Sprintf("/%s/CONFIGS/CONSTRAINT/%s", k.ClusterID, constraintType)
+}
+
 func (k *KeyBuilder) participantConfigs() string {
 	return fmt.Sprintf("/%s/CONFIGS/PARTICIPANT", k.ClusterID)
 }
@@ -117,6 +149,10 @@ func (k *KeyBuilder) statusUpdates(participantID string) string {
 	return fmt.Sprintf("/%s/INSTANCES/%s/STATUSUPDATES", k.ClusterID, participantID)
 }
 
+func (k *KeyBuilder) participantHistory(participantID string) string {
+	return fmt.Sprintf("/%s/INSTANCES/%s/HISTORY", k.ClusterID, participantID)
+}
+
 func (k *KeyBuilder) stateModels() string {
 	return fmt.Sprintf("/%s/STATEMODELDEFS", k.ClusterID)
 }
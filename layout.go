@@ -0,0 +1,101 @@
+package gohelix
+
+import (
+	"fmt"
+	"strings"
+)
+
+// znode is a path and its data, to create in a transaction, see connection.multi
+type znode struct {
+	path string
+	data []byte
+}
+
+// defaultStateModels are the state model definitions a new cluster starts with
+var defaultStateModels = []string{
+	"LeaderStandby",
+	"MasterSlave",
+	"OnlineOffline",
+	"STORAGE_DEFAULT_SM_SCHEMATA",
+	"SchedulerTaskQueue",
+	"Task",
+}
+
+// clusterZnodes returns the znodes of a new cluster, parents first
+func clusterZnodes(cluster string) []znode {
+	keys := KeyBuilder{cluster}
+	clusterConfig, _ := NewRecord(cluster).Marshal()
+
+	result := []znode{
+		{keys.cluster(), nil},
+		{keys.propertyStore(), nil},
+		{keys.stateModels(), nil},
+	}
+	for _, name := range defaultStateModels {
+		result = append(result, znode{keys.stateModel(name), []byte(HelixDefaultNodes[name])})
+	}
+
+	configs := keys.cluster() + "/CONFIGS"
+	return append(result,
+		znode{keys.instances(), nil},
+		znode{configs, nil},
+		znode{keys.participantConfigs(), nil},
+		znode{keys.resourceConfigs(), nil},
+		znode{configs + "/CLUSTER", nil},
+		znode{keys.clusterConfig(), clusterConfig},
+		znode{keys.idealStates(), nil},
+		znode{keys.externalView(), nil},
+		znode{keys.liveInstances(), nil},
+		znode{keys.controller(), nil},
+		znode{keys.controllerErrors(), nil},
+		znode{keys.controllerHistory(), nil},
+		znode{keys.controllerMessages(), nil},
+		znode{keys.controllerStatusUpdates(), nil},
+	)
+}
+
+// instanceZnodes returns the znodes of a new instance, its config first and then its
+// instance tree, parents first
+func instanceZnodes(cluster string, config *Record) []znode {
+	keys := KeyBuilder{cluster}
+	instance := config.ID
+	data, _ := config.Marshal()
+
+	return []znode{
+		{keys.participantConfig(instance), data},
+		{keys.instance(instance), nil},
+		{keys.messages(instance), nil},
+		{keys.currentStates(instance), nil},
+		{keys.errorsR(instance), nil},
+		{keys.statusUpdates(instance), nil},
+	}
+}
+
+// PartialDeleteError is returned when a tree too large for one zookeeper transaction, see
+// Admin.DropCluster, fails to be deleted after part of it was. The Remaining znodes are
+// left behind, children first, and deleting the tree again resumes.
+type PartialDeleteError struct {
+	Path      string
+	Remaining []string
+	Err       error
+}
+
+func (e *PartialDeleteError) Error() string {
+	remaining := e.Remaining
+	if len(remaining) > 5 {
+		remaining = append(remaining[:5:5], "...")
+	}
+	return fmt.Sprintf("%s partially deleted, %d znodes left (%s): %s", e.Path, len(e.Remaining), strings.Join(remaining, ", "), e.Err.Error())
+}
+
+// RepairReport lists the paths of the znodes a repair created and removed, see
+// Admin.RepairCluster
+type RepairReport struct {
+	Created []string
+	Removed []string
+}
+
+// Empty tests if the repair has nothing to do
+func (r *RepairReport) Empty() bool {
+	return len(r.Created) == 0 && len(r.Removed) == 0
+}
@@ -0,0 +1,58 @@
+package gohelix
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/yichen/go-zookeeper/zk"
+)
+
+func TestClusterZnodes(t *testing.T) {
+	t.Parallel()
+
+	// parents come first, so the znodes can be created in one transaction
+	created := map[string]bool{"/": true}
+	config := NewRecord("localhost_12913")
+	for _, n := range append(clusterZnodes("MYCLUSTER"), instanceZnodes("MYCLUSTER", config)...) {
+		if !created[path.Dir(n.path)] {
+			t.Errorf("%s comes before its parent", n.path)
+		}
+		if created[n.path] {
+			t.Errorf("%s comes twice", n.path)
+		}
+		created[n.path] = true
+	}
+
+	kb := KeyBuilder{"MYCLUSTER"}
+	for _, p := range []string{kb.clusterConfig(), kb.stateModel("MasterSlave"), kb.controllerStatusUpdates(), kb.currentStates("localhost_12913")} {
+		if !created[p] {
+			t.Errorf("expect %s", p)
+		}
+	}
+
+	nodes := instanceZnodes("MYCLUSTER", config)
+	if r, err := NewRecordFromBytes(nodes[0].data); err != nil || nodes[0].path != kb.participantConfig("localhost_12913") || r.ID != "localhost_12913" {
+		t.Error("expect the instance config first")
+	}
+}
+
+func TestPartialDeleteError(t *testing.T) {
+	t.Parallel()
+
+	remaining := []string{}
+	for i := 0; i < 7; i++ {
+		remaining = append(remaining, fmt.Sprintf("/MYCLUSTER/INSTANCES/localhost_12913/STATUSUPDATES/%d", i))
+	}
+	remaining = append(remaining, "/MYCLUSTER/INSTANCES/localhost_12913/STATUSUPDATES", "/MYCLUSTER")
+
+	err := &PartialDeleteError{Path: "/MYCLUSTER", Remaining: remaining, Err: zk.ErrConnectionClosed}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "/MYCLUSTER partially deleted, 9 znodes left (") || !strings.Contains(msg, "STATUSUPDATES/4, ...)") {
+		t.Errorf("expect the remaining znodes named, got %s", msg)
+	}
+	if len(err.Remaining) != 9 {
+		t.Error("expect the remaining znodes kept whole")
+	}
+}
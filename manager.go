@@ -1,6 +1,9 @@
 package gohelix
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type changeNotificationType uint8
 type changeNotification struct {
@@ -16,6 +19,8 @@ const (
 	instanceConfigChanged     changeNotificationType = 4
 	controllerMessagesChanged changeNotificationType = 5
 	instanceMessagesChanged   changeNotificationType = 6
+	configChanged             changeNotificationType = 7
+	configWatchFailed         changeNotificationType = 8
 )
 
 type (
@@ -39,6 +44,11 @@ type (
 
 	// MessageListener is triggered when the instance received new messages
 	MessageListener func(instance string, messages []*Record, context *Context)
+
+	// ConfigChangeListener is triggered when one of the configs the effective value of a
+	// key is resolved from changes. The error is set when the value could not be read or
+	// the configs are no longer watched.
+	ConfigChangeListener func(value ConfigValue, err error, context *Context)
 )
 
 // HelixManager manages the Helix client connections and roles
@@ -99,3 +109,40 @@ func (m *HelixManager) NewParticipant(clusterID string, host string, port string
 		keys:          KeyBuilder{clusterID},
 	}
 }
+
+// NewController creates a new Helix controller for the cluster. Several controllers can
+// connect to the same cluster, one of them is elected as the leader and manages the
+// cluster while the others stand by.
+func (m *HelixManager) NewController(clusterID string, controllerID string) *Controller {
+	return &Controller{
+		ClusterID:         clusterID,
+		ControllerID:      controllerID,
+		RebalanceInterval: 30 * time.Second,
+		PurgeInterval:     time.Hour,
+		zkConnStr:         m.zkAddress,
+		keys:              KeyBuilder{clusterID},
+		changes:           make(chan struct{}, 1),
+	}
+}
+
+// NewDistributedController creates a controller that joins the super cluster as the
+// participant host_port, and manages the clusters it becomes the LEADER of.
+func (m *HelixManager) NewDistributedController(superClusterID string, host string, port string) *DistributedController {
+	participant := m.NewParticipant(superClusterID, host, port)
+
+	return &DistributedController{
+		manager:        m,
+		SuperClusterID: superClusterID,
+		ControllerID:   participant.ParticipantID,
+		participant:    participant,
+		controllers:    make(map[string]*Controller),
+	}
+}
+
+// NewConfigAccessor creates an accessor of the effective config values of the cluster
+func (m *HelixManager) NewConfigAccessor(clusterID string) *ConfigAccessor {
+	return &ConfigAccessor{
+		zkConnStr: m.zkAddress,
+		ClusterID: clusterID,
+	}
+}
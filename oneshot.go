@@ -0,0 +1,614 @@
+package gohelix
+
+import (
+	"time"
+)
+
+// The methods of Admin are one-shot: each opens a zookeeper session, runs the method of
+// the same name of AdminClient on it and closes it. Use an AdminClient to run many
+// operations on one session.
+
+// AddCluster is a wrapper around AdminClient.AddCluster
+func (adm Admin) AddCluster(cluster string) bool {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+
+	return client.AddCluster(cluster)
+}
+
+// SetConfig is a wrapper around AdminClient.SetConfig
+func (adm Admin) SetConfig(cluster string, scope string, properties map[string]string, scopeKeys ...string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.SetConfig(cluster, scope, properties, scopeKeys...)
+}
+
+// RemoveConfig is a wrapper around AdminClient.RemoveConfig
+func (adm Admin) RemoveConfig(cluster string, scope string, keys []string, scopeKeys ...string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.RemoveConfig(cluster, scope, keys, scopeKeys...)
+}
+
+// GetConfig is a wrapper around AdminClient.GetConfig
+func (adm Admin) GetConfig(cluster string, scope string, keys []string, scopeKeys ...string) (map[string]string, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.GetConfig(cluster, scope, keys, scopeKeys...)
+}
+
+// SetResourceConfig is a wrapper around AdminClient.SetResourceConfig
+func (adm Admin) SetResourceConfig(cluster string, resource string, properties map[string]string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.SetResourceConfig(cluster, resource, properties)
+}
+
+// GetResourceConfig is a wrapper around AdminClient.GetResourceConfig
+func (adm Admin) GetResourceConfig(cluster string, resource string, keys []string) (map[string]string, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.GetResourceConfig(cluster, resource, keys)
+}
+
+// SetClusterTopology is a wrapper around AdminClient.SetClusterTopology
+func (adm Admin) SetClusterTopology(cluster string, topology string, faultZoneType string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.SetClusterTopology(cluster, topology, faultZoneType)
+}
+
+// SetInstanceDomain is a wrapper around AdminClient.SetInstanceDomain
+func (adm Admin) SetInstanceDomain(cluster string, instance string, domain string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.SetInstanceDomain(cluster, instance, domain)
+}
+
+// SetInstanceCapacity is a wrapper around AdminClient.SetInstanceCapacity
+func (adm Admin) SetInstanceCapacity(cluster string, instance string, capacity map[string]int) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.SetInstanceCapacity(cluster, instance, capacity)
+}
+
+// SetPartitionWeight is a wrapper around AdminClient.SetPartitionWeight
+func (adm Admin) SetPartitionWeight(cluster string, resource string, partition string, weight map[string]int) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.SetPartitionWeight(cluster, resource, partition, weight)
+}
+
+// DropCluster is a wrapper around AdminClient.DropCluster
+func (adm Admin) DropCluster(cluster string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DropCluster(cluster)
+}
+
+// RepairCluster is a wrapper around AdminClient.RepairCluster
+func (adm Admin) RepairCluster(cluster string, dryRun bool) (*RepairReport, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.RepairCluster(cluster, dryRun)
+}
+
+// VerifyCluster is a wrapper around AdminClient.VerifyCluster
+func (adm Admin) VerifyCluster(cluster string, fix bool) (*VerifyReport, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.VerifyCluster(cluster, fix)
+}
+
+// AddNode is a wrapper around AdminClient.AddNode
+func (adm Admin) AddNode(cluster string, node string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.AddNode(cluster, node)
+}
+
+// DropNode is a wrapper around AdminClient.DropNode
+func (adm Admin) DropNode(cluster string, node string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DropNode(cluster, node)
+}
+
+// DropNodeForce is a wrapper around AdminClient.DropNodeForce
+func (adm Admin) DropNodeForce(cluster string, node string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DropNodeForce(cluster, node)
+}
+
+// AddResource is a wrapper around AdminClient.AddResource
+func (adm Admin) AddResource(cluster string, resource string, partitions int, stateModel string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.AddResource(cluster, resource, partitions, stateModel)
+}
+
+// DropResource is a wrapper around AdminClient.DropResource
+func (adm Admin) DropResource(cluster string, resource string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DropResource(cluster, resource)
+}
+
+// DropResourceAndWait is a wrapper around AdminClient.DropResourceAndWait
+func (adm Admin) DropResourceAndWait(cluster string, resource string, timeout time.Duration) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DropResourceAndWait(cluster, resource, timeout)
+}
+
+// AddStateModelDef is a wrapper around AdminClient.AddStateModelDef
+func (adm Admin) AddStateModelDef(cluster string, def *StateModelDefinition) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.AddStateModelDef(cluster, def)
+}
+
+// ListStateModelDefs is a wrapper around AdminClient.ListStateModelDefs
+func (adm Admin) ListStateModelDefs(cluster string) ([]string, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.ListStateModelDefs(cluster)
+}
+
+// GetStateModelDef is a wrapper around AdminClient.GetStateModelDef
+func (adm Admin) GetStateModelDef(cluster string, name string) (*StateModelDefinition, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.GetStateModelDef(cluster, name)
+}
+
+// ActivateCluster is a wrapper around AdminClient.ActivateCluster
+func (adm Admin) ActivateCluster(cluster string, superCluster string, enable bool) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.ActivateCluster(cluster, superCluster, enable)
+}
+
+// EnableInstance is a wrapper around AdminClient.EnableInstance
+func (adm Admin) EnableInstance(cluster string, instance string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.EnableInstance(cluster, instance)
+}
+
+// DisableInstance is a wrapper around AdminClient.DisableInstance
+func (adm Admin) DisableInstance(cluster string, instance string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DisableInstance(cluster, instance)
+}
+
+// EnablePartitions is a wrapper around AdminClient.EnablePartitions
+func (adm Admin) EnablePartitions(cluster string, instance string, resource string, partitions []string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.EnablePartitions(cluster, instance, resource, partitions)
+}
+
+// DisablePartitions is a wrapper around AdminClient.DisablePartitions
+func (adm Admin) DisablePartitions(cluster string, instance string, resource string, partitions []string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DisablePartitions(cluster, instance, resource, partitions)
+}
+
+// AddInstanceTag is a wrapper around AdminClient.AddInstanceTag
+func (adm Admin) AddInstanceTag(cluster string, instance string, tag string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.AddInstanceTag(cluster, instance, tag)
+}
+
+// RemoveInstanceTag is a wrapper around AdminClient.RemoveInstanceTag
+func (adm Admin) RemoveInstanceTag(cluster string, instance string, tag string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.RemoveInstanceTag(cluster, instance, tag)
+}
+
+// EvacuateInstance is a wrapper around AdminClient.EvacuateInstance
+func (adm Admin) EvacuateInstance(cluster string, instance string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.EvacuateInstance(cluster, instance)
+}
+
+// GetEvacuationProgress is a wrapper around AdminClient.GetEvacuationProgress
+func (adm Admin) GetEvacuationProgress(cluster string, instance string) (*EvacuationProgress, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.GetEvacuationProgress(cluster, instance)
+}
+
+// SwapInstance is a wrapper around AdminClient.SwapInstance
+func (adm Admin) SwapInstance(cluster string, oldInstance string, newInstance string, dryRun bool) ([]string, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.SwapInstance(cluster, oldInstance, newInstance, dryRun)
+}
+
+// EnableResource is a wrapper around AdminClient.EnableResource
+func (adm Admin) EnableResource(cluster string, resource string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.EnableResource(cluster, resource)
+}
+
+// DisableResource is a wrapper around AdminClient.DisableResource
+func (adm Admin) DisableResource(cluster string, resource string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DisableResource(cluster, resource)
+}
+
+// SetResourceInstanceGroupTag is a wrapper around AdminClient.SetResourceInstanceGroupTag
+func (adm Admin) SetResourceInstanceGroupTag(cluster string, resource string, tag string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.SetResourceInstanceGroupTag(cluster, resource, tag)
+}
+
+// Rebalance is a wrapper around AdminClient.Rebalance
+func (adm Admin) Rebalance(cluster string, resource string, replicationFactor int) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Rebalance(cluster, resource, replicationFactor)
+}
+
+// EnableMaintenanceMode is a wrapper around AdminClient.EnableMaintenanceMode
+func (adm Admin) EnableMaintenanceMode(cluster string, reason string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.EnableMaintenanceMode(cluster, reason)
+}
+
+// DisableMaintenanceMode is a wrapper around AdminClient.DisableMaintenanceMode
+func (adm Admin) DisableMaintenanceMode(cluster string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DisableMaintenanceMode(cluster)
+}
+
+// IsInMaintenanceMode is a wrapper around AdminClient.IsInMaintenanceMode
+func (adm Admin) IsInMaintenanceMode(cluster string) (bool, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	return client.IsInMaintenanceMode(cluster)
+}
+
+// PauseCluster is a wrapper around AdminClient.PauseCluster
+func (adm Admin) PauseCluster(cluster string, reason string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.PauseCluster(cluster, reason)
+}
+
+// ResumeCluster is a wrapper around AdminClient.ResumeCluster
+func (adm Admin) ResumeCluster(cluster string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.ResumeCluster(cluster)
+}
+
+// IsPaused is a wrapper around AdminClient.IsPaused
+func (adm Admin) IsPaused(cluster string) (bool, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	return client.IsPaused(cluster)
+}
+
+// GetClusterSnapshot is a wrapper around AdminClient.GetClusterSnapshot
+func (adm Admin) GetClusterSnapshot(cluster string) (*ClusterSnapshot, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.GetClusterSnapshot(cluster)
+}
+
+// WaitForConvergence is a wrapper around AdminClient.WaitForConvergence
+func (adm Admin) WaitForConvergence(cluster string, resources []string, timeout time.Duration) (*ConvergenceReport, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.WaitForConvergence(cluster, resources, timeout)
+}
+
+// ExportCluster is a wrapper around AdminClient.ExportCluster
+func (adm Admin) ExportCluster(cluster string) (*ClusterDefinition, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.ExportCluster(cluster)
+}
+
+// ImportCluster is a wrapper around AdminClient.ImportCluster
+func (adm Admin) ImportCluster(cluster string, d *ClusterDefinition, mode ConflictMode) (*ImportReport, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.ImportCluster(cluster, d, mode)
+}
+
+// PlanCluster is a wrapper around AdminClient.PlanCluster
+func (adm Admin) PlanCluster(spec *ClusterSpec, prune bool) (*ApplyPlan, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.PlanCluster(spec, prune)
+}
+
+// ApplyPlan is a wrapper around AdminClient.ApplyPlan
+func (adm Admin) ApplyPlan(plan *ApplyPlan) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.ApplyPlan(plan)
+}
+
+// ListClusterInfo is a wrapper around AdminClient.ListClusterInfo
+func (adm Admin) ListClusterInfo(cluster string) (*ClusterInfo, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.ListClusterInfo(cluster)
+}
+
+// ListClusters is a wrapper around AdminClient.ListClusters
+func (adm Admin) ListClusters() ([]string, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.ListClusters()
+}
+
+// ListResources is a wrapper around AdminClient.ListResources
+func (adm Admin) ListResources(cluster string) ([]string, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.ListResources(cluster)
+}
+
+// ListInstances is a wrapper around AdminClient.ListInstances
+func (adm Admin) ListInstances(cluster string) ([]string, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.ListInstances(cluster)
+}
+
+// ListInstanceInfo is a wrapper around AdminClient.ListInstanceInfo
+func (adm Admin) ListInstanceInfo(cluster string, instance string) (*InstanceConfig, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.ListInstanceInfo(cluster, instance)
+}
+
+// GetInstances is a wrapper around AdminClient.GetInstances
+func (adm Admin) GetInstances(cluster string) ([]*InstanceConfig, error) {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.GetInstances(cluster)
+}
+
+// DropInstance is a wrapper around AdminClient.DropInstance
+func (adm Admin) DropInstance(cluster string, instance string) error {
+	client, err := NewAdminClient(adm.ZkSvr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.DropInstance(cluster, instance)
+}
@@ -126,6 +126,15 @@ func (p *Participant) Connect() error {
 	// bring this participant alive.
 	p.createLiveInstance()
 
+	// clear the offline time so the delayed rebalance does not count a
+	// stale value against this participant
+	err := setLastOfflineTime(p.conn, p.keys, p.ParticipantID, -1)
+	must(err)
+
+	// and record the new session, for the flapping detection of the controller
+	_, err = recordSession(p.conn, p.keys, p.ParticipantID, p.conn.GetSessionID(), time.Now().UnixNano()/1000000)
+	must(err)
+
 	// block on p.started
 	// <-p.started
 	return nil
@@ -167,6 +176,12 @@ func (p *Participant) Disconnect() {
 	}
 
 	if p.conn.IsConnected() {
+		// record when this participant went offline for the delayed rebalance
+		nowMilli := time.Now().UnixNano() / 1000000
+		if err := setLastOfflineTime(p.conn, p.keys, p.ParticipantID, nowMilli); err != nil {
+			Logger.Printf("Failed to set the offline time of %s: %s\n", p.ParticipantID, err.Error())
+		}
+
 		p.conn.Disconnect()
 	}
 
@@ -286,6 +301,12 @@ func (p *Participant) processMessage(msgID string) {
 	fmt.Println("Process message: " + msgID)
 
 	msgPath := p.keys.message(p.ParticipantID, msgID)
+
+	// the message is gone if it was cancelled after it was listed
+	if exists, _ := p.conn.Exists(msgPath); !exists {
+		return
+	}
+
 	message, err := p.conn.GetRecordFromPath(msgPath)
 	must(err)
 
@@ -317,6 +338,14 @@ func (p *Participant) processMessage(msgID string) {
 		return
 	}
 
+	if msgType == cancellationMessageType {
+		if err := p.cancelMessage(message); err != nil {
+			Logger.Printf("Failed to cancel message %s: %s\n", message.GetSimpleField(cancelledMessageIDKey), err.Error())
+		}
+		p.conn.DeleteTree(msgPath)
+		return
+	}
+
 	// update msgState to read
 	message.SetSimpleField("MSG_STATE", "READ")
 	message.SetSimpleField("READ_TIMESTAMP", time.Now().Unix())
@@ -364,6 +393,30 @@ func (p *Participant) processMessage(msgID string) {
 	p.conn.DeleteTree(msgPath)
 }
 
+// cancelMessage removes the state transition a cancellation message refers to, unless the
+// transition has already started. A message that is already gone is not an error.
+func (p *Participant) cancelMessage(cancellation *Record) error {
+	msgID, ok := cancellation.GetSimpleField(cancelledMessageIDKey).(string)
+	if !ok {
+		return nil
+	}
+
+	msgPath := p.keys.message(p.ParticipantID, msgID)
+	message, err := readRecordIfExists(p.conn, msgPath)
+	if err != nil || message == nil {
+		return err
+	}
+
+	if msgState, _ := message.GetSimpleField("MSG_STATE").(string); strings.EqualFold(msgState, "NEW") {
+		Logger.Printf("Cancelling message %s\n", msgID)
+		if err := p.conn.zkConn.Delete(msgPath, -1); err != nil && err != zk.ErrNoNode {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (p *Participant) handleStateTransition(message *Record) {
 	// verify the fromState with the current state model
 	fromState := message.GetSimpleField("FROM_STATE").(string)
@@ -377,12 +430,33 @@ func (p *Participant) handleStateTransition(message *Record) {
 	message.SetSimpleField("EXECUTE_START_TIMESTAMP", startTime)
 
 	p.preHandleMessage(message)
-	// TODO: invoke state model transition function
+
+	stateModelDef, _ := message.GetSimpleField("STATE_MODEL_DEF").(string)
+	partitionName, _ := message.GetSimpleField("PARTITION_NAME").(string)
+	if handler := p.transitionHandler(stateModelDef, fromState, toState); handler != nil {
+		handler(partitionName)
+	}
 
 	p.postHandleMessage(message)
 
 }
 
+// transitionHandler returns the handler registered for a transition of the state model,
+// or nil if there is none.
+func (p *Participant) transitionHandler(stateModelDef string, fromState string, toState string) func(string) {
+	sm, ok := p.stateModels[stateModelDef]
+	if !ok {
+		return nil
+	}
+
+	for _, t := range sm.transitions {
+		if strings.EqualFold(t.FromState, fromState) && strings.EqualFold(t.ToState, toState) {
+			return t.Handler
+		}
+	}
+	return nil
+}
+
 func (p *Participant) preHandleMessage(message *Record) {
 
 }
@@ -97,3 +97,29 @@ func TestPreConnectedCallback(t *testing.T) {
 	}
 
 }
+
+func TestTransitionHandler(t *testing.T) {
+	t.Parallel()
+
+	manager := NewHelixManager(testZkSvr)
+	p := manager.NewParticipant("MYCLUSTER", "localhost", "12913")
+
+	handled := ""
+	p.RegisterStateModel("OnlineOffline", NewStateModel([]Transition{
+		{"OFFLINE", "ONLINE", func(partition string) { handled = partition }},
+	}))
+
+	handler := p.transitionHandler("OnlineOffline", "OFFLINE", "ONLINE")
+	if handler == nil {
+		t.Fatal("expect the OFFLINE-ONLINE handler")
+	}
+
+	handler("myDB_0")
+	if handled != "myDB_0" {
+		t.Error("expect the handler to be called with the partition")
+	}
+
+	if p.transitionHandler("OnlineOffline", "ONLINE", "OFFLINE") != nil || p.transitionHandler("MasterSlave", "OFFLINE", "ONLINE") != nil {
+		t.Error("expect no handler for the transitions that are not registered")
+	}
+}
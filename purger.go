@@ -0,0 +1,180 @@
+package gohelix
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/yichen/go-zookeeper/zk"
+)
+
+// statusUpdateTTLKey in the cluster config is the time in milliseconds the status updates
+// and errors of the controller and of the instances are kept, a day by default
+const (
+	statusUpdateTTLKey     = "STATUS_UPDATE_TTL"
+	defaultStatusUpdateTTL = 24 * time.Hour
+)
+
+// recordPipelineRun saves the outcome of a pipeline run: a status update with the sent
+// messages under /<cluster>/CONTROLLER/STATUSUPDATES/<session>, or the error under
+// /<cluster>/CONTROLLER/ERRORS/<session>.
+func (c *Controller) recordPipelineRun(start time.Time, sent []*Record, pipelineErr error) {
+	now := time.Now()
+	session := c.conn.GetSessionID()
+	id := newMessageID()
+
+	record := NewRecord(id)
+	record.SetSimpleField("CONTROLLER", c.ControllerID)
+	record.SetSimpleField("START_TIME", strconv.FormatInt(start.UnixNano()/1000000, 10))
+	record.SetSimpleField("END_TIME", strconv.FormatInt(now.UnixNano()/1000000, 10))
+	record.SetSimpleField("TOTAL_TIME", strconv.FormatInt(int64(now.Sub(start)/time.Millisecond), 10))
+
+	path := c.keys.controllerStatusUpdate(session, id)
+	if pipelineErr != nil {
+		record.SetSimpleField("ERROR", pipelineErr.Error())
+		path = c.keys.controllerError(session, id)
+	} else {
+		record.SetIntField("MESSAGES", len(sent))
+		for _, m := range sent {
+			for _, field := range []string{"MSG_TYPE", "TGT_NAME", "RESOURCE_NAME", "PARTITION_NAME", "FROM_STATE", "TO_STATE"} {
+				if v, ok := m.GetSimpleField(field).(string); ok {
+					record.SetMapField(m.ID, field, v)
+				}
+			}
+		}
+	}
+
+	if err := c.conn.SetRecordForPath(path, record); err != nil {
+		Logger.Printf("Failed to save %s: %s\n", path, err.Error())
+	}
+}
+
+// recordLeadership adds this controller to the leadership history of the cluster in
+// /<cluster>/CONTROLLER/HISTORY
+func (c *Controller) recordLeadership() {
+	path := c.keys.controllerHistory()
+
+	history := NewRecord(c.ClusterID)
+	if exists, _ := c.conn.Exists(path); exists {
+		r, err := c.conn.GetRecordFromPath(path)
+		if err != nil {
+			return
+		}
+		history = r
+	}
+
+	appendHistoryEntry(history, sessionHistoryKey, map[string]string{
+		"CONTROLLER": c.ControllerID,
+		"SESSION":    c.conn.GetSessionID(),
+	}, time.Now().UnixNano()/1000000)
+
+	if err := c.conn.SetRecordForPath(path, history); err != nil {
+		Logger.Printf("Failed to save %s: %s\n", path, err.Error())
+	}
+}
+
+// purgeLoop purges the old status updates and errors every PurgeInterval, while this
+// controller is the leader
+func (c *Controller) purgeLoop() {
+	stopWatch := c.stopWatch
+
+	go func() {
+		ticker := time.NewTicker(c.PurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-stopWatch:
+				return
+			}
+
+			if !c.IsLeader() {
+				continue
+			}
+
+			if err := c.purge(); err != nil {
+				Logger.Printf("Controller %s failed to purge %s: %s\n", c.ControllerID, c.ClusterID, err.Error())
+			}
+		}
+	}()
+}
+
+// purge deletes the status updates and errors of the controller and of the instances
+// that are older than the STATUS_UPDATE_TTL. It works on the zookeeper connection
+// directly, so that it can run along with the pipeline.
+func (c *Controller) purge() error {
+	zkConn := c.conn.zkConn
+
+	ttl := int64(defaultStatusUpdateTTL / time.Millisecond)
+	if data, _, err := zkConn.Get(c.keys.clusterConfig()); err == nil {
+		if config, err := NewRecordFromBytes(data); err == nil {
+			ttl = int64(config.GetIntField(statusUpdateTTLKey, int(ttl)))
+		}
+	}
+	cutoff := time.Now().UnixNano()/1000000 - ttl
+
+	paths := []string{c.keys.controllerStatusUpdates(), c.keys.controllerErrors()}
+
+	instances, _, err := zkConn.Children(c.keys.instances())
+	if err != nil {
+		return err
+	}
+	for _, i := range instances {
+		paths = append(paths, c.keys.statusUpdates(i), c.keys.errorsR(i))
+	}
+
+	for _, path := range paths {
+		if _, err := purgeTree(zkConn, path, cutoff); err != nil && err != zk.ErrNoNode {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgeTree deletes the znodes under the path that were last modified before the cutoff
+// time in milliseconds, and the parents they leave empty. It returns whether the path is
+// left empty.
+func purgeTree(zkConn *zk.Conn, path string, cutoff int64) (bool, error) {
+	children, _, err := zkConn.Children(path)
+	if err != nil {
+		return false, err
+	}
+
+	empty := true
+	for _, child := range children {
+		p := path + "/" + child
+
+		_, stat, err := zkConn.Get(p)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if stat.NumChildren > 0 {
+			childEmpty, err := purgeTree(zkConn, p, cutoff)
+			if err != nil && err != zk.ErrNoNode {
+				return false, err
+			}
+			if !childEmpty {
+				empty = false
+				continue
+			}
+		} else if stat.Mtime >= cutoff {
+			empty = false
+			continue
+		}
+
+		if err := zkConn.Delete(p, -1); err != nil && err != zk.ErrNoNode {
+			// a znode created meanwhile keeps its parent
+			if err != zk.ErrNotEmpty {
+				return false, err
+			}
+			empty = false
+		}
+	}
+
+	return empty, nil
+}
@@ -0,0 +1,48 @@
+package gohelix
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgeTree(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Local()
+	cluster := "purger_test_TestPurgeTree_" + now.Format("20060102150405")
+
+	a := Admin{testZkSvr}
+	a.AddCluster(cluster)
+	defer a.DropCluster(cluster)
+
+	conn := newConnection(testZkSvr)
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Disconnect()
+
+	keys := KeyBuilder{cluster}
+	path := keys.controllerStatusUpdate("session", "update")
+	if err := conn.SetRecordForPath(path, NewRecord("update")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the status update is newer than the cutoff
+	if _, err := purgeTree(conn.zkConn, keys.controllerStatusUpdates(), 0); err != nil {
+		t.Error(err)
+	}
+	if exists, _ := conn.Exists(path); !exists {
+		t.Error("expect the recent status update to be kept")
+	}
+
+	cutoff := time.Now().Add(time.Minute).UnixNano() / 1000000
+	if _, err := purgeTree(conn.zkConn, keys.controllerStatusUpdates(), cutoff); err != nil {
+		t.Error(err)
+	}
+	if exists, _ := conn.Exists(keys.controllerStatusUpdates() + "/session"); exists {
+		t.Error("expect the old status update and its session to be purged")
+	}
+	if exists, _ := conn.Exists(keys.controllerStatusUpdates()); !exists {
+		t.Error("expect STATUSUPDATES to be kept")
+	}
+}
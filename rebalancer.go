@@ -0,0 +1,625 @@
+package gohelix
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rebalancer computes the best possible state of the replicas of a resource. The
+// controller picks the rebalancer of a resource by the REBALANCER_CLASS_NAME of its
+// resource config or ideal state, see RegisterRebalancer. Without a class name, the
+// built-in rebalancer of the REBALANCE_MODE is used.
+type Rebalancer interface {
+	// ComputeAssignment returns the states the replicas of the resource should be in.
+	// The snapshot is shared with the other resources and must not be modified.
+	ComputeAssignment(idealState *Record, snapshot *ClusterSnapshot) (*ResourceAssignment, error)
+}
+
+// RebalancerFunc is an adapter to use an ordinary function as a Rebalancer
+type RebalancerFunc func(idealState *Record, snapshot *ClusterSnapshot) (*ResourceAssignment, error)
+
+// ComputeAssignment calls f(idealState, snapshot)
+func (f RebalancerFunc) ComputeAssignment(idealState *Record, snapshot *ClusterSnapshot) (*ResourceAssignment, error) {
+	return f(idealState, snapshot)
+}
+
+// ResourceAssignment maps each partition of a resource to the states of its replicas,
+// by instance. Replicas that are not in the assignment are left as they are, use
+// DROPPED to remove a replica from an instance.
+type ResourceAssignment struct {
+	Resource   string
+	Partitions map[string]map[string]string
+}
+
+// NewResourceAssignment creates an empty assignment for the resource
+func NewResourceAssignment(resource string) *ResourceAssignment {
+	return &ResourceAssignment{
+		Resource:   resource,
+		Partitions: make(map[string]map[string]string),
+	}
+}
+
+// SetState sets the state of the replica of a partition on an instance
+func (a *ResourceAssignment) SetState(partition string, instance string, state string) {
+	if a.Partitions[partition] == nil {
+		a.Partitions[partition] = make(map[string]string)
+	}
+	a.Partitions[partition][instance] = state
+}
+
+// GetStates returns the states of the replicas of a partition, by instance
+func (a *ResourceAssignment) GetStates(partition string) map[string]string {
+	return a.Partitions[partition]
+}
+
+// Class names of the built-in rebalancers, the same as the ones in the Java Helix
+// controller. The weight aware rebalancer is selected by wagedRebalancerClassName.
+const (
+	autoRebalancerClassName        = "org.apache.helix.controller.rebalancer.AutoRebalancer"
+	delayedAutoRebalancerClassName = "org.apache.helix.controller.rebalancer.DelayedAutoRebalancer"
+	semiAutoRebalancerClassName    = "org.apache.helix.controller.rebalancer.SemiAutoRebalancer"
+	customRebalancerClassName      = "org.apache.helix.controller.rebalancer.CustomRebalancer"
+)
+
+var (
+	rebalancersLock sync.RWMutex
+
+	rebalancers = map[string]Rebalancer{
+		autoRebalancerClassName:        RebalancerFunc(fullAutoRebalance),
+		delayedAutoRebalancerClassName: RebalancerFunc(fullAutoRebalance),
+		wagedRebalancerClassName:       RebalancerFunc(fullAutoRebalance),
+		semiAutoRebalancerClassName:    RebalancerFunc(semiAutoRebalance),
+		customRebalancerClassName:      RebalancerFunc(customizedRebalance),
+	}
+)
+
+// RegisterRebalancer makes a rebalancer available to the controller under a name. The
+// resources with the name as their REBALANCER_CLASS_NAME are rebalanced by it. A
+// rebalancer registered under an existing name replaces the existing one.
+func RegisterRebalancer(name string, rebalancer Rebalancer) {
+	rebalancersLock.Lock()
+	defer rebalancersLock.Unlock()
+
+	rebalancers[name] = rebalancer
+}
+
+// getRebalancer returns the rebalancer of a resource. The resource config can be nil.
+// It returns false if the REBALANCER_CLASS_NAME is not registered.
+func getRebalancer(idealState *Record, resourceConfig *Record) (Rebalancer, bool) {
+	rebalancersLock.RLock()
+	defer rebalancersLock.RUnlock()
+
+	if name := getRebalancerClassName(idealState, resourceConfig); name != "" {
+		r, ok := rebalancers[name]
+		return r, ok
+	}
+
+	mode, _ := idealState.GetSimpleField("REBALANCE_MODE").(string)
+	switch strings.ToUpper(mode) {
+	case "FULL_AUTO":
+		return rebalancers[delayedAutoRebalancerClassName], true
+	case "CUSTOMIZED":
+		return rebalancers[customRebalancerClassName], true
+	}
+
+	return rebalancers[semiAutoRebalancerClassName], true
+}
+
+// getReplicas returns the replication factor of a resource. ANY_LIVEINSTANCE means one
+// replica on each live instance with the INSTANCE_GROUP_TAG of the resource. It returns 0
+// if the replication factor is not set.
+func getReplicas(idealState *Record, snapshot *ClusterSnapshot) int {
+	if replicas, _ := idealState.GetSimpleField("REPLICAS").(string); replicas == "ANY_LIVEINSTANCE" {
+		n := 0
+		for i := range snapshot.LiveInstances {
+			if snapshot.HasInstanceGroupTag(i, idealState.ID) {
+				n++
+			}
+		}
+		return n
+	}
+	return idealState.GetIntField("REPLICAS", 0)
+}
+
+// semiAutoRebalance places the replicas on the preference lists of the ideal state
+func semiAutoRebalance(idealState *Record, snapshot *ClusterSnapshot) (*ResourceAssignment, error) {
+	resource := idealState.ID
+	stateModelDef, err := snapshot.stateModelDefOf(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewResourceAssignment(resource)
+	replicas := getReplicas(idealState, snapshot)
+
+	for _, p := range snapshot.Partitions(resource) {
+		list := idealState.GetListField(p)
+		for i, state := range computePartitionStates(snapshot, stateModelDef, resource, p, list, replicas) {
+			result.SetState(p, i, state)
+		}
+	}
+
+	return result, nil
+}
+
+// fullAutoRebalance computes the preference lists of the resource, see
+// ClusterSnapshot.computePreferenceLists, and places the replicas on them. The instances
+// currently holding the replicas are kept when possible, the ones in the higher states
+// first.
+func fullAutoRebalance(idealState *Record, snapshot *ClusterSnapshot) (*ResourceAssignment, error) {
+	resource := idealState.ID
+	stateModelDef, err := snapshot.stateModelDefOf(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := snapshot.Partitions(resource)
+	replicas := getReplicas(idealState, snapshot)
+
+	current := make(map[string][]string)
+	for _, p := range partitions {
+		current[p] = orderByState(stateModelDef, snapshot.CurrentStateMap(resource, p))
+	}
+
+	lists, err := snapshot.computePreferenceLists(resource, partitions, replicas, current)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewResourceAssignment(resource)
+	for _, p := range partitions {
+		for i, state := range computePartitionStates(snapshot, stateModelDef, resource, p, lists[p], replicas) {
+			result.SetState(p, i, state)
+		}
+	}
+
+	return result, nil
+}
+
+// customizedRebalance places the replicas as set in the map fields of the ideal state.
+// Replicas on instances that are not live are left out, and those on disabled instances
+// or partitions, or on instances without the INSTANCE_GROUP_TAG of the resource, go back
+// to the initial state.
+func customizedRebalance(idealState *Record, snapshot *ClusterSnapshot) (*ResourceAssignment, error) {
+	resource := idealState.ID
+	stateModelDef, err := snapshot.stateModelDefOf(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewResourceAssignment(resource)
+
+	for _, p := range snapshot.Partitions(resource) {
+		states := idealState.MapFields[p]
+
+		for i, state := range states {
+			if !snapshot.IsLive(i) {
+				continue
+			}
+
+			if !snapshot.IsEnabled(i) || !snapshot.IsPartitionEnabled(i, resource, p) || !snapshot.HasInstanceGroupTag(i, resource) {
+				state = initialState(stateModelDef)
+			}
+			result.SetState(p, i, state)
+		}
+
+		for i := range snapshot.CurrentStateMap(resource, p) {
+			if _, ok := states[i]; !ok {
+				result.SetState(p, i, droppedState)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// computePartitionStates assigns the states of the state model to the live and enabled
+// instances of the preference list, the highest states first, up to the count of each
+// state. Replicas in the ERROR state stay as they are. Replicas on disabled instances, of
+// partitions disabled on their instance, or on instances without the INSTANCE_GROUP_TAG
+// of the resource, are brought back to the initial state, and replicas on instances that
+// are not in the preference list are dropped. The replicas on evacuating instances are
+// kept until the replicas that replace them are up, and meanwhile count toward the states
+// with a fixed count, so that the replacement of a MASTER is a SLAVE until the handoff.
+func computePartitionStates(snapshot *ClusterSnapshot, stateModelDef *Record, resource string, partition string, list []string, replicas int) map[string]string {
+	result := make(map[string]string)
+	current := snapshot.CurrentStateMap(resource, partition)
+
+	if replicas <= 0 {
+		replicas = len(list)
+	}
+
+	eligible := []string{}
+	for _, i := range list {
+		if !snapshot.IsLive(i) || !snapshot.IsEnabled(i) || !snapshot.IsPartitionEnabled(i, resource, partition) ||
+			!snapshot.HasInstanceGroupTag(i, resource) || snapshot.IsEvacuating(i) {
+			continue
+		}
+
+		if current[i] == errorState {
+			result[i] = errorState
+			continue
+		}
+
+		eligible = append(eligible, i)
+	}
+
+	assignStates(stateModelDef, eligible, replicas, nil, result)
+
+	ready := replicasReady(stateModelDef, result, current)
+	if !ready {
+		held := make(map[string]int)
+		for i, state := range current {
+			if _, ok := result[i]; !ok && snapshot.IsEvacuating(i) && isStateCountFixed(stateModelDef, state) {
+				held[state]++
+			}
+		}
+		if len(held) > 0 {
+			assignStates(stateModelDef, eligible, replicas, held, result)
+		}
+	}
+
+	for i := range current {
+		if _, ok := result[i]; ok {
+			continue
+		}
+
+		if snapshot.IsEvacuating(i) && !ready {
+			result[i] = current[i]
+			continue
+		}
+
+		if contains(list, i) {
+			result[i] = initialState(stateModelDef)
+		} else {
+			result[i] = droppedState
+		}
+	}
+
+	return result
+}
+
+// assignStates assigns the states of the state model to the instances in order, the
+// highest states first, up to the count of each state less the replicas held in it
+// elsewhere. The instances left over get the initial state.
+func assignStates(stateModelDef *Record, instances []string, replicas int, held map[string]int, result map[string]string) {
+	assigned := 0
+	for _, state := range statePriorities(stateModelDef) {
+		count := stateCount(stateModelDef, state, replicas, len(instances))
+		if count < 0 {
+			continue
+		}
+
+		for n := held[state]; n < count && assigned < len(instances); n++ {
+			result[instances[assigned]] = state
+			assigned++
+		}
+	}
+
+	for _, i := range instances[assigned:] {
+		result[i] = initialState(stateModelDef)
+	}
+}
+
+// replicasReady tests if the replicas assigned to be up are up: there is at least one,
+// and all of them are out of the initial state
+func replicasReady(stateModelDef *Record, assigned map[string]string, current map[string]string) bool {
+	initial := initialState(stateModelDef)
+
+	up := 0
+	for i, state := range assigned {
+		if state == initial || state == errorState || state == droppedState {
+			continue
+		}
+
+		if current[i] == "" || current[i] == initial || current[i] == errorState {
+			return false
+		}
+		up++
+	}
+	return up > 0
+}
+
+// orderByState returns the instances of a state map from the highest state to the lowest.
+// Replicas that are dropped or in error are left out.
+func orderByState(stateModelDef *Record, states map[string]string) []string {
+	result := []string{}
+	for _, state := range statePriorities(stateModelDef) {
+		if state == droppedState || state == errorState {
+			continue
+		}
+
+		instances := []string{}
+		for i, s := range states {
+			if s == state {
+				instances = append(instances, i)
+			}
+		}
+		sort.Strings(instances)
+		result = append(result, instances...)
+	}
+	return result
+}
+
+// Keys of the delayed rebalance settings. DELAY_REBALANCE_ENABLED and DELAY_REBALANCE_TIME
+// are read from the cluster config and can be overridden in the resource config.
+// DELAY_REBALANCE_TIME is in milliseconds. MIN_ACTIVE_REPLICAS is read from the ideal
+// state and can be overridden in the resource config.
+const (
+	delayRebalanceEnabledKey = "DELAY_REBALANCE_ENABLED"
+	delayRebalanceTimeKey    = "DELAY_REBALANCE_TIME"
+	minActiveReplicasKey     = "MIN_ACTIVE_REPLICAS"
+)
+
+// delayedRebalanceConfig is the effective delayed rebalance setting of a resource
+type delayedRebalanceConfig struct {
+	enabled           bool
+	delay             time.Duration
+	minActiveReplicas int
+}
+
+// getDelayedRebalanceConfig merges the delayed rebalance settings of the cluster config,
+// the ideal state and the resource config. The resource config can be nil. Delayed
+// rebalance is on when a positive delay is set and it is not explicitly disabled.
+func getDelayedRebalanceConfig(clusterConfig *Record, idealState *Record, resourceConfig *Record) delayedRebalanceConfig {
+	enabled := true
+	delay := -1
+	minActive := -1
+
+	for _, r := range []*Record{clusterConfig, idealState, resourceConfig} {
+		if r == nil {
+			continue
+		}
+
+		enabled = r.GetBooleanField(delayRebalanceEnabledKey, enabled)
+		delay = r.GetIntField(delayRebalanceTimeKey, delay)
+		minActive = r.GetIntField(minActiveReplicasKey, minActive)
+	}
+
+	return delayedRebalanceConfig{
+		enabled:           enabled && delay > 0,
+		delay:             time.Duration(delay) * time.Millisecond,
+		minActiveReplicas: minActive,
+	}
+}
+
+// minActive returns the number of live replicas each partition must keep. By default
+// all replicas must be live.
+func (cfg delayedRebalanceConfig) minActive(replicas int) int {
+	if cfg.minActiveReplicas < 0 || cfg.minActiveReplicas > replicas {
+		return replicas
+	}
+	return cfg.minActiveReplicas
+}
+
+// partitionNames returns the names of the partitions of a resource, in the form of
+// <resource>_<n>
+func partitionNames(resource string, partitions int) []string {
+	result := make([]string, partitions)
+	for i := 0; i < partitions; i++ {
+		result[i] = resource + "_" + strconv.Itoa(i)
+	}
+	return result
+}
+
+// activeInstances returns the instances that can be assigned replicas. These are the
+// live instances, plus the offline instances that are still in the delay window when
+// delayed rebalance is enabled. offlineTimes maps an offline instance to the time in
+// milliseconds it went offline.
+func activeInstances(instances []string, live map[string]bool, offlineTimes map[string]int64, cfg delayedRebalanceConfig, now time.Time) []string {
+	result := []string{}
+	nowMilli := now.UnixNano() / 1000000
+	delayMilli := int64(cfg.delay / time.Millisecond)
+
+	for _, instance := range instances {
+		if live[instance] {
+			result = append(result, instance)
+			continue
+		}
+
+		if !cfg.enabled {
+			continue
+		}
+
+		if offlineTime, ok := offlineTimes[instance]; ok && offlineTime >= 0 && nowMilli-offlineTime < delayMilli {
+			result = append(result, instance)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// computePreferenceLists assigns the replicas of each partition to the instances. The
+// current preference lists are kept as long as the instances are still available and
+// not overloaded, so that a rebalance moves as few replicas as possible. The first
+// instance of a preference list is the preferred one for the top state.
+//
+// zones maps the instances to their fault zones, no two replicas of a partition are
+// placed in the same fault zone. With nil zones each instance is its own fault zone.
+func computePreferenceLists(partitions []string, replicas int, instances []string, zones map[string]string, current map[string][]string) map[string][]string {
+	result := make(map[string][]string)
+
+	if n := countZones(instances, zones); replicas > n {
+		replicas = n
+	}
+
+	if replicas <= 0 {
+		for _, p := range partitions {
+			result[p] = []string{}
+		}
+		return result
+	}
+
+	available := make(map[string]bool)
+	for _, i := range instances {
+		available[i] = true
+	}
+
+	// the upper bound of replicas an instance can hold to keep the load balanced
+	capacity := (len(partitions)*replicas + len(instances) - 1) / len(instances)
+	load := make(map[string]int)
+
+	// keep the current assignments that are still valid
+	for _, p := range partitions {
+		list := []string{}
+		for _, i := range current[p] {
+			if len(list) == replicas {
+				break
+			}
+
+			if available[i] && load[i] < capacity && !sharesZone(zones, list, i) {
+				list = append(list, i)
+				load[i]++
+			}
+		}
+		result[p] = list
+	}
+
+	// fill in the missing replicas with the least loaded instances
+	for n, p := range partitions {
+		list := result[p]
+		for len(list) < replicas {
+			i := leastLoaded(instances, load, zones, list, n)
+			list = append(list, i)
+			load[i]++
+		}
+		result[p] = list
+	}
+
+	return result
+}
+
+// ensureMinActiveReplicas appends live instances to the preference lists that have fewer
+// than minActive live instances. This keeps the partitions available while offline
+// instances hold on to their replicas during the delay window. The fault zones are
+// respected, so a partition may stay below minActive if no fault zone is left.
+func ensureMinActiveReplicas(lists map[string][]string, partitions []string, live []string, zones map[string]string, minActive int) {
+	isLive := make(map[string]bool)
+	for _, i := range live {
+		isLive[i] = true
+	}
+
+	load := make(map[string]int)
+	for _, list := range lists {
+		for _, i := range list {
+			if isLive[i] {
+				load[i]++
+			}
+		}
+	}
+
+	for n, p := range partitions {
+		list := lists[p]
+
+		active := 0
+		for _, i := range list {
+			if isLive[i] {
+				active++
+			}
+		}
+
+		for active < minActive {
+			i := leastLoaded(live, load, zones, list, n)
+			if i == "" {
+				break
+			}
+
+			list = append(list, i)
+			load[i]++
+			active++
+		}
+
+		lists[p] = list
+	}
+}
+
+// balanceLeaders reorders the preference lists so that each instance is first in about
+// the same number of lists, since the first instance gets the top state. An instance
+// only takes the lead of a partition from one that leads at least two more partitions,
+// so balanced lists are left as they are.
+func balanceLeaders(lists map[string][]string, partitions []string) {
+	leads := make(map[string]int)
+	for _, p := range partitions {
+		if len(lists[p]) > 0 {
+			leads[lists[p][0]]++
+		}
+	}
+
+	for moved := true; moved; {
+		moved = false
+
+		for _, p := range partitions {
+			list := lists[p]
+			for k := 1; k < len(list); k++ {
+				if leads[list[0]]-leads[list[k]] >= 2 {
+					leads[list[0]]--
+					leads[list[k]]++
+					list[0], list[k] = list[k], list[0]
+					moved = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// leastLoaded returns the instance with the fewest replicas that does not share a
+// fault zone with the instances in exclude. Ties are broken by rotating the starting
+// position with offset, so that partitions are spread evenly. It returns an empty
+// string if no instance is left.
+func leastLoaded(instances []string, load map[string]int, zones map[string]string, exclude []string, offset int) string {
+	result := ""
+	for k := 0; k < len(instances); k++ {
+		i := instances[(offset+k)%len(instances)]
+		if sharesZone(zones, exclude, i) {
+			continue
+		}
+
+		if result == "" || load[i] < load[result] {
+			result = i
+		}
+	}
+	return result
+}
+
+// zoneOf returns the fault zone of an instance. An instance without a fault zone
+// is its own fault zone.
+func zoneOf(zones map[string]string, instance string) string {
+	if zone, ok := zones[instance]; ok {
+		return zone
+	}
+	return instance
+}
+
+// sharesZone tests if the instance is in the same fault zone as any instance in list
+func sharesZone(zones map[string]string, list []string, instance string) bool {
+	zone := zoneOf(zones, instance)
+	for _, i := range list {
+		if zoneOf(zones, i) == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// countZones returns the number of fault zones the instances are in
+func countZones(instances []string, zones map[string]string) int {
+	seen := make(map[string]bool)
+	for _, i := range instances {
+		seen[zoneOf(zones, i)] = true
+	}
+	return len(seen)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
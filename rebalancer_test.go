@@ -0,0 +1,195 @@
+package gohelix
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputePreferenceLists(t *testing.T) {
+	t.Parallel()
+
+	partitions := partitionNames("myDB", 6)
+	instances := []string{"localhost_12913", "localhost_12914", "localhost_12915"}
+
+	lists := computePreferenceLists(partitions, 2, instances, nil, nil)
+
+	load := map[string]int{}
+	for _, p := range partitions {
+		list := lists[p]
+		if len(list) != 2 {
+			t.Errorf("partition %s should have 2 replicas, but has %d", p, len(list))
+		}
+		if list[0] == list[1] {
+			t.Errorf("partition %s has two replicas on the same instance", p)
+		}
+		for _, i := range list {
+			load[i]++
+		}
+	}
+
+	for _, i := range instances {
+		if load[i] != 4 {
+			t.Errorf("instance %s should have 4 replicas, but has %d", i, load[i])
+		}
+	}
+
+	// adding an instance should only move the replicas it takes over
+	added := append(instances, "localhost_12916")
+	rebalanced := computePreferenceLists(partitions, 2, added, nil, lists)
+
+	moved := 0
+	for _, p := range partitions {
+		for _, i := range rebalanced[p] {
+			if !contains(lists[p], i) {
+				moved++
+			}
+		}
+	}
+
+	if moved != 3 {
+		t.Errorf("expect 3 replicas to move to the new instance, but %d moved", moved)
+	}
+}
+
+func TestComputePreferenceListsNotEnoughInstances(t *testing.T) {
+	t.Parallel()
+
+	partitions := partitionNames("myDB", 2)
+
+	lists := computePreferenceLists(partitions, 3, []string{"localhost_12913"}, nil, nil)
+	if len(lists["myDB_0"]) != 1 || len(lists["myDB_1"]) != 1 {
+		t.Error("replicas should be capped by the number of instances")
+	}
+
+	lists = computePreferenceLists(partitions, 3, []string{}, nil, nil)
+	if len(lists["myDB_0"]) != 0 {
+		t.Error("expect empty preference list without instances")
+	}
+}
+
+func TestActiveInstances(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	nowMilli := now.UnixNano() / 1000000
+
+	instances := []string{"localhost_12913", "localhost_12914", "localhost_12915"}
+	live := map[string]bool{"localhost_12913": true}
+	offlineTimes := map[string]int64{
+		"localhost_12914": nowMilli - 10000,
+		"localhost_12915": nowMilli - 60000,
+	}
+
+	// without delayed rebalance only the live instances are active
+	active := activeInstances(instances, live, offlineTimes, delayedRebalanceConfig{}, now)
+	if len(active) != 1 || active[0] != "localhost_12913" {
+		t.Error("expect only the live instance to be active")
+	}
+
+	// with a 30 seconds delay, the instance that left 10 seconds ago is still active
+	cfg := delayedRebalanceConfig{enabled: true, delay: 30 * time.Second}
+	active = activeInstances(instances, live, offlineTimes, cfg, now)
+	if len(active) != 2 || active[0] != "localhost_12913" || active[1] != "localhost_12914" {
+		t.Error("expect the instance in the delay window to be active")
+	}
+}
+
+func TestDelayedRebalanceConfig(t *testing.T) {
+	t.Parallel()
+
+	cluster := NewRecord("MYCLUSTER")
+	cluster.SetSimpleField(delayRebalanceTimeKey, "30000")
+
+	is := NewRecord("myDB")
+	is.SetIntField(minActiveReplicasKey, 1)
+
+	cfg := getDelayedRebalanceConfig(cluster, is, nil)
+	if !cfg.enabled || cfg.delay != 30*time.Second || cfg.minActive(3) != 1 {
+		t.Error("failed to read the delayed rebalance config")
+	}
+
+	// resource config overrides the cluster config
+	resource := NewRecord("myDB")
+	resource.SetBooleanField(delayRebalanceEnabledKey, false)
+
+	cfg = getDelayedRebalanceConfig(cluster, is, resource)
+	if cfg.enabled {
+		t.Error("delayed rebalance should be disabled by the resource config")
+	}
+
+	if cfg := getDelayedRebalanceConfig(NewRecord("MYCLUSTER"), is, nil); cfg.enabled || cfg.minActive(3) != 1 {
+		t.Error("delayed rebalance should be off without a delay")
+	}
+}
+
+func TestEnsureMinActiveReplicas(t *testing.T) {
+	t.Parallel()
+
+	partitions := partitionNames("myDB", 2)
+	lists := map[string][]string{
+		"myDB_0": {"localhost_12913", "localhost_12914"},
+		"myDB_1": {"localhost_12914", "localhost_12915"},
+	}
+
+	// localhost_12914 is offline but still in the delay window
+	live := []string{"localhost_12913", "localhost_12915", "localhost_12916"}
+	ensureMinActiveReplicas(lists, partitions, live, nil, 2)
+
+	for _, p := range partitions {
+		list := lists[p]
+		if len(list) != 3 || !contains(list, "localhost_12914") {
+			t.Errorf("partition %s should keep the offline replica and add a live one: %v", p, list)
+		}
+	}
+}
+
+func TestComputePreferenceListsWithFaultZones(t *testing.T) {
+	t.Parallel()
+
+	partitions := partitionNames("myDB", 8)
+	instances := []string{"h1", "h2", "h3", "h4", "h5"}
+	zones := map[string]string{
+		"h1": "us-east-1a",
+		"h2": "us-east-1a",
+		"h3": "us-east-1a",
+		"h4": "us-east-1b",
+		"h5": "us-east-1b",
+	}
+
+	lists := computePreferenceLists(partitions, 3, instances, zones, nil)
+
+	for _, p := range partitions {
+		list := lists[p]
+		if len(list) != 2 {
+			t.Errorf("partition %s should have one replica per fault zone, but has %v", p, list)
+		}
+		if zones[list[0]] == zones[list[1]] {
+			t.Errorf("partition %s has two replicas in the same fault zone: %v", p, list)
+		}
+	}
+}
+
+func TestBalanceLeaders(t *testing.T) {
+	t.Parallel()
+
+	partitions := partitionNames("myDB", 3)
+	lists := map[string][]string{
+		"myDB_0": {"h1", "h2"},
+		"myDB_1": {"h1", "h3"},
+		"myDB_2": {"h1", "h2"},
+	}
+
+	balanceLeaders(lists, partitions)
+
+	leads := make(map[string]int)
+	for _, p := range partitions {
+		if len(lists[p]) != 2 {
+			t.Errorf("partition %s should keep its replicas: %v", p, lists[p])
+		}
+		leads[lists[p][0]]++
+	}
+
+	if leads["h1"] != 1 || leads["h2"] != 1 || leads["h3"] != 1 {
+		t.Errorf("expect each instance to lead one partition: %v", leads)
+	}
+}
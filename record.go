@@ -126,6 +126,46 @@ func (r Record) GetMapField(key string, property string) string {
 	return r.MapFields[key][property]
 }
 
+// GetListField returns the list value of a key under ListField. Lists
+// decoded from zookeeper are converted to []string.
+func (r Record) GetListField(key string) []string {
+	if r.ListFields == nil || r.ListFields[key] == nil {
+		return nil
+	}
+
+	switch list := r.ListFields[key].(type) {
+	case []string:
+		return list
+	case []interface{}:
+		result := make([]string, 0, len(list))
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+
+	return nil
+}
+
+// SetListField sets the list value of a key under ListField
+func (r *Record) SetListField(key string, value []string) {
+	if r.ListFields == nil {
+		r.ListFields = make(map[string]interface{})
+	}
+	r.ListFields[key] = value
+}
+
+// RemoveListField deletes a key from ListField
+func (r *Record) RemoveListField(key string) {
+	if r.ListFields == nil {
+		return
+	}
+
+	delete(r.ListFields, key)
+}
+
 // NewRecordFromBytes creates a new znode instance from a byte array
 func NewRecordFromBytes(data []byte) (*Record, error) {
 	var zn Record
@@ -73,3 +73,27 @@ func TestSetMapField(t *testing.T) {
 		t.Error("failed")
 	}
 }
+
+func TestListField(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewRecordFromBytes([]byte(`{"id":"myDB","listFields":{"myDB_0":["localhost_12913","localhost_12914"]}}`))
+	if err != nil {
+		t.Error("panic")
+	}
+
+	list := r.GetListField("myDB_0")
+	if len(list) != 2 || list[0] != "localhost_12913" || list[1] != "localhost_12914" {
+		t.Error("wrong result")
+	}
+
+	r.SetListField("myDB_1", []string{"localhost_12915"})
+	if list := r.GetListField("myDB_1"); len(list) != 1 || list[0] != "localhost_12915" {
+		t.Error("failed")
+	}
+
+	r.RemoveListField("myDB_0")
+	if list := r.GetListField("myDB_0"); list != nil {
+		t.Error("failed")
+	}
+}
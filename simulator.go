@@ -0,0 +1,241 @@
+package gohelix
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// defaultSimulationSteps bounds the number of steps of a simulation
+const defaultSimulationSteps = 100
+
+// Simulator plays the controller on a copy of a cluster snapshot, to see what a change
+// would move before making it. Nothing is written to zookeeper. The transitions are
+// assumed to succeed, and the pending messages of the snapshot to be done first.
+type Simulator struct {
+	Snapshot *ClusterSnapshot
+
+	// MaxSteps bounds the number of rounds of messages Run simulates
+	MaxSteps int
+}
+
+// SimulationResult is the outcome of a simulation
+type SimulationResult struct {
+	// the best possible assignment of each resource
+	Assignments map[string]*ResourceAssignment
+
+	// the messages the controller would send, in order. The messages of a step are sent
+	// together, once the messages of the previous step are done.
+	Steps [][]*Record
+
+	// false if the simulation stopped before reaching the best possible assignment
+	Converged bool
+}
+
+// NewSimulator creates a simulator on a copy of the snapshot
+func NewSimulator(snapshot *ClusterSnapshot) (*Simulator, error) {
+	data, err := snapshot.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewClusterSnapshotFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Simulator{Snapshot: s, MaxSteps: defaultSimulationSteps}, nil
+}
+
+// Marshal generates the beautified json of the snapshot, see NewClusterSnapshotFromBytes
+func (s *ClusterSnapshot) Marshal() ([]byte, error) {
+	return json.MarshalIndent(s, "", "    ")
+}
+
+// NewClusterSnapshotFromBytes reads a snapshot exported by ClusterSnapshot.Marshal
+func NewClusterSnapshotFromBytes(data []byte) (*ClusterSnapshot, error) {
+	s := &ClusterSnapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	// the maps are left nil by json when they are empty
+	if s.ClusterConfig == nil {
+		s.ClusterConfig = NewRecord(s.ClusterID)
+	}
+	for _, m := range []*map[string]*Record{&s.IdealStates, &s.ResourceConfigs, &s.LiveInstances, &s.InstanceConfigs, &s.StateModelDefs, &s.Constraints} {
+		if *m == nil {
+			*m = make(map[string]*Record)
+		}
+	}
+	if s.CurrentStates == nil {
+		s.CurrentStates = make(map[string]map[string]*Record)
+	}
+	if s.Messages == nil {
+		s.Messages = make(map[string][]*Record)
+	}
+	if s.OfflineTimes == nil {
+		s.OfflineTimes = make(map[string]int64)
+	}
+
+	for instance := range s.LiveInstances {
+		if s.CurrentStates[instance] == nil {
+			s.CurrentStates[instance] = make(map[string]*Record)
+		}
+	}
+
+	return s, nil
+}
+
+// AddInstance adds a live and enabled instance to the cluster
+func (sim *Simulator) AddInstance(instance string) error {
+	s := sim.Snapshot
+	if _, ok := s.InstanceConfigs[instance]; ok {
+		return ErrNodeAlreadyExists
+	}
+
+	config := NewRecord(instance)
+	config.SetBooleanField("HELIX_ENABLED", true)
+	s.InstanceConfigs[instance] = config
+
+	live := NewRecord(instance)
+	live.SetSimpleField("SESSION_ID", instance)
+	s.LiveInstances[instance] = live
+	s.CurrentStates[instance] = make(map[string]*Record)
+
+	return nil
+}
+
+// RemoveInstance drops an instance from the cluster, with its replicas
+func (sim *Simulator) RemoveInstance(instance string) error {
+	s := sim.Snapshot
+	if _, ok := s.InstanceConfigs[instance]; !ok {
+		return ErrNodeNotExist
+	}
+
+	delete(s.InstanceConfigs, instance)
+	delete(s.LiveInstances, instance)
+	delete(s.CurrentStates, instance)
+	delete(s.Messages, instance)
+	delete(s.OfflineTimes, instance)
+
+	for _, is := range s.IdealStates {
+		for p := range is.ListFields {
+			list := []string{}
+			for _, i := range is.GetListField(p) {
+				if i != instance {
+					list = append(list, i)
+				}
+			}
+			is.SetListField(p, list)
+		}
+
+		for p := range is.MapFields {
+			delete(is.MapFields[p], instance)
+		}
+	}
+
+	return nil
+}
+
+// DisableInstance disables an instance, its replicas go back to the initial state
+func (sim *Simulator) DisableInstance(instance string) error {
+	config, ok := sim.Snapshot.InstanceConfigs[instance]
+	if !ok {
+		return ErrNodeNotExist
+	}
+
+	config.SetBooleanField("HELIX_ENABLED", false)
+	return nil
+}
+
+// SetReplicas changes the replication factor of a resource. The preference lists of a
+// SEMI_AUTO resource are recomputed like Admin.Rebalance does.
+func (sim *Simulator) SetReplicas(resource string, replicas int) error {
+	s := sim.Snapshot
+	is, ok := s.IdealStates[resource]
+	if !ok {
+		return ErrResourceNotExists
+	}
+
+	if replicas <= 0 {
+		return ErrInvalidReplicas
+	}
+
+	mode, _ := is.GetSimpleField("REBALANCE_MODE").(string)
+	if mode != "" && !strings.EqualFold(mode, "SEMI_AUTO") {
+		is.SetIntField("REPLICAS", replicas)
+		return nil
+	}
+
+	return s.rebalanceIdealState(resource, replicas)
+}
+
+// Run runs the controller on the snapshot until the best possible assignment is reached,
+// applying the messages of each step to the current states.
+func (sim *Simulator) Run() *SimulationResult {
+	s := sim.Snapshot
+	result := &SimulationResult{Steps: [][]*Record{}}
+
+	// the pending messages are done first
+	for _, messages := range s.Messages {
+		for _, m := range messages {
+			sim.apply(m)
+		}
+	}
+	s.Messages = make(map[string][]*Record)
+
+	for step := 0; step <= sim.MaxSteps; step++ {
+		result.Assignments = computeBestPossibleStates(s)
+
+		messages := computeMessages(s, result.Assignments)
+		if s.isFrozen() {
+			messages = frozenMessages(messages)
+		}
+		messages = throttleMessages(s, messages)
+
+		if len(messages) == 0 {
+			result.Converged = true
+			break
+		}
+
+		if step == sim.MaxSteps {
+			break
+		}
+
+		for _, m := range messages {
+			sim.apply(m)
+		}
+		result.Steps = append(result.Steps, messages)
+	}
+
+	return result
+}
+
+// apply sets the current state of the replica to the target state of the message
+func (sim *Simulator) apply(message *Record) {
+	s := sim.Snapshot
+
+	msgType, _ := message.GetSimpleField("MSG_TYPE").(string)
+	instance, _ := message.GetSimpleField("TGT_NAME").(string)
+	resource, _ := message.GetSimpleField("RESOURCE_NAME").(string)
+	partition, _ := message.GetSimpleField("PARTITION_NAME").(string)
+	to, _ := message.GetSimpleField("TO_STATE").(string)
+
+	resources, ok := s.CurrentStates[instance]
+	if msgType != "STATE_TRANSITION" || !ok {
+		return
+	}
+
+	cs, ok := resources[resource]
+	if !ok {
+		cs = NewRecord(resource)
+		cs.SetSimpleField("STATE_MODEL_DEF", message.GetSimpleField("STATE_MODEL_DEF"))
+		resources[resource] = cs
+	}
+
+	if to == droppedState {
+		delete(cs.MapFields, partition)
+		return
+	}
+	cs.SetMapField(partition, "CURRENT_STATE", to)
+}
@@ -0,0 +1,55 @@
+package gohelix
+
+import "testing"
+
+func TestSimulator(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSnapshot([]string{"h1", "h2"}, []string{"h1", "h2"})
+	is := newTestIdealState("myDB", "SEMI_AUTO", 1)
+	is.SetIntField("NUM_PARTITIONS", 2)
+	is.SetListField("myDB_0", []string{"h1"})
+	is.SetListField("myDB_1", []string{"h2"})
+	s.IdealStates["myDB"] = is
+	setCurrentState(s, "h1", "myDB", "myDB_0", "MASTER")
+	setCurrentState(s, "h2", "myDB", "myDB_1", "MASTER")
+
+	sim, err := NewSimulator(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sim.AddInstance("h3"); err != nil {
+		t.Error(err)
+	}
+
+	if err := sim.SetReplicas("myDB", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	result := sim.Run()
+	if !result.Converged {
+		t.Fatal("expect the simulation to converge")
+	}
+
+	for _, p := range []string{"myDB_0", "myDB_1"} {
+		counts := make(map[string]int)
+		for _, state := range result.Assignments["myDB"].GetStates(p) {
+			counts[state]++
+		}
+
+		if counts["MASTER"] != 1 || counts["SLAVE"] != 1 {
+			t.Errorf("partition %s should have one MASTER and one SLAVE", p)
+		}
+	}
+
+	// the new replicas are bootstrapped before they are promoted
+	if len(result.Steps) == 0 || result.Steps[0][0].GetSimpleField("FROM_STATE") != "OFFLINE" {
+		t.Error("expect the simulation to start with OFFLINE transitions")
+	}
+
+	// and the snapshot is left unchanged
+	if _, ok := s.InstanceConfigs["h3"]; ok || s.IdealStates["myDB"].GetIntField("REPLICAS", 0) != 1 {
+		t.Error("expect the simulation to work on a copy of the snapshot")
+	}
+}
@@ -0,0 +1,426 @@
+package gohelix
+
+import (
+	"sort"
+	"time"
+
+	"github.com/yichen/go-zookeeper/zk"
+)
+
+// ClusterSnapshot is a read-only copy of the cluster data a rebalancer works on. The
+// records are keyed by their resource or instance name.
+type ClusterSnapshot struct {
+	ClusterID     string
+	ClusterConfig *Record
+
+	// ideal states and resource configs of the resources
+	IdealStates     map[string]*Record
+	ResourceConfigs map[string]*Record
+
+	// live instances and configs of all the instances
+	LiveInstances   map[string]*Record
+	InstanceConfigs map[string]*Record
+
+	// current states of the live instances, by instance and then resource
+	CurrentStates map[string]map[string]*Record
+
+	// pending messages of the live instances
+	Messages map[string][]*Record
+
+	StateModelDefs map[string]*Record
+
+	// constraints of the cluster, by constraint type such as MESSAGE_CONSTRAINT
+	Constraints map[string]*Record
+
+	// the PAUSE and MAINTENANCE signals of the controller, nil if they are not set
+	Pause       *Record
+	Maintenance *Record
+
+	// the time in milliseconds each offline instance went offline, see stampOfflineTimes
+	OfflineTimes map[string]int64
+
+	// the time the snapshot was taken
+	Time time.Time
+}
+
+// readClusterSnapshot reads the cluster data from zookeeper. Offline instances that
+// have no offline time yet are left out of OfflineTimes, see stampOfflineTimes.
+func readClusterSnapshot(conn *connection, cluster string) (*ClusterSnapshot, error) {
+	keys := KeyBuilder{cluster}
+
+	s := &ClusterSnapshot{
+		ClusterID:       cluster,
+		IdealStates:     make(map[string]*Record),
+		ResourceConfigs: make(map[string]*Record),
+		LiveInstances:   make(map[string]*Record),
+		InstanceConfigs: make(map[string]*Record),
+		CurrentStates:   make(map[string]map[string]*Record),
+		Messages:        make(map[string][]*Record),
+		StateModelDefs:  make(map[string]*Record),
+		Constraints:     make(map[string]*Record),
+		OfflineTimes:    make(map[string]int64),
+		Time:            time.Now(),
+	}
+
+	var err error
+	if s.ClusterConfig, err = conn.GetRecordFromPath(keys.clusterConfig()); err != nil {
+		return nil, err
+	}
+
+	if err := readRecords(conn, keys.idealStates(), s.IdealStates); err != nil {
+		return nil, err
+	}
+
+	if err := readRecords(conn, keys.resourceConfigs(), s.ResourceConfigs); err != nil {
+		return nil, err
+	}
+
+	if err := readRecords(conn, keys.constraints(), s.Constraints); err != nil {
+		return nil, err
+	}
+
+	if err := readRecords(conn, keys.participantConfigs(), s.InstanceConfigs); err != nil {
+		return nil, err
+	}
+
+	if err := readRecords(conn, keys.liveInstances(), s.LiveInstances); err != nil {
+		return nil, err
+	}
+
+	if err := readRecords(conn, keys.stateModels(), s.StateModelDefs); err != nil {
+		return nil, err
+	}
+
+	if s.Pause, err = readRecordIfExists(conn, keys.controllerPause()); err != nil {
+		return nil, err
+	}
+
+	if s.Maintenance, err = readRecordIfExists(conn, keys.controllerMaintenance()); err != nil {
+		return nil, err
+	}
+
+	for instance, live := range s.LiveInstances {
+		sessionID, _ := live.GetSimpleField("SESSION_ID").(string)
+
+		s.CurrentStates[instance] = make(map[string]*Record)
+		if err := readRecords(conn, keys.currentStatesForSession(instance, sessionID), s.CurrentStates[instance]); err != nil {
+			return nil, err
+		}
+
+		messages := make(map[string]*Record)
+		if err := readRecords(conn, keys.messages(instance), messages); err != nil {
+			return nil, err
+		}
+		for _, m := range messages {
+			s.Messages[instance] = append(s.Messages[instance], m)
+		}
+	}
+
+	for instance := range s.InstanceConfigs {
+		if _, ok := s.LiveInstances[instance]; ok {
+			continue
+		}
+
+		history, err := getParticipantHistory(conn, keys, instance)
+		if err != nil {
+			return nil, err
+		}
+
+		if t := int64(history.GetIntField(lastOfflineTimeKey, -1)); t >= 0 {
+			s.OfflineTimes[instance] = t
+		}
+	}
+
+	return s, nil
+}
+
+// readRecords reads all the children of a path into result. Unlike Children and Get, it
+// does not wait for znodes that do not exist: there are no children if the path does not
+// exist, and the children removed before they are read, like the live instances of expired
+// sessions or the messages the participants processed, are left out.
+func readRecords(conn *connection, path string, result map[string]*Record) error {
+	children, err := conn.childrenIfExists(path)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range children {
+		data, _, err := conn.zkConn.Get(path + "/" + c)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if result[c], err = NewRecordFromBytes(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readRecordIfExists reads the record at path, or returns nil if the path does not
+// exist. Unlike GetRecordFromPath, it does not wait for the path to be created.
+func readRecordIfExists(conn *connection, path string) (*Record, error) {
+	data, _, err := conn.zkConn.Get(path)
+	if err == zk.ErrNoNode {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewRecordFromBytes(data)
+}
+
+// stampOfflineTimes saves the snapshot time as the offline time of the offline instances
+// that do not have one yet, so that the delay window starts when the instance is first
+// noticed missing.
+func (s *ClusterSnapshot) stampOfflineTimes(conn *connection) error {
+	keys := KeyBuilder{s.ClusterID}
+	nowMilli := s.Time.UnixNano() / 1000000
+
+	for _, instance := range s.Instances() {
+		if s.IsLive(instance) {
+			continue
+		}
+
+		if _, ok := s.OfflineTimes[instance]; ok {
+			continue
+		}
+
+		if err := setLastOfflineTime(conn, keys, instance, nowMilli); err != nil {
+			return err
+		}
+		s.OfflineTimes[instance] = nowMilli
+	}
+
+	return nil
+}
+
+// isFrozen tests if the cluster is paused or in maintenance
+func (s *ClusterSnapshot) isFrozen() bool {
+	return s.Pause != nil || s.Maintenance != nil
+}
+
+// Instances returns the names of all the instances, sorted
+func (s *ClusterSnapshot) Instances() []string {
+	result := []string{}
+	for i := range s.InstanceConfigs {
+		result = append(result, i)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// IsLive tests if the instance is live
+func (s *ClusterSnapshot) IsLive(instance string) bool {
+	_, ok := s.LiveInstances[instance]
+	return ok
+}
+
+// IsEnabled tests if the instance is enabled
+func (s *ClusterSnapshot) IsEnabled(instance string) bool {
+	config, ok := s.InstanceConfigs[instance]
+	return ok && config.GetBooleanField("HELIX_ENABLED", true)
+}
+
+// IsPartitionEnabled tests if the partition of the resource is enabled on the instance,
+// see Admin.DisablePartitions
+func (s *ClusterSnapshot) IsPartitionEnabled(instance string, resource string, partition string) bool {
+	config, ok := s.InstanceConfigs[instance]
+	return ok && !contains(disabledPartitions(config, resource), partition)
+}
+
+// IsEvacuating tests if the replicas of the instance are being moved elsewhere, see
+// Admin.EvacuateInstance
+func (s *ClusterSnapshot) IsEvacuating(instance string) bool {
+	config, ok := s.InstanceConfigs[instance]
+	if !ok {
+		return false
+	}
+
+	op, _ := config.GetSimpleField(instanceOperationKey).(string)
+	return op == evacuateOperation
+}
+
+// HasInstanceGroupTag tests if the instance can hold replicas of the resource. When the
+// ideal state of the resource sets an INSTANCE_GROUP_TAG, only the instances with the tag
+// can, see Admin.AddInstanceTag.
+func (s *ClusterSnapshot) HasInstanceGroupTag(instance string, resource string) bool {
+	is, ok := s.IdealStates[resource]
+	if !ok {
+		return true
+	}
+
+	tag, _ := is.GetSimpleField(instanceGroupTagKey).(string)
+	if tag == "" {
+		return true
+	}
+
+	config, ok := s.InstanceConfigs[instance]
+	return ok && contains(instanceTags(config), tag)
+}
+
+// CurrentState returns the state of a partition replica on a live instance, or an empty
+// string if the instance does not hold the replica.
+func (s *ClusterSnapshot) CurrentState(instance string, resource string, partition string) string {
+	cs, ok := s.CurrentStates[instance][resource]
+	if !ok {
+		return ""
+	}
+	return cs.GetMapField(partition, "CURRENT_STATE")
+}
+
+// CurrentStateMap maps the live instances holding a replica of the partition to the state
+// of the replica. Dropped replicas are left out.
+func (s *ClusterSnapshot) CurrentStateMap(resource string, partition string) map[string]string {
+	result := make(map[string]string)
+	for instance := range s.CurrentStates {
+		if state := s.CurrentState(instance, resource, partition); state != "" && state != droppedState {
+			result[instance] = state
+		}
+	}
+	return result
+}
+
+// Partitions returns the partitions of a resource. They are numbered by NUM_PARTITIONS,
+// or listed in the ideal state if NUM_PARTITIONS is not set.
+func (s *ClusterSnapshot) Partitions(resource string) []string {
+	is, ok := s.IdealStates[resource]
+	if !ok {
+		return []string{}
+	}
+
+	if n := is.GetIntField("NUM_PARTITIONS", 0); n > 0 {
+		return partitionNames(resource, n)
+	}
+
+	seen := make(map[string]bool)
+	for p := range is.ListFields {
+		seen[p] = true
+	}
+	for p := range is.MapFields {
+		seen[p] = true
+	}
+
+	result := []string{}
+	for p := range seen {
+		result = append(result, p)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// stateModelDefOf returns the state model definition of a resource. The resource of a
+// dropped ideal state is looked up in the current states.
+func (s *ClusterSnapshot) stateModelDefOf(resource string) (*Record, error) {
+	name := ""
+	if is, ok := s.IdealStates[resource]; ok {
+		name, _ = is.GetSimpleField("STATE_MODEL_DEF_REF").(string)
+	}
+
+	for _, resources := range s.CurrentStates {
+		if cs, ok := resources[resource]; ok && name == "" {
+			name, _ = cs.GetSimpleField("STATE_MODEL_DEF").(string)
+		}
+	}
+
+	if def, ok := s.StateModelDefs[name]; ok {
+		return def, nil
+	}
+	return nil, ErrStateModelDefNotExist
+}
+
+// assignableInstances returns the enabled instances that can be assigned replicas of the
+// resource. Evacuating instances are left out, and so are the instances without a valid
+// domain in a topology aware cluster.
+func (s *ClusterSnapshot) assignableInstances(resource string, zones map[string]string) []string {
+	result := []string{}
+	for _, i := range s.Instances() {
+		if _, ok := zones[i]; zones != nil && !ok {
+			continue
+		}
+
+		if s.IsEnabled(i) && !s.IsEvacuating(i) && s.HasInstanceGroupTag(i, resource) {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// computePreferenceLists assigns the partitions of a resource to the instances with the
+// given replication factor, see Admin.Rebalance. current holds the preference lists to
+// keep when possible.
+func (s *ClusterSnapshot) computePreferenceLists(resource string, partitions []string, replicas int, current map[string][]string) (map[string][]string, error) {
+	is := s.IdealStates[resource]
+	resourceConfig := s.ResourceConfigs[resource]
+	cfg := getDelayedRebalanceConfig(s.ClusterConfig, is, resourceConfig)
+
+	zones := getFaultZones(s.ClusterConfig, s.InstanceConfigs)
+	instances := s.assignableInstances(resource, zones)
+
+	live := make(map[string]bool)
+	for i := range s.LiveInstances {
+		live[i] = true
+	}
+
+	active := activeInstances(instances, live, s.OfflineTimes, cfg, s.Time)
+	liveEnabled := activeInstances(instances, live, nil, delayedRebalanceConfig{}, s.Time)
+
+	if getRebalancerClassName(is, resourceConfig) == wagedRebalancerClassName {
+		wp, weights, err := s.newResourcePlacement(zones, resource, partitions)
+		if err != nil {
+			return nil, err
+		}
+
+		lists, unplaced := wp.assign(partitions, replicas, active, weights, current)
+		if cfg.enabled {
+			unplaced = append(unplaced, wp.ensureMinActive(lists, partitions, liveEnabled, weights, cfg.minActive(replicas))...)
+		}
+
+		if len(unplaced) > 0 {
+			return nil, &PlacementError{resource, unplaced}
+		}
+
+		balanceLeaders(lists, partitions)
+		return lists, nil
+	}
+
+	lists := computePreferenceLists(partitions, replicas, active, zones, current)
+	if cfg.enabled {
+		ensureMinActiveReplicas(lists, partitions, liveEnabled, zones, cfg.minActive(replicas))
+	}
+
+	balanceLeaders(lists, partitions)
+	return lists, nil
+}
+
+// rebalanceIdealState recomputes the preference lists of the ideal state of a resource
+// with the given replication factor, see Admin.Rebalance.
+func (s *ClusterSnapshot) rebalanceIdealState(resource string, replicas int) error {
+	is, ok := s.IdealStates[resource]
+	if !ok {
+		return ErrResourceNotExists
+	}
+
+	partitions := partitionNames(resource, is.GetIntField("NUM_PARTITIONS", 0))
+	current := make(map[string][]string)
+	for _, p := range partitions {
+		current[p] = is.GetListField(p)
+	}
+
+	lists, err := s.computePreferenceLists(resource, partitions, replicas, current)
+	if err != nil {
+		return err
+	}
+
+	is.SetIntField("REPLICAS", replicas)
+	is.ListFields = make(map[string]interface{})
+	for p, list := range lists {
+		is.SetListField(p, list)
+	}
+
+	return nil
+}
@@ -35,6 +35,7 @@ type Spectator struct {
 	instanceConfigChangeListeners []InstanceConfigChangeListener
 	controllerMessageListeners    []ControllerMessageListener
 	messageListeners              map[string][]MessageListener
+	configListeners               []configListener
 
 	// stop the spectator
 	stop chan bool
@@ -68,6 +69,15 @@ type Spectator struct {
 	sync.RWMutex
 }
 
+// configListener is a ConfigChangeListener of the effective value of a key for a replica
+type configListener struct {
+	key       string
+	resource  string
+	partition string
+	instance  string
+	listener  ConfigChangeListener
+}
+
 // Connect the spectator. When connected, the spectator is able to listen to Helix cluster
 // changes and handle listener updates.
 func (s *Spectator) Connect() error {
@@ -200,6 +210,16 @@ func (s *Spectator) AddControllerMessageListener(listener ControllerMessageListe
 	s.controllerMessageListeners = append(s.controllerMessageListeners, listener)
 }
 
+// AddConfigChangeListener adds a listener to the effective value of a config key for a
+// replica, see ConfigAccessor.Get. The listener is called when any of the configs the
+// value is resolved from changes.
+func (s *Spectator) AddConfigChangeListener(key string, resource string, partition string, instance string, listener ConfigChangeListener) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.configListeners = append(s.configListeners, configListener{key, resource, partition, instance, listener})
+}
+
 func (s *Spectator) watchExternalViewResource(resource string) {
 	go func() {
 		for {
@@ -361,6 +381,12 @@ func (s *Spectator) GetInstanceConfigs() []*Record {
 	return result
 }
 
+// GetConfig returns the effective value of a config key for a replica, see
+// ConfigAccessor.Get
+func (s *Spectator) GetConfig(key string, resource string, partition string, instance string) (ConfigValue, error) {
+	return readConfigValue(s.conn, s.keys, key, resource, partition, instance)
+}
+
 func (s *Spectator) watchCurrentStates() {
 	for k := range s.currentStateChangeListeners {
 		s.watchCurrentStateForInstance(k)
@@ -632,6 +658,46 @@ func (s *Spectator) watchInstanceMessage(instance string, messageID string) {
 	}()
 }
 
+// watchConfigs watches the configs the values of the config listeners are resolved from
+func (s *Spectator) watchConfigs() {
+	paths := map[string]bool{s.keys.clusterConfig(): true}
+	for _, l := range s.configListeners {
+		if l.resource != "" {
+			paths[s.keys.resourceConfig(l.resource)] = true
+		}
+		if l.instance != "" {
+			paths[s.keys.participantConfig(l.instance)] = true
+		}
+	}
+
+	for path := range paths {
+		s.watchConfig(path)
+	}
+}
+
+// watchConfig watches a config that may not exist yet
+func (s *Spectator) watchConfig(path string) {
+	go func() {
+		for {
+			_, _, events, err := s.conn.zkConn.ExistsW(path)
+			if err != nil {
+				select {
+				case s.changeNotificationChan <- changeNotification{configWatchFailed, err}:
+				case <-s.stop:
+				}
+				return
+			}
+
+			select {
+			case <-events:
+				s.changeNotificationChan <- changeNotification{configChanged, path}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
 // loop is the main event loop for Spectator. Whenever an external view update happpened
 // the loop will pause for a short period of time to bucket all subsequent external view
 // changes so that we don't send duplicate updates too often.
@@ -660,6 +726,10 @@ func (s *Spectator) loop() {
 		s.watchInstanceConfig()
 	}
 
+	if len(s.configListeners) > 0 {
+		s.watchConfigs()
+	}
+
 	if len(s.messageListeners) > 0 {
 		for instance := range s.messageListeners {
 			s.watchInstanceMessages(instance)
@@ -726,6 +796,18 @@ func (s *Spectator) handleChangeNotification(chg changeNotification) {
 			go cmListener(cm, s.context)
 		}
 
+	case configChanged:
+		for _, l := range s.configListeners {
+			value, err := s.GetConfig(l.key, l.resource, l.partition, l.instance)
+			go l.listener(value, err, s.context)
+		}
+
+	case configWatchFailed:
+		err := chg.changeData.(error)
+		for _, l := range s.configListeners {
+			go l.listener(ConfigValue{}, err, s.context)
+		}
+
 	case instanceMessagesChanged:
 		instance := chg.changeData.(string)
 		messageRecords := s.GetInstanceMessages(instance)
@@ -0,0 +1,360 @@
+package gohelix
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keys of a state model definition, see HelixDefaultNodes for examples. The <STATE>.meta
+// map field holds the count of the state: a number, R for the number of replicas, N for
+// the number of live instances, or -1 for no limit. The <STATE>.next map field maps a
+// target state to the next state on the way to it.
+const (
+	initialStateKey           = "INITIAL_STATE"
+	statePriorityListKey      = "STATE_PRIORITY_LIST"
+	transitionPriorityListKey = "STATE_TRANSITION_PRIORITYLIST"
+	droppedState              = "DROPPED"
+	errorState                = "ERROR"
+	stateCountReplicas        = "R"
+	stateCountLiveInstances   = "N"
+	stateModelDefMetaSuffix   = ".meta"
+	stateModelDefNextSuffix   = ".next"
+	stateModelDefCountKey     = "count"
+)
+
+// initialState returns the state a replica is in before its first transition
+func initialState(stateModelDef *Record) string {
+	if s, ok := stateModelDef.GetSimpleField(initialStateKey).(string); ok && s != "" {
+		return s
+	}
+	return "OFFLINE"
+}
+
+// statePriorities returns the states from the highest to the lowest priority
+func statePriorities(stateModelDef *Record) []string {
+	return stateModelDef.GetListField(statePriorityListKey)
+}
+
+// stateCount returns the upper bound of replicas of a partition in the state, or -1
+// if there is no bound.
+func stateCount(stateModelDef *Record, state string, replicas int, liveInstances int) int {
+	count := stateModelDef.GetMapField(state+stateModelDefMetaSuffix, stateModelDefCountKey)
+
+	switch count {
+	case stateCountReplicas:
+		return replicas
+	case stateCountLiveInstances:
+		return liveInstances
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// isStateCountFixed tests if the upper bound of replicas of a partition in the state is
+// a number, rather than the replicas or the live instances
+func isStateCountFixed(stateModelDef *Record, state string) bool {
+	_, err := strconv.Atoi(stateModelDef.GetMapField(state+stateModelDefMetaSuffix, stateModelDefCountKey))
+	return err == nil
+}
+
+// nextState returns the next state on the way from one state to another, or an empty
+// string if there is no path.
+func nextState(stateModelDef *Record, from string, to string) string {
+	return stateModelDef.GetMapField(from+stateModelDefNextSuffix, to)
+}
+
+// transitionPriority returns the priority of a transition, lower is more urgent.
+// Transitions that are not in the priority list come last.
+func transitionPriority(stateModelDef *Record, from string, to string) int {
+	list := stateModelDef.GetListField(transitionPriorityListKey)
+	transition := from + "-" + to
+
+	for i, t := range list {
+		if strings.EqualFold(t, transition) {
+			return i
+		}
+	}
+	return len(list)
+}
+
+// StateCount is the upper bound of replicas of a partition in a state: a number,
+// CountReplicas, CountLiveInstances or CountUnlimited
+type StateCount string
+
+// Counts of a state that are not a fixed number
+const (
+	CountReplicas      StateCount = stateCountReplicas
+	CountLiveInstances StateCount = stateCountLiveInstances
+	CountUnlimited     StateCount = "-1"
+)
+
+// CountUpTo bounds the replicas of a partition in a state to n
+func CountUpTo(n int) StateCount {
+	return StateCount(strconv.Itoa(n))
+}
+
+// StateTransition is a transition of a state model definition
+type StateTransition struct {
+	From string
+	To   string
+}
+
+// StateModelDefinition is a state model definition, the states a replica can be in and
+// the transitions between them. It is built with NewStateModelDefinition, AddState and
+// AddTransition, and saved with Admin.AddStateModelDef. For example
+//
+//	def := NewStateModelDefinition("PrimaryBackup", "OFFLINE").
+//		AddState("PRIMARY", CountUpTo(1)).
+//		AddState("BACKUP", CountReplicas).
+//		AddState("OFFLINE", CountUnlimited).
+//		AddTransition("BACKUP", "PRIMARY").
+//		AddTransition("PRIMARY", "BACKUP").
+//		AddTransition("OFFLINE", "BACKUP").
+//		AddTransition("BACKUP", "OFFLINE").
+//		AddTransition("OFFLINE", "DROPPED")
+//
+// The DROPPED and ERROR states are added if they are missing, and so is the transition
+// from ERROR to DROPPED.
+type StateModelDefinition struct {
+	Name         string
+	InitialState string
+
+	// States are the states from the highest to the lowest priority
+	States []string
+	Counts map[string]StateCount
+
+	// Transitions are the transitions from the most to the least urgent
+	Transitions []StateTransition
+}
+
+// StateModelDefError is returned when a state model definition is not valid
+type StateModelDefError struct {
+	StateModel string
+	Reason     string
+}
+
+func (e *StateModelDefError) Error() string {
+	return fmt.Sprintf("invalid state model definition %s: %s", e.StateModel, e.Reason)
+}
+
+// NewStateModelDefinition creates a state model definition without states
+func NewStateModelDefinition(name string, initialState string) *StateModelDefinition {
+	return &StateModelDefinition{
+		Name:         name,
+		InitialState: initialState,
+		States:       []string{},
+		Counts:       make(map[string]StateCount),
+		Transitions:  []StateTransition{},
+	}
+}
+
+// AddState adds a state with a lower priority than the states added before
+func (d *StateModelDefinition) AddState(state string, count StateCount) *StateModelDefinition {
+	if _, ok := d.Counts[state]; !ok {
+		d.States = append(d.States, state)
+	}
+	d.Counts[state] = count
+	return d
+}
+
+// AddTransition adds a transition that is less urgent than the transitions added before
+func (d *StateModelDefinition) AddTransition(from string, to string) *StateModelDefinition {
+	d.Transitions = append(d.Transitions, StateTransition{from, to})
+	return d
+}
+
+// withImplicitStates returns a copy of the definition with the DROPPED and ERROR states
+func (d *StateModelDefinition) withImplicitStates() *StateModelDefinition {
+	result := NewStateModelDefinition(d.Name, d.InitialState)
+	for _, state := range d.States {
+		result.AddState(state, d.Counts[state])
+	}
+	result.Transitions = append(result.Transitions, d.Transitions...)
+
+	for _, state := range []string{droppedState, errorState} {
+		if _, ok := result.Counts[state]; !ok {
+			result.AddState(state, CountUnlimited)
+		}
+	}
+
+	for _, t := range result.Transitions {
+		if t.From == errorState && t.To == droppedState {
+			return result
+		}
+	}
+	return result.AddTransition(errorState, droppedState)
+}
+
+// Validate checks that the initial state is a state, that all the states are reachable
+// from it, that all of them can reach DROPPED, and that the counts are valid
+func (d *StateModelDefinition) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return &StateModelDefError{d.Name, fmt.Sprintf(format, args...)}
+	}
+
+	if d.Name == "" {
+		return invalid("no name")
+	}
+
+	def := d.withImplicitStates()
+	if _, ok := def.Counts[def.InitialState]; !ok || def.InitialState == droppedState || def.InitialState == errorState {
+		return invalid("initial state %q is not a state", def.InitialState)
+	}
+
+	for _, state := range def.States {
+		switch count := def.Counts[state]; count {
+		case CountReplicas, CountLiveInstances:
+		default:
+			if _, err := strconv.Atoi(string(count)); err != nil {
+				return invalid("count %q of state %s is not valid", count, state)
+			}
+		}
+	}
+
+	seen := make(map[StateTransition]bool)
+	for _, t := range def.Transitions {
+		for _, state := range []string{t.From, t.To} {
+			if _, ok := def.Counts[state]; !ok {
+				return invalid("transition %s-%s has an unknown state %s", t.From, t.To, state)
+			}
+		}
+		if t.From == t.To || t.From == droppedState {
+			return invalid("transition %s-%s is not valid", t.From, t.To)
+		}
+		if seen[t] {
+			return invalid("transition %s-%s is added twice", t.From, t.To)
+		}
+		seen[t] = true
+	}
+
+	paths := def.computePaths()
+	for _, state := range def.States {
+		if state != errorState && state != def.InitialState && paths[def.InitialState][state] == "" {
+			return invalid("state %s is not reachable from the initial state", state)
+		}
+		if state != droppedState && paths[state][droppedState] == "" {
+			return invalid("state %s can not reach %s", state, droppedState)
+		}
+	}
+
+	return nil
+}
+
+// computePaths maps each state and target state to the next state on the shortest path
+// between them. The more urgent transitions are preferred among paths of the same length.
+// A replica in ERROR only takes its direct transitions, like in the built-in definitions.
+func (d *StateModelDefinition) computePaths() map[string]map[string]string {
+	result := make(map[string]map[string]string)
+
+	for _, from := range d.States {
+		next := make(map[string]string)
+		queue := []string{}
+
+		for _, t := range d.Transitions {
+			if t.From == from && next[t.To] == "" && t.To != from {
+				next[t.To] = t.To
+				queue = append(queue, t.To)
+			}
+		}
+
+		if from == errorState {
+			queue = nil
+		}
+
+		for len(queue) > 0 {
+			state := queue[0]
+			queue = queue[1:]
+
+			for _, t := range d.Transitions {
+				if t.From == state && next[t.To] == "" && t.To != from {
+					next[t.To] = next[state]
+					queue = append(queue, t.To)
+				}
+			}
+		}
+
+		result[from] = next
+	}
+
+	return result
+}
+
+// Record validates the definition and converts it to the record saved in zookeeper
+func (d *StateModelDefinition) Record() (*Record, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	def := d.withImplicitStates()
+	r := NewRecord(def.Name)
+	r.SetSimpleField(initialStateKey, def.InitialState)
+	r.SetListField(statePriorityListKey, def.States)
+
+	transitions := []string{}
+	for _, t := range def.Transitions {
+		transitions = append(transitions, t.From+"-"+t.To)
+	}
+	r.SetListField(transitionPriorityListKey, transitions)
+
+	paths := def.computePaths()
+	for _, state := range def.States {
+		r.SetMapField(state+stateModelDefMetaSuffix, stateModelDefCountKey, string(def.Counts[state]))
+		for to, next := range paths[state] {
+			r.SetMapField(state+stateModelDefNextSuffix, to, next)
+		}
+	}
+
+	return r, nil
+}
+
+// NewStateModelDefinitionFromRecord reads a state model definition from its record. The
+// transitions that are not in the STATE_TRANSITION_PRIORITYLIST are the direct steps of
+// the <STATE>.next map fields, and come last.
+func NewStateModelDefinitionFromRecord(r *Record) *StateModelDefinition {
+	d := NewStateModelDefinition(r.ID, initialState(r))
+	for _, state := range statePriorities(r) {
+		count := r.GetMapField(state+stateModelDefMetaSuffix, stateModelDefCountKey)
+		if count == "" {
+			count = string(CountUnlimited)
+		}
+		d.AddState(state, StateCount(count))
+	}
+
+	seen := make(map[StateTransition]bool)
+	for _, t := range r.GetListField(transitionPriorityListKey) {
+		if parts := strings.SplitN(t, "-", 2); len(parts) == 2 {
+			d.AddTransition(parts[0], parts[1])
+			seen[StateTransition{parts[0], parts[1]}] = true
+		}
+	}
+
+	steps := []StateTransition{}
+	for _, from := range d.States {
+		for to, next := range r.MapFields[from+stateModelDefNextSuffix] {
+			if t := (StateTransition{from, to}); to == next && !seen[t] {
+				steps = append(steps, t)
+			}
+		}
+	}
+	sort.Sort(byTransition(steps))
+	d.Transitions = append(d.Transitions, steps...)
+
+	return d
+}
+
+type byTransition []StateTransition
+
+func (s byTransition) Len() int      { return len(s) }
+func (s byTransition) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byTransition) Less(i, j int) bool {
+	if s[i].From != s[j].From {
+		return s[i].From < s[j].From
+	}
+	return s[i].To < s[j].To
+}
@@ -0,0 +1,89 @@
+package gohelix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStateModelDefinition(t *testing.T) {
+	t.Parallel()
+
+	def := NewStateModelDefinition("PrimaryBackup", "OFFLINE").
+		AddState("PRIMARY", CountUpTo(1)).
+		AddState("BACKUP", CountReplicas).
+		AddState("OFFLINE", CountUnlimited).
+		AddTransition("BACKUP", "PRIMARY").
+		AddTransition("PRIMARY", "BACKUP").
+		AddTransition("OFFLINE", "BACKUP").
+		AddTransition("BACKUP", "OFFLINE").
+		AddTransition("OFFLINE", "DROPPED")
+
+	r, err := def.Record()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if initialState(r) != "OFFLINE" || !reflect.DeepEqual(statePriorities(r), []string{"PRIMARY", "BACKUP", "OFFLINE", "DROPPED", "ERROR"}) {
+		t.Error("expect the states with DROPPED and ERROR last")
+	}
+	if nextState(r, "OFFLINE", "PRIMARY") != "BACKUP" || nextState(r, "PRIMARY", "DROPPED") != "BACKUP" {
+		t.Error("expect the paths to go through BACKUP")
+	}
+	if nextState(r, "ERROR", "DROPPED") != "DROPPED" {
+		t.Error("expect an ERROR to DROPPED transition")
+	}
+	if stateCount(r, "PRIMARY", 3, 5) != 1 || stateCount(r, "BACKUP", 3, 5) != 3 {
+		t.Error("expect the counts to be saved")
+	}
+
+	parsed := NewStateModelDefinitionFromRecord(r)
+	if err := parsed.Validate(); err != nil {
+		t.Error(err)
+	}
+	if len(parsed.Transitions) != 6 || parsed.Counts["PRIMARY"] != CountUpTo(1) {
+		t.Error("expect the record to read back")
+	}
+
+	// the built-in definitions are valid
+	for _, name := range []string{"MasterSlave", "OnlineOffline", "LeaderStandby"} {
+		r, _ := NewRecordFromBytes([]byte(HelixDefaultNodes[name]))
+		if err := NewStateModelDefinitionFromRecord(r).Validate(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestInvalidStateModelDefinition(t *testing.T) {
+	t.Parallel()
+
+	for _, def := range []*StateModelDefinition{
+		// no initial state
+		NewStateModelDefinition("Invalid", "INIT").
+			AddState("ONLINE", CountReplicas).
+			AddTransition("ONLINE", "DROPPED"),
+		// ONLINE is not reachable
+		NewStateModelDefinition("Invalid", "OFFLINE").
+			AddState("ONLINE", CountReplicas).
+			AddState("OFFLINE", CountUnlimited).
+			AddTransition("ONLINE", "OFFLINE").
+			AddTransition("OFFLINE", "DROPPED"),
+		// ONLINE can not be dropped
+		NewStateModelDefinition("Invalid", "OFFLINE").
+			AddState("ONLINE", CountReplicas).
+			AddState("OFFLINE", CountUnlimited).
+			AddTransition("OFFLINE", "ONLINE").
+			AddTransition("OFFLINE", "DROPPED"),
+		// unknown state
+		NewStateModelDefinition("Invalid", "OFFLINE").
+			AddState("OFFLINE", CountUnlimited).
+			AddTransition("OFFLINE", "ONLINE"),
+		// invalid count
+		NewStateModelDefinition("Invalid", "OFFLINE").
+			AddState("OFFLINE", StateCount("many")).
+			AddTransition("OFFLINE", "DROPPED"),
+	} {
+		if _, ok := def.Validate().(*StateModelDefError); !ok {
+			t.Errorf("expect %v to be invalid", def)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package gohelix
+
+import (
+	"errors"
+	"strings"
+)
+
+// Keys of the cluster topology. TOPOLOGY in the cluster config is the path of the domain
+// types from the root to the instance, for example /zone/rack/host. FAULT_ZONE_TYPE is
+// one of the domain types, no two replicas of a partition are placed in the same fault
+// zone. The DOMAIN of an instance config assigns a value to each of the domain types,
+// for example zone=us-east-1a,rack=r12,host=h1.
+const (
+	topologyKey             = "TOPOLOGY"
+	faultZoneTypeKey        = "FAULT_ZONE_TYPE"
+	topologyAwareEnabledKey = "TOPOLOGY_AWARE_ENABLED"
+	domainKey               = "DOMAIN"
+)
+
+var (
+	// ErrInvalidTopology the cluster topology is not of the form /type1/type2/...
+	ErrInvalidTopology = errors.New("invalid cluster topology")
+
+	// ErrInvalidFaultZoneType the fault zone type is not one of the topology types
+	ErrInvalidFaultZoneType = errors.New("fault zone type is not in the cluster topology")
+
+	// ErrTopologyNotSet the cluster topology is required but not configured
+	ErrTopologyNotSet = errors.New("cluster topology not set")
+
+	// ErrInvalidDomain the instance domain does not match the cluster topology
+	ErrInvalidDomain = errors.New("instance domain does not match the cluster topology")
+)
+
+// parseTopology splits a topology such as /zone/rack/host into its domain types
+func parseTopology(topology string) ([]string, error) {
+	topology = strings.TrimSpace(topology)
+	if !strings.HasPrefix(topology, "/") {
+		return nil, ErrInvalidTopology
+	}
+
+	types := strings.Split(strings.TrimPrefix(topology, "/"), "/")
+	for i, t := range types {
+		types[i] = strings.TrimSpace(t)
+		if types[i] == "" || contains(types[:i], types[i]) {
+			return nil, ErrInvalidTopology
+		}
+	}
+
+	return types, nil
+}
+
+// parseDomain parses an instance domain such as zone=us-east-1a,rack=r12,host=h1
+func parseDomain(domain string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	for _, pair := range strings.Split(domain, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrInvalidDomain
+		}
+
+		k := strings.TrimSpace(kv[0])
+		v := strings.TrimSpace(kv[1])
+		if k == "" || v == "" {
+			return nil, ErrInvalidDomain
+		}
+
+		if _, ok := result[k]; ok {
+			return nil, ErrInvalidDomain
+		}
+		result[k] = v
+	}
+
+	return result, nil
+}
+
+// validateDomain makes sure the domain has a value for each of the topology types,
+// and nothing else.
+func validateDomain(types []string, domain map[string]string) error {
+	if len(domain) != len(types) {
+		return ErrInvalidDomain
+	}
+
+	for _, t := range types {
+		if _, ok := domain[t]; !ok {
+			return ErrInvalidDomain
+		}
+	}
+
+	return nil
+}
+
+// faultZone returns the fault zone of a domain. It is the domain path from the root
+// down to the fault zone type, so that racks with the same name in different zones
+// are different fault zones.
+func faultZone(types []string, faultZoneType string, domain map[string]string) string {
+	path := []string{}
+	for _, t := range types {
+		path = append(path, domain[t])
+		if t == faultZoneType {
+			break
+		}
+	}
+	return strings.Join(path, "/")
+}
+
+// getFaultZones maps the instances to their fault zones. It returns nil if the cluster
+// is not topology aware. Instances without a valid domain are left out, so they are
+// not assigned any replicas.
+func getFaultZones(clusterConfig *Record, instanceConfigs map[string]*Record) map[string]string {
+	if !clusterConfig.GetBooleanField(topologyAwareEnabledKey, false) {
+		return nil
+	}
+
+	topology, _ := clusterConfig.GetSimpleField(topologyKey).(string)
+	types, err := parseTopology(topology)
+	if err != nil {
+		Logger.Printf("Ignoring invalid topology %s\n", topology)
+		return nil
+	}
+
+	faultZoneType, _ := clusterConfig.GetSimpleField(faultZoneTypeKey).(string)
+	if !contains(types, faultZoneType) {
+		faultZoneType = types[len(types)-1]
+	}
+
+	zones := make(map[string]string)
+	for instance, config := range instanceConfigs {
+		d, _ := config.GetSimpleField(domainKey).(string)
+		domain, err := parseDomain(d)
+		if err == nil {
+			err = validateDomain(types, domain)
+		}
+
+		if err != nil {
+			Logger.Printf("Instance %s has no valid domain for topology %s\n", instance, topology)
+			continue
+		}
+
+		zones[instance] = faultZone(types, faultZoneType, domain)
+	}
+
+	return zones
+}
@@ -0,0 +1,73 @@
+package gohelix
+
+import "testing"
+
+func TestParseTopology(t *testing.T) {
+	t.Parallel()
+
+	types, err := parseTopology("/zone/rack/host")
+	if err != nil || len(types) != 3 || types[0] != "zone" || types[2] != "host" {
+		t.Error("failed to parse topology")
+	}
+
+	for _, topology := range []string{"", "zone/rack", "/zone//host", "/zone/zone"} {
+		if _, err := parseTopology(topology); err != ErrInvalidTopology {
+			t.Errorf("expect ErrInvalidTopology for %s", topology)
+		}
+	}
+}
+
+func TestValidateDomain(t *testing.T) {
+	t.Parallel()
+
+	types := []string{"zone", "rack", "host"}
+
+	domain, err := parseDomain("zone=us-east-1a, rack=r12, host=h1")
+	if err != nil || domain["rack"] != "r12" {
+		t.Error("failed to parse domain")
+	}
+
+	if err := validateDomain(types, domain); err != nil {
+		t.Error("expect valid domain")
+	}
+
+	for _, d := range []string{"zone=us-east-1a,rack=r12", "zone=us-east-1a,rack=r12,host=h1,dc=east", "zone=us-east-1a,rack,host=h1"} {
+		domain, err := parseDomain(d)
+		if err == nil {
+			err = validateDomain(types, domain)
+		}
+		if err != ErrInvalidDomain {
+			t.Errorf("expect ErrInvalidDomain for %s", d)
+		}
+	}
+}
+
+func TestGetFaultZones(t *testing.T) {
+	t.Parallel()
+
+	cluster := NewRecord("MYCLUSTER")
+	configs := map[string]*Record{
+		"h1": NewRecord("h1"),
+		"h2": NewRecord("h2"),
+		"h3": NewRecord("h3"),
+	}
+	configs["h1"].SetSimpleField(domainKey, "zone=us-east-1a,rack=r12,host=h1")
+	configs["h2"].SetSimpleField(domainKey, "zone=us-east-1b,rack=r12,host=h2")
+
+	if zones := getFaultZones(cluster, configs); zones != nil {
+		t.Error("cluster is not topology aware")
+	}
+
+	cluster.SetSimpleField(topologyKey, "/zone/rack/host")
+	cluster.SetSimpleField(faultZoneTypeKey, "rack")
+	cluster.SetBooleanField(topologyAwareEnabledKey, true)
+
+	zones := getFaultZones(cluster, configs)
+	if zones["h1"] != "us-east-1a/r12" || zones["h2"] != "us-east-1b/r12" {
+		t.Error("racks in different zones should be different fault zones")
+	}
+
+	if _, ok := zones["h3"]; ok {
+		t.Error("instance without domain should not have a fault zone")
+	}
+}
@@ -0,0 +1,249 @@
+package gohelix
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/yichen/go-zookeeper/zk"
+)
+
+// Severity ranks the findings of a verification
+type Severity int
+
+// SeverityError is a broken structure that Helix cannot work with, SeverityWarning
+// leftovers that get in the way, and SeverityInfo leftovers that only take space.
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "ERROR"
+	case SeverityWarning:
+		return "WARNING"
+	}
+	return "INFO"
+}
+
+// Finding is a problem a verification found at a path. A fixable finding is fixed by
+// creating the missing znode at the path, or by removing the tree at the path.
+type Finding struct {
+	Severity Severity
+	Path     string
+	Problem  string
+	Fixable  bool
+	Fixed    bool
+	create   *znode
+}
+
+// VerifyReport lists the findings of a verification, the most severe first, see
+// Admin.VerifyCluster
+type VerifyReport struct {
+	Cluster  string
+	Findings []*Finding
+}
+
+// OK tests if the verification found nothing, or fixed everything it found
+func (r *VerifyReport) OK() bool {
+	for _, f := range r.Findings {
+		if !f.Fixed {
+			return false
+		}
+	}
+	return true
+}
+
+// clusterTree holds what a verification looks at in a cluster
+type clusterTree struct {
+	cluster         string
+	missing         []znode
+	instanceConfigs map[string]*Record
+	liveInstances   map[string]*Record
+	idealStates     map[string]*Record
+	stateModelDefs  map[string]*Record
+
+	// the instances with a tree under INSTANCES, and their current state sessions and
+	// messages
+	instanceTrees map[string]bool
+	sessions      map[string][]string
+	messages      map[string]map[string]*Record
+}
+
+// readClusterTree reads what a verification looks at. The cluster znode must exist.
+func readClusterTree(conn *connection, cluster string) (*clusterTree, error) {
+	keys := KeyBuilder{cluster}
+	t := &clusterTree{
+		cluster:         cluster,
+		instanceConfigs: make(map[string]*Record),
+		liveInstances:   make(map[string]*Record),
+		idealStates:     make(map[string]*Record),
+		stateModelDefs:  make(map[string]*Record),
+		instanceTrees:   make(map[string]bool),
+		sessions:        make(map[string][]string),
+		messages:        make(map[string]map[string]*Record),
+	}
+
+	var err error
+	if t.missing, err = conn.missingZnodes(clusterZnodes(cluster)); err != nil {
+		return nil, err
+	}
+
+	for path, records := range map[string]map[string]*Record{
+		keys.participantConfigs(): t.instanceConfigs,
+		keys.liveInstances():      t.liveInstances,
+		keys.idealStates():        t.idealStates,
+		keys.stateModels():        t.stateModelDefs,
+	} {
+		if err := readRecords(conn, path, records); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, instance := range sortedKeys(t.instanceConfigs) {
+		missing, err := conn.missingZnodes(instanceZnodes(cluster, NewRecord(instance))[1:])
+		if err != nil {
+			return nil, err
+		}
+		t.missing = append(t.missing, missing...)
+	}
+
+	instances, err := conn.childrenIfExists(keys.instances())
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range instances {
+		t.instanceTrees[instance] = true
+
+		if t.sessions[instance], err = conn.childrenIfExists(keys.currentStates(instance)); err != nil {
+			return nil, err
+		}
+
+		t.messages[instance] = make(map[string]*Record)
+		if err := readRecords(conn, keys.messages(instance), t.messages[instance]); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// verify lists the findings in the cluster tree, the most severe first
+func (t *clusterTree) verify() []*Finding {
+	keys := KeyBuilder{t.cluster}
+	findings := []*Finding{}
+	add := func(severity Severity, path string, fixable bool, format string, args ...interface{}) *Finding {
+		f := &Finding{Severity: severity, Path: path, Problem: fmt.Sprintf(format, args...), Fixable: fixable}
+		findings = append(findings, f)
+		return f
+	}
+
+	// the missing znodes, parents first
+	for i := range t.missing {
+		add(SeverityError, t.missing[i].path, true, "missing").create = &t.missing[i]
+	}
+
+	for _, resource := range sortedKeys(t.idealStates) {
+		is := t.idealStates[resource]
+		path := keys.idealStateForResource(resource)
+
+		if stateModel, _ := is.GetSimpleField("STATE_MODEL_DEF_REF").(string); t.stateModelDefs[stateModel] == nil {
+			add(SeverityError, path, false, "unknown state model %q", stateModel)
+		}
+
+		assigned := make(map[string]bool)
+		for p := range is.ListFields {
+			for _, instance := range is.GetListField(p) {
+				assigned[instance] = true
+			}
+		}
+		for _, m := range is.MapFields {
+			for instance := range m {
+				assigned[instance] = true
+			}
+		}
+
+		unknown := []string{}
+		for instance := range assigned {
+			if t.instanceConfigs[instance] == nil {
+				unknown = append(unknown, instance)
+			}
+		}
+		sort.Strings(unknown)
+		for _, instance := range unknown {
+			add(SeverityError, path, false, "assigned to %s that has no config", instance)
+		}
+	}
+
+	instances := []string{}
+	for instance := range t.instanceTrees {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+
+	for _, instance := range instances {
+		configured := t.instanceConfigs[instance] != nil
+		live := t.liveInstances[instance]
+		liveSession := ""
+		if live != nil {
+			liveSession, _ = live.GetSimpleField("SESSION_ID").(string)
+		}
+
+		if !configured {
+			if live != nil {
+				add(SeverityWarning, keys.instance(instance), false, "live instance without config")
+			} else {
+				add(SeverityWarning, keys.instance(instance), true, "instance without config")
+			}
+		}
+
+		for _, session := range t.sessions[instance] {
+			if session != liveSession {
+				add(SeverityInfo, keys.currentStatesForSession(instance, session), true, "current states of a dead session")
+			}
+		}
+
+		for _, id := range sortedKeys(t.messages[instance]) {
+			m := t.messages[instance][id]
+			path := keys.message(instance, id)
+
+			target, _ := m.GetSimpleField("TGT_NAME").(string)
+			if !configured || (target != instance && t.instanceConfigs[target] == nil) {
+				add(SeverityError, path, true, "message to nonexistent instance %s", target)
+				continue
+			}
+
+			if session, _ := m.GetSimpleField("TGT_SESSION_ID").(string); session != "*" && session != liveSession {
+				add(SeverityWarning, path, true, "message to a dead session")
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity > findings[j].Severity
+	})
+	return findings
+}
+
+// fix fixes a fixable finding
+func (f *Finding) fix(conn *connection) error {
+	if f.create != nil {
+		if err := conn.multi([]znode{*f.create}, nil); err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+		f.Fixed = true
+		return nil
+	}
+
+	paths, err := conn.treePaths(f.Path)
+	if err != nil {
+		return err
+	}
+	if err := conn.multi(nil, paths); err != nil {
+		return err
+	}
+	f.Fixed = true
+	return nil
+}
@@ -0,0 +1,77 @@
+package gohelix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVerifyClusterTree(t *testing.T) {
+	t.Parallel()
+
+	kb := KeyBuilder{"MYCLUSTER"}
+	message := func(target string, session string) *Record {
+		m := NewRecord("m")
+		m.SetSimpleField("TGT_NAME", target)
+		m.SetSimpleField("TGT_SESSION_ID", session)
+		return m
+	}
+
+	is := newTestIdealState("myDB", "SEMI_AUTO", 2)
+	is.SetListField("myDB_0", []string{"h1", "h4"})
+	is.SetMapField("myDB_0", "h5", "MASTER")
+	other := newTestIdealState("otherDB", "SEMI_AUTO", 1)
+	other.SetSimpleField("STATE_MODEL_DEF_REF", "Unknown")
+
+	tree := &clusterTree{
+		cluster:         "MYCLUSTER",
+		missing:         []znode{{kb.controllerHistory(), nil}},
+		instanceConfigs: map[string]*Record{"h1": NewRecord("h1"), "h2": NewRecord("h2")},
+		liveInstances:   map[string]*Record{"h1": NewLiveInstanceNode("h1", "s1")},
+		idealStates:     map[string]*Record{"myDB": is, "otherDB": other},
+		stateModelDefs:  map[string]*Record{"MasterSlave": NewRecord("MasterSlave")},
+		instanceTrees:   map[string]bool{"h1": true, "h2": true, "h3": true},
+		sessions:        map[string][]string{"h1": {"s0", "s1"}, "h2": {}, "h3": {}},
+		messages: map[string]map[string]*Record{
+			"h1": {"m1": message("h1", "s1"), "m2": message("h1", "s0"), "m3": message("h9", "s1")},
+			"h2": {"m4": message("h2", "*")},
+			"h3": {"m5": message("h3", "s3")},
+		},
+	}
+
+	type finding struct {
+		Severity Severity
+		Path     string
+		Fixable  bool
+	}
+	expected := []finding{
+		{SeverityError, kb.controllerHistory(), true},
+		{SeverityError, kb.idealStateForResource("myDB"), false},
+		{SeverityError, kb.idealStateForResource("myDB"), false},
+		{SeverityError, kb.idealStateForResource("otherDB"), false},
+		{SeverityError, kb.message("h1", "m3"), true},
+		{SeverityError, kb.message("h3", "m5"), true},
+		{SeverityWarning, kb.message("h1", "m2"), true},
+		{SeverityWarning, kb.instance("h3"), true},
+		{SeverityInfo, kb.currentStatesForSession("h1", "s0"), true},
+	}
+
+	got := []finding{}
+	findings := tree.verify()
+	for _, f := range findings {
+		got = append(got, finding{f.Severity, f.Path, f.Fixable})
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expect the findings %v, got %v", expected, got)
+	}
+
+	if findings[1].Problem != "assigned to h4 that has no config" || findings[2].Problem != "assigned to h5 that has no config" {
+		t.Error("expect the instances without config")
+	}
+	if findings[0].create == nil || findings[0].create.path != kb.controllerHistory() {
+		t.Error("expect the missing znode to be created")
+	}
+
+	if (&VerifyReport{Findings: findings}).OK() || !(&VerifyReport{}).OK() {
+		t.Error("expect a report OK when it has no findings")
+	}
+}
@@ -0,0 +1,407 @@
+package gohelix
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keys of the capacity and weight settings used by the weight aware rebalancer.
+//
+// INSTANCE_CAPACITY_MAP is a map field of the participant config, for example
+// {"CPU": "100", "DISK": "1000"}. DEFAULT_INSTANCE_CAPACITY_MAP in the cluster config
+// is used for the instances without one.
+//
+// PARTITION_CAPACITY_MAP is a map field of the resource config, from the partition
+// name, or DEFAULT for all partitions, to the JSON encoded weights of the partition,
+// for example {"DEFAULT": "{\"CPU\": 2, \"DISK\": 50}"}. DEFAULT_PARTITION_WEIGHT_MAP
+// in the cluster config is used for the partitions without weights.
+//
+// INSTANCE_CAPACITY_KEYS is an optional list field of the cluster config. By default,
+// all the keys of the instance capacity maps are used.
+const (
+	rebalancerClassNameKey        = "REBALANCER_CLASS_NAME"
+	instanceCapacityKeysKey       = "INSTANCE_CAPACITY_KEYS"
+	instanceCapacityMapKey        = "INSTANCE_CAPACITY_MAP"
+	defaultInstanceCapacityMapKey = "DEFAULT_INSTANCE_CAPACITY_MAP"
+	partitionCapacityMapKey       = "PARTITION_CAPACITY_MAP"
+	defaultPartitionWeightMapKey  = "DEFAULT_PARTITION_WEIGHT_MAP"
+	defaultPartitionKey           = "DEFAULT"
+
+	// wagedRebalancerClassName selects the weight aware rebalancer, the same as
+	// the one in the Java Helix controller.
+	wagedRebalancerClassName = "org.apache.helix.controller.rebalancer.waged.WagedRebalancer"
+)
+
+// PlacementError is returned by the rebalancer when some partitions can not be placed
+// without exceeding the capacity of the instances.
+type PlacementError struct {
+	Resource   string
+	Partitions []string
+}
+
+func (e *PlacementError) Error() string {
+	return fmt.Sprintf("no placement fits the instance capacity for %d partitions of %s: %s",
+		len(e.Partitions), e.Resource, strings.Join(e.Partitions, ", "))
+}
+
+// capacityMap maps a capacity key such as CPU or DISK to an amount
+type capacityMap map[string]int
+
+func parseCapacityMap(m map[string]string) capacityMap {
+	result := make(capacityMap)
+	for k, v := range m {
+		if n, err := strconv.Atoi(v); err == nil {
+			result[k] = n
+		}
+	}
+	return result
+}
+
+// getCapacityKeys returns the capacity keys of the cluster
+func getCapacityKeys(clusterConfig *Record, instanceConfigs map[string]*Record) []string {
+	if keys := clusterConfig.GetListField(instanceCapacityKeysKey); len(keys) > 0 {
+		return keys
+	}
+
+	seen := make(map[string]bool)
+	for k := range clusterConfig.MapFields[defaultInstanceCapacityMapKey] {
+		seen[k] = true
+	}
+	for _, config := range instanceConfigs {
+		for k := range config.MapFields[instanceCapacityMapKey] {
+			seen[k] = true
+		}
+	}
+
+	keys := []string{}
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// getInstanceCapacity returns the capacity of an instance. A key missing from both the
+// instance config and the cluster default has no capacity.
+func getInstanceCapacity(clusterConfig *Record, instanceConfig *Record) capacityMap {
+	if m, ok := instanceConfig.MapFields[instanceCapacityMapKey]; ok {
+		return parseCapacityMap(m)
+	}
+	return parseCapacityMap(clusterConfig.MapFields[defaultInstanceCapacityMapKey])
+}
+
+// getPartitionWeights returns the weights of each partition of a resource. The resource
+// config can be nil. A partition without weights weighs nothing.
+func getPartitionWeights(clusterConfig *Record, resourceConfig *Record, partitions []string) (map[string]capacityMap, error) {
+	defaults := parseCapacityMap(clusterConfig.MapFields[defaultPartitionWeightMapKey])
+
+	var weights map[string]string
+	if resourceConfig != nil {
+		weights = resourceConfig.MapFields[partitionCapacityMapKey]
+	}
+
+	if w, ok := weights[defaultPartitionKey]; ok {
+		defaults = make(capacityMap)
+		if err := json.Unmarshal([]byte(w), &defaults); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]capacityMap)
+	for _, p := range partitions {
+		result[p] = defaults
+
+		if w, ok := weights[p]; ok {
+			weight := make(capacityMap)
+			if err := json.Unmarshal([]byte(w), &weight); err != nil {
+				return nil, err
+			}
+			result[p] = weight
+		}
+	}
+
+	return result, nil
+}
+
+// weightedPlacement places weighted partition replicas on instances with limited capacity.
+// It balances the weighted usage of the instances, and never exceeds their capacity.
+type weightedPlacement struct {
+	keys     []string
+	zones    map[string]string
+	capacity map[string]capacityMap
+	usage    map[string]capacityMap
+
+	// number of replicas placed on each instance, to spread partitions without weights
+	replicas map[string]int
+}
+
+func newWeightedPlacement(keys []string, zones map[string]string, capacity map[string]capacityMap) *weightedPlacement {
+	return &weightedPlacement{
+		keys:     keys,
+		zones:    zones,
+		capacity: capacity,
+		usage:    make(map[string]capacityMap),
+		replicas: make(map[string]int),
+	}
+}
+
+// fits tests if the instance has enough capacity left for the weight
+func (wp *weightedPlacement) fits(instance string, weight capacityMap) bool {
+	for _, k := range wp.keys {
+		if wp.usage[instance][k]+weight[k] > wp.capacity[instance][k] {
+			return false
+		}
+	}
+	return true
+}
+
+// add records the weight as used on the instance
+func (wp *weightedPlacement) add(instance string, weight capacityMap) {
+	if wp.usage[instance] == nil {
+		wp.usage[instance] = make(capacityMap)
+	}
+
+	for _, k := range wp.keys {
+		wp.usage[instance][k] += weight[k]
+	}
+	wp.replicas[instance]++
+}
+
+// utilization is the highest ratio of usage to capacity of the instance across all the
+// keys, if the weight was added to it.
+func (wp *weightedPlacement) utilization(instance string, weight capacityMap) float64 {
+	result := 0.0
+	for _, k := range wp.keys {
+		if wp.capacity[instance][k] == 0 {
+			continue
+		}
+
+		u := float64(wp.usage[instance][k]+weight[k]) / float64(wp.capacity[instance][k])
+		if u > result {
+			result = u
+		}
+	}
+	return result
+}
+
+// pick returns the instance with the lowest utilization after adding the weight, or the
+// fewest replicas among equals. The instance must have enough capacity left and must not
+// share a fault zone with the instances in exclude. It returns an empty string if no
+// instance fits.
+func (wp *weightedPlacement) pick(instances []string, exclude []string, weight capacityMap) string {
+	result := ""
+	best := 0.0
+
+	for _, i := range instances {
+		if sharesZone(wp.zones, exclude, i) || !wp.fits(i, weight) {
+			continue
+		}
+
+		u := wp.utilization(i, weight)
+		if result == "" || u < best || (u == best && wp.replicas[i] < wp.replicas[result]) {
+			result = i
+			best = u
+		}
+	}
+
+	return result
+}
+
+// assign places the replicas of each partition. The heaviest partitions are placed
+// first. Current assignments are kept when they still fit. It returns the preference
+// lists and the partitions that can not get all of their replicas.
+func (wp *weightedPlacement) assign(partitions []string, replicas int, instances []string, weights map[string]capacityMap, current map[string][]string) (map[string][]string, []string) {
+	if n := countZones(instances, wp.zones); replicas > n {
+		replicas = n
+	}
+
+	ordered := byWeight{make([]string, len(partitions)), make(map[string]float64)}
+	copy(ordered.partitions, partitions)
+	for _, p := range partitions {
+		ordered.weights[p] = wp.total(weights[p])
+	}
+	sort.Stable(ordered)
+
+	available := make(map[string]bool)
+	for _, i := range instances {
+		available[i] = true
+	}
+
+	lists := make(map[string][]string)
+	unplaced := []string{}
+
+	for _, p := range ordered.partitions {
+		list := []string{}
+
+		for _, i := range current[p] {
+			if len(list) == replicas {
+				break
+			}
+
+			if available[i] && !sharesZone(wp.zones, list, i) && wp.fits(i, weights[p]) {
+				list = append(list, i)
+				wp.add(i, weights[p])
+			}
+		}
+
+		for len(list) < replicas {
+			i := wp.pick(instances, list, weights[p])
+			if i == "" {
+				unplaced = append(unplaced, p)
+				break
+			}
+
+			list = append(list, i)
+			wp.add(i, weights[p])
+		}
+
+		lists[p] = list
+	}
+
+	sort.Strings(unplaced)
+	return lists, unplaced
+}
+
+// ensureMinActive is the weight aware version of ensureMinActiveReplicas. It returns the
+// partitions that can not reach minActive live replicas within the capacity.
+func (wp *weightedPlacement) ensureMinActive(lists map[string][]string, partitions []string, live []string, weights map[string]capacityMap, minActive int) []string {
+	isLive := make(map[string]bool)
+	for _, i := range live {
+		isLive[i] = true
+	}
+
+	unplaced := []string{}
+	for _, p := range partitions {
+		list := lists[p]
+
+		active := 0
+		for _, i := range list {
+			if isLive[i] {
+				active++
+			}
+		}
+
+		for active < minActive {
+			i := wp.pick(live, list, weights[p])
+			if i == "" {
+				unplaced = append(unplaced, p)
+				break
+			}
+
+			list = append(list, i)
+			wp.add(i, weights[p])
+			active++
+		}
+
+		lists[p] = list
+	}
+
+	return unplaced
+}
+
+// total is the sum of the weight over all the capacity keys, relative to the average
+// capacity, so that keys with large amounts do not dominate.
+func (wp *weightedPlacement) total(weight capacityMap) float64 {
+	result := 0.0
+	for _, k := range wp.keys {
+		capacity := 0
+		for _, c := range wp.capacity {
+			capacity += c[k]
+		}
+
+		if capacity > 0 {
+			result += float64(weight[k]) / float64(capacity)
+		}
+	}
+	return result
+}
+
+// byWeight sorts the partitions from the heaviest to the lightest
+type byWeight struct {
+	partitions []string
+	weights    map[string]float64
+}
+
+func (b byWeight) Len() int           { return len(b.partitions) }
+func (b byWeight) Swap(i, j int)      { b.partitions[i], b.partitions[j] = b.partitions[j], b.partitions[i] }
+func (b byWeight) Less(i, j int) bool { return b.weights[b.partitions[i]] > b.weights[b.partitions[j]] }
+
+// getRebalancerClassName returns the rebalancer of the resource. The resource config,
+// which can be nil, takes precedence over the ideal state.
+func getRebalancerClassName(idealState *Record, resourceConfig *Record) string {
+	if resourceConfig != nil {
+		if name, ok := resourceConfig.GetSimpleField(rebalancerClassNameKey).(string); ok && name != "" {
+			return name
+		}
+	}
+
+	name, _ := idealState.GetSimpleField(rebalancerClassNameKey).(string)
+	return name
+}
+
+// newResourcePlacement prepares the weighted placement of a resource. The capacity already
+// used by the other resources of the cluster is taken into account.
+func (s *ClusterSnapshot) newResourcePlacement(zones map[string]string, resource string, partitions []string) (*weightedPlacement, map[string]capacityMap, error) {
+	capacity := make(map[string]capacityMap)
+	for i, config := range s.InstanceConfigs {
+		capacity[i] = getInstanceCapacity(s.ClusterConfig, config)
+	}
+
+	wp := newWeightedPlacement(getCapacityKeys(s.ClusterConfig, s.InstanceConfigs), zones, capacity)
+
+	usage, err := s.capacityUsage(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+	wp.usage = usage
+
+	weights, err := getPartitionWeights(s.ClusterConfig, s.ResourceConfigs[resource], partitions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return wp, weights, nil
+}
+
+// capacityUsage sums up the weights of the partitions of all the resources other than
+// the one being rebalanced, by instance. A partition is counted on the instances of its
+// preference list, or on the instances currently holding it if it has none.
+func (s *ClusterSnapshot) capacityUsage(resource string) (map[string]capacityMap, error) {
+	result := make(map[string]capacityMap)
+
+	for r, is := range s.IdealStates {
+		if r == resource {
+			continue
+		}
+
+		partitions := s.Partitions(r)
+		weights, err := getPartitionWeights(s.ClusterConfig, s.ResourceConfigs[r], partitions)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range partitions {
+			instances := is.GetListField(p)
+			if len(instances) == 0 {
+				for i := range s.CurrentStateMap(r, p) {
+					instances = append(instances, i)
+				}
+			}
+
+			for _, i := range instances {
+				if result[i] == nil {
+					result[i] = make(capacityMap)
+				}
+
+				for k, v := range weights[p] {
+					result[i][k] += v
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package gohelix
+
+import "testing"
+
+func TestWeightedPlacement(t *testing.T) {
+	t.Parallel()
+
+	instances := []string{"h1", "h2"}
+	capacity := map[string]capacityMap{
+		"h1": {"DISK": 1000},
+		"h2": {"DISK": 1000},
+	}
+
+	// one partition is 100 times larger than the others
+	partitions := partitionNames("myDB", 4)
+	weights := map[string]capacityMap{
+		"myDB_0": {"DISK": 500},
+		"myDB_1": {"DISK": 5},
+		"myDB_2": {"DISK": 5},
+		"myDB_3": {"DISK": 5},
+	}
+
+	wp := newWeightedPlacement([]string{"DISK"}, nil, capacity)
+	lists, unplaced := wp.assign(partitions, 1, instances, weights, nil)
+
+	if len(unplaced) != 0 {
+		t.Error("all partitions should fit")
+	}
+
+	large := lists["myDB_0"][0]
+	for _, p := range partitions[1:] {
+		if lists[p][0] == large {
+			t.Errorf("partition %s should not be placed with the large partition", p)
+		}
+	}
+}
+
+func TestWeightedPlacementCapacity(t *testing.T) {
+	t.Parallel()
+
+	instances := []string{"h1", "h2"}
+	capacity := map[string]capacityMap{
+		"h1": {"CPU": 10, "DISK": 100},
+		"h2": {"CPU": 10, "DISK": 100},
+	}
+
+	partitions := partitionNames("myDB", 3)
+	weights := map[string]capacityMap{}
+	for _, p := range partitions {
+		weights[p] = capacityMap{"CPU": 4, "DISK": 60}
+	}
+
+	wp := newWeightedPlacement([]string{"CPU", "DISK"}, nil, capacity)
+	_, unplaced := wp.assign(partitions, 1, instances, weights, nil)
+
+	if len(unplaced) != 1 {
+		t.Errorf("expect one partition not to fit, but got %v", unplaced)
+	}
+
+	for _, i := range instances {
+		if wp.usage[i]["DISK"] > 100 {
+			t.Errorf("instance %s exceeds its capacity", i)
+		}
+	}
+}
+
+func TestWeightedPlacementWithoutWeights(t *testing.T) {
+	t.Parallel()
+
+	instances := []string{"h1", "h2", "h3"}
+	partitions := partitionNames("myDB", 6)
+
+	wp := newWeightedPlacement([]string{}, nil, map[string]capacityMap{})
+	lists, _ := wp.assign(partitions, 1, instances, map[string]capacityMap{}, nil)
+
+	load := map[string]int{}
+	for _, p := range partitions {
+		load[lists[p][0]]++
+	}
+
+	for _, i := range instances {
+		if load[i] != 2 {
+			t.Errorf("instance %s should have 2 partitions, but has %d", i, load[i])
+		}
+	}
+}
+
+func TestGetPartitionWeights(t *testing.T) {
+	t.Parallel()
+
+	cluster := NewRecord("MYCLUSTER")
+	cluster.SetMapField(defaultPartitionWeightMapKey, "DISK", "1")
+
+	resource := NewRecord("myDB")
+	resource.SetMapField(partitionCapacityMapKey, "myDB_1", `{"DISK": 100}`)
+
+	weights, err := getPartitionWeights(cluster, resource, partitionNames("myDB", 2))
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	if weights["myDB_0"]["DISK"] != 1 || weights["myDB_1"]["DISK"] != 100 {
+		t.Error("wrong partition weights")
+	}
+
+	resource.SetMapField(partitionCapacityMapKey, "DEFAULT", `{"DISK": 10}`)
+	weights, _ = getPartitionWeights(cluster, resource, partitionNames("myDB", 2))
+	if weights["myDB_0"]["DISK"] != 10 {
+		t.Error("the resource default should override the cluster default")
+	}
+}